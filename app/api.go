@@ -0,0 +1,272 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// apiPunchFutureTolerance allows the clock of the client to be slightly ahead
+const apiPunchFutureTolerance = time.Minute
+
+var apiStateNames = map[attendanceState]string{
+	attendanceStateNotStarted: "not_started",
+	attendanceStateWorking:    "working",
+	attendanceStateResting:    "resting",
+	attendanceStateLeft:       "left",
+	attendanceStateHoliday:    "holiday",
+}
+
+var errInvalidPunchTime = errors.New("time must be RFC 3339 or HH:MM within the last 24 hours")
+
+type apiError struct {
+	Code            string `json:"code"`
+	Message         string `json:"message"`
+	State           string `json:"state,omitempty"`
+	AuthenticateURL string `json:"authenticate_url,omitempty"`
+}
+
+type apiTimeTable struct {
+	Date           string             `json:"date"`
+	State          string             `json:"state"`
+	StateText      string             `json:"state_text"`
+	IsHoliday      bool               `json:"is_holiday"`
+	Items          []apiTimeTableItem `json:"items"`
+	AllowedActions []string           `json:"allowed_actions"`
+}
+
+type apiTimeTableItem struct {
+	Type string `json:"type"`
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+type apiPunchRequest struct {
+	Action string `json:"action"`
+	Time   string `json:"time"`
+}
+
+type apiPunchResponse struct {
+	Action   string    `json:"action"`
+	Time     time.Time `json:"time"`
+	Message  string    `json:"message"`
+	Queued   bool      `json:"queued"`
+	QueuedID string    `json:"queued_id,omitempty"`
+	Warnings []string  `json:"warnings,omitempty"`
+}
+
+// newAPITimeTable converts the time table, whose date is today when it is not set
+func newAPITimeTable(tt *timeTable, now time.Time) apiTimeTable {
+	date := tt.Date
+	if date.IsZero() {
+		date = now
+	}
+	state := tt.State()
+	res := apiTimeTable{
+		Date:           date.Format("2006-01-02"),
+		State:          apiStateNames[state],
+		StateText:      state.String(),
+		IsHoliday:      tt.IsHoliday != nil && *tt.IsHoliday,
+		Items:          []apiTimeTableItem{},
+		AllowedActions: state.AllowedActions(),
+	}
+	for _, item := range tt.Items {
+		kind := "rest"
+		if item.IsAttendance() {
+			kind = "attendance"
+		}
+		res.Items = append(res.Items, apiTimeTableItem{
+			Type: kind,
+			From: formatMinutes(item.From),
+			To:   formatMinutes(item.To),
+		})
+	}
+	return res
+}
+
+// parseAPIPunchTime parses the time of the punch, which defaults to now. HH:MM is on the
+// workday of now, which continues to the previous day before the day boundary hour.
+func parseAPIPunchTime(value string, now time.Time, dayBoundaryHour int) (time.Time, error) {
+	if value == "" {
+		return now, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		clock, err := time.Parse("15:04", value)
+		if err != nil {
+			return now, errInvalidPunchTime
+		}
+		day := now
+		if now.Hour() < dayBoundaryHour && clock.Hour() >= dayBoundaryHour {
+			day = now.AddDate(0, 0, -1)
+		}
+		t = time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location())
+	}
+	if t.After(now.Add(apiPunchFutureTolerance)) || now.Sub(t) > queuedPunchExpiry {
+		return now, errInvalidPunchTime
+	}
+	return t.In(now.Location()), nil
+}
+
+func writeAPIResponse(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, err apiError) {
+	writeAPIResponse(w, status, map[string]apiError{"error": err})
+}
+
+// getAPIError maps errors of TeamSpirit and the punch to the status code and the error body
+func (ctx *Context) getAPIError(text string, teamID string, err error) (int, apiError) {
+	res := apiError{Message: stripEmoji(getTimeTableErrorText(text, err))}
+	if refused, ok := err.(*punchRefusedError); ok {
+		res.Code = "action_not_allowed"
+		res.State = apiStateNames[refused.State]
+		res.Message = stripEmoji(ctx.getRefusalSlackMessage(refused.State, refused.Action).Text)
+		return http.StatusConflict, res
+	}
+	if blocked, ok := err.(*complianceError); ok {
+		res.Code = "compliance_violation"
+		res.Message = stripEmoji(blocked.Text())
+		return http.StatusUnprocessableEntity, res
+	}
+	if err == errNotAuthenticated || isAuthError(err) {
+		res.Code = "teamspirit_auth_required"
+		res.Message = "TeamSpirit で認証を行ってください"
+		if stateKey, err := ctx.storeState(State{TeamID: teamID}); err == nil {
+			res.AuthenticateURL = ctx.getSalesforceAuthenticateURL(stateKey)
+		}
+		return http.StatusForbidden, res
+	}
+	if err == errTimeTableConflict {
+		res.Code = "conflict"
+		return http.StatusConflict, res
+	}
+	if err == errHolidayWorkNotApplied {
+		res.Code = "holiday_work_not_applied"
+		return http.StatusUnprocessableEntity, res
+	}
+	switch err.(type) {
+	case *timeTableValidationError:
+		res.Code = "validation_failed"
+		return http.StatusUnprocessableEntity, res
+	case *timeTableBusinessError:
+		res.Code = "rejected"
+		return http.StatusUnprocessableEntity, res
+	case *timeTableRateLimitError:
+		res.Code = "rate_limited"
+		return http.StatusTooManyRequests, res
+	case *timeTableNetworkError:
+		res.Code = "teamspirit_unavailable"
+		return http.StatusServiceUnavailable, res
+	case *timeTableNotFoundError:
+		res.Code = "apex_class_not_found"
+		return http.StatusBadGateway, res
+	}
+	res.Code = "teamspirit_error"
+	return http.StatusBadGateway, res
+}
+
+// getAPIContext returns the context of the owner of the bearer token, or nil with the error response written
+func (app *App) getAPIContext(w http.ResponseWriter, r *http.Request) (*Context, *apiToken) {
+	app.reconnectRedisIfNeeeded()
+	ctx := app.createContext(r)
+	auth := r.Header.Get("Authorization")
+	var token *apiToken
+	if strings.HasPrefix(auth, "Bearer ") {
+		token = ctx.authenticateAPIToken(strings.TrimSpace(strings.TrimPrefix(auth, "Bearer ")))
+	}
+	if token == nil {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="ts-dakoku"`)
+		writeAPIError(w, http.StatusUnauthorized, apiError{
+			Code:    "unauthorized",
+			Message: "API トークンが無効です。`/ts token new` で発行してください",
+		})
+		return nil, nil
+	}
+	return ctx, token
+}
+
+func (app *App) handleAPITimeTable(w http.ResponseWriter, r *http.Request) {
+	ctx, token := app.getAPIContext(w, r)
+	if ctx == nil {
+		return
+	}
+	c := r.Context()
+	client := ctx.createTimeTableClient(c)
+	if client.HTTPClient == nil {
+		status, res := ctx.getAPIError("", token.TeamID, errNotAuthenticated)
+		writeAPIError(w, status, res)
+		return
+	}
+	now := ctx.getCurrentTimeForUser()
+	timeTable, err := ctx.getCurrentTimeTable(c, client, now)
+	if err != nil {
+		status, res := ctx.getAPIError("勤務表の取得に失敗しました", token.TeamID, err)
+		writeAPIError(w, status, res)
+		return
+	}
+	writeAPIResponse(w, http.StatusOK, newAPITimeTable(timeTable, now))
+}
+
+func (app *App) handleAPIPunch(w http.ResponseWriter, r *http.Request) {
+	ctx, token := app.getAPIContext(w, r)
+	if ctx == nil {
+		return
+	}
+	var req apiPunchRequest
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeAPIError(w, http.StatusBadRequest, apiError{Code: "invalid_request", Message: err.Error()})
+			return
+		}
+	} else {
+		req.Action = r.PostFormValue("action")
+		req.Time = r.PostFormValue("time")
+	}
+	if _, ok := attendanceActionTexts[req.Action]; !ok {
+		writeAPIError(w, http.StatusBadRequest, apiError{
+			Code:    "invalid_action",
+			Message: "action must be one of attend, leave, rest and unrest",
+		})
+		return
+	}
+	now, err := parseAPIPunchTime(req.Time, ctx.getCurrentTimeForUser(), ctx.DayBoundaryHour)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, apiError{Code: "invalid_time", Message: err.Error()})
+		return
+	}
+	c := r.Context()
+	result, err := ctx.punch(c, ctx.createTimeTableClient(c), queuedPunch{TeamID: token.TeamID, Action: req.Action, Time: now})
+	if result.Queued != nil {
+		writeAPIResponse(w, http.StatusAccepted, apiPunchResponse{
+			Action:   req.Action,
+			Time:     now,
+			Message:  "TeamSpirit に接続できないため打刻を保留しました: " + result.Queued.Describe(now.Location()),
+			Queued:   true,
+			QueuedID: result.Queued.ID,
+		})
+		return
+	}
+	if err != nil {
+		text := "勤務表の更新に失敗しました"
+		if result.TimeTable == nil {
+			text = "勤務表の取得に失敗しました"
+		}
+		status, res := ctx.getAPIError(text, token.TeamID, err)
+		writeAPIError(w, status, res)
+		return
+	}
+	text := attendanceActionTexts[req.Action] + " (" + formatTime(now) + ")"
+	ctx.notifyPunch(text)
+	writeAPIResponse(w, http.StatusOK, apiPunchResponse{
+		Action:   req.Action,
+		Time:     now,
+		Message:  stripEmoji(text + getAddedRestText(result.Rest)),
+		Warnings: getComplianceWarnings(result.Warnings),
+	})
+}
@@ -0,0 +1,251 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func createAPITestToken(app *App) string {
+	ctx := app.createContext(nil)
+	ctx.UserID = "FOO"
+	secret, _, _ := ctx.createAPIToken("T12345678", "test")
+	ctx.setSalesforceAccessToken(&oauth2.Token{AccessToken: "foo", RefreshToken: "bar", TokenType: "Bearer"})
+	return secret
+}
+
+func serveAPIRequest(app *App, method, path, token, contentType, body string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	req, _ := http.NewRequest(method, "https://example.com"+path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	res := httptest.NewRecorder()
+	app.setupRouter().ServeHTTP(res, req)
+	data := map[string]interface{}{}
+	json.Unmarshal(res.Body.Bytes(), &data)
+	return res, data
+}
+
+func TestHandleAPIUnauthorized(t *testing.T) {
+	app := createMockApp()
+	app.CleanRedis()
+	for _, token := range []string{"", "tsd_unknown"} {
+		res, data := serveAPIRequest(app, http.MethodGet, "/api/v1/timetable", token, "", "")
+		for _, test := range []Test{
+			{401, res.Code},
+			{"application/json; charset=utf-8", res.Header().Get("Content-Type")},
+			{`Bearer realm="ts-dakoku"`, res.Header().Get("WWW-Authenticate")},
+			{"unauthorized", data["error"].(map[string]interface{})["code"]},
+		} {
+			test.Compare(t)
+		}
+	}
+}
+
+func TestHandleAPITimeTable(t *testing.T) {
+	defer gock.Off()
+	app := createMockApp()
+	app.CleanRedis()
+	token := createAPITestToken(app)
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Get("/services/apexrest/Dakoku").
+		Reply(200).
+		JSON(map[string]interface{}{
+			"timeTable": []map[string]interface{}{{"from": 540, "to": nil, "type": 1}},
+			"isHoliday": false,
+		})
+	res, data := serveAPIRequest(app, http.MethodGet, "/api/v1/timetable", token, "", "")
+	for _, test := range []Test{
+		{200, res.Code},
+		{true, gock.IsDone()},
+		{"working", data["state"]},
+		{"勤務中", data["state_text"]},
+		{false, data["is_holiday"]},
+		{time.Now().Format("2006-01-02"), data["date"]},
+		{[]interface{}{map[string]interface{}{"type": "attendance", "from": "09:00"}}, data["items"]},
+		{[]interface{}{"rest", "leave"}, data["allowed_actions"]},
+	} {
+		test.DeepEqual(t)
+	}
+
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Get("/services/apexrest/Dakoku").
+		Reply(200).
+		JSON([]map[string]interface{}{{"message": "Session expired or invalid", "errorCode": "INVALID_SESSION_ID"}})
+	res, data = serveAPIRequest(app, http.MethodGet, "/api/v1/timetable", token, "", "")
+	apiErr := data["error"].(map[string]interface{})
+	for _, test := range []Test{
+		{403, res.Code},
+		{"teamspirit_auth_required", apiErr["code"]},
+		{0, strings.Index(apiErr["authenticate_url"].(string), "https://example.com/oauth/salesforce/authenticate/")},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestHandleAPIPunch(t *testing.T) {
+	defer gock.Off()
+	app := createMockApp()
+	app.CleanRedis()
+	token := createAPITestToken(app)
+
+	res, data := serveAPIRequest(app, http.MethodPost, "/api/v1/punch", token, "application/json", `{"action":"foo"}`)
+	Test{400, res.Code}.Compare(t)
+	Test{"invalid_action", data["error"].(map[string]interface{})["code"]}.Compare(t)
+
+	res, data = serveAPIRequest(app, http.MethodPost, "/api/v1/punch", token, "application/json", `{"action":"rest","time":"tomorrow"}`)
+	Test{400, res.Code}.Compare(t)
+	Test{"invalid_time", data["error"].(map[string]interface{})["code"]}.Compare(t)
+
+	res, data = serveAPIRequest(app, http.MethodPost, "/api/v1/punch", token, "application/json", `{`)
+	Test{400, res.Code}.Compare(t)
+	Test{"invalid_request", data["error"].(map[string]interface{})["code"]}.Compare(t)
+
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Get("/services/apexrest/Dakoku").
+		Reply(200).
+		JSON(map[string]interface{}{
+			"timeTable": []map[string]interface{}{{"from": 0, "to": nil, "type": 1}},
+			"isHoliday": false,
+		})
+	res, data = serveAPIRequest(app, http.MethodPost, "/api/v1/punch", token, "application/json", `{"action":"unrest"}`)
+	apiErr := data["error"].(map[string]interface{})
+	for _, test := range []Test{
+		{409, res.Code},
+		{true, gock.IsDone()},
+		{"action_not_allowed", apiErr["code"]},
+		{"working", apiErr["state"]},
+		{"現在は勤務中のため「休憩を終了する」はできません", apiErr["message"]},
+	} {
+		test.Compare(t)
+	}
+
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Get("/services/apexrest/Dakoku").
+		Reply(200).
+		JSON(map[string]interface{}{
+			"timeTable": []map[string]interface{}{{"from": 0, "to": nil, "type": 1}},
+			"isHoliday": false,
+		})
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Post("/services/apexrest/Dakoku").
+		Reply(200).
+		BodyString(`"OK"`)
+	res, data = serveAPIRequest(app, http.MethodPost, "/api/v1/punch", token, "application/x-www-form-urlencoded", "action=rest")
+	for _, test := range []Test{
+		{200, res.Code},
+		{true, gock.IsDone()},
+		{"rest", data["action"]},
+		{false, data["queued"]},
+		{true, strings.HasPrefix(data["message"].(string), "休憩を開始しました (")},
+	} {
+		test.Compare(t)
+	}
+
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Get("/services/apexrest/Dakoku").
+		Times(3).
+		Reply(503)
+	res, data = serveAPIRequest(app, http.MethodPost, "/api/v1/punch", token, "application/json", `{"action":"unrest"}`)
+	ctx := app.createContext(nil)
+	ctx.UserID = "FOO"
+	punches := ctx.getQueuedPunches()
+	for _, test := range []Test{
+		{202, res.Code},
+		{true, gock.IsDone()},
+		{true, data["queued"]},
+		{1, len(punches)},
+		{punches[0].ID, data["queued_id"]},
+		{"T12345678", punches[0].TeamID},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestHandleAPIPunchAtTime(t *testing.T) {
+	defer gock.Off()
+	app := createMockApp()
+	app.CleanRedis()
+	token := createAPITestToken(app)
+	ctx := app.createContext(nil)
+	ctx.UserID = "FOO"
+	ctx.setTimeZoneForUser("Asia/Tokyo")
+	loc, _ := time.LoadLocation("Asia/Tokyo")
+	punchTime := time.Now().In(loc).Truncate(time.Minute)
+
+	// The command line client sends HH:MM with `punch in|out --time`
+	for _, test := range []struct {
+		action     string
+		time       string
+		attendance bool
+		items      []map[string]interface{}
+	}{
+		{actionTypeAttend, punchTime.Format(time.RFC3339), true, []map[string]interface{}{}},
+		{actionTypeAttend, punchTime.Format("15:04"), true, []map[string]interface{}{}},
+		{actionTypeLeave, punchTime.Format("15:04"), false, []map[string]interface{}{{"from": 0, "to": nil, "type": 1}}},
+	} {
+		gock.New("https://teamspirit-1234.cloudforce.test").
+			Get("/services/apexrest/Dakoku").
+			Persist().
+			Reply(200).
+			JSON(map[string]interface{}{"timeTable": test.items, "isHoliday": false})
+		gock.New("https://teamspirit-1234.cloudforce.test").
+			Put("/services/apexrest/Dakoku").
+			JSON(map[string]interface{}{"attendance": test.attendance, "minute": punchTime.Hour()*60 + punchTime.Minute()}).
+			Reply(200).
+			BodyString(`"OK"`)
+		res, data := serveAPIRequest(app, http.MethodPost, "/api/v1/punch", token, "application/json",
+			`{"action":"`+test.action+`","time":"`+test.time+`"}`)
+		for _, test := range []Test{
+			{200, res.Code},
+			{punchTime.Format(time.RFC3339), data["time"]},
+		} {
+			test.Compare(t)
+		}
+		gock.Off()
+	}
+}
+
+func TestParseAPIPunchTime(t *testing.T) {
+	now := getMockTime()
+	for _, test := range []struct {
+		value    string
+		expected string
+		err      error
+	}{
+		{"", "2018-09-01 11:12:22 +0900", nil},
+		{"10:30", "2018-09-01 10:30:00 +0900", nil},
+		{"2018-09-01T01:00:00Z", "2018-09-01 10:00:00 +0900", nil},
+		{"2018-09-01T11:13:00+09:00", "2018-09-01 11:13:00 +0900", nil},
+		{"11:30", "2018-09-01 11:12:22 +0900", errInvalidPunchTime},
+		{"2018-08-31T11:00:00+09:00", "2018-09-01 11:12:22 +0900", errInvalidPunchTime},
+		{"10:3", "2018-09-01 11:12:22 +0900", errInvalidPunchTime},
+	} {
+		actual, err := parseAPIPunchTime(test.value, now, 5)
+		Test{test.expected, actual.Format("2006-01-02 15:04:05 -0700")}.Compare(t)
+		Test{test.err, err}.Compare(t)
+	}
+	midnight := time.Date(2018, time.September, 2, 0, 30, 0, 0, now.Location())
+	for _, test := range []struct {
+		value    string
+		expected string
+		err      error
+	}{
+		{"23:50", "2018-09-01 23:50:00 +0900", nil},
+		{"00:10", "2018-09-02 00:10:00 +0900", nil},
+		{"04:00", "2018-09-02 00:30:00 +0900", errInvalidPunchTime},
+	} {
+		actual, err := parseAPIPunchTime(test.value, midnight, 5)
+		Test{test.expected, actual.Format("2006-01-02 15:04:05 -0700")}.Compare(t)
+		Test{test.err, err}.Compare(t)
+	}
+}
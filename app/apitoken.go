@@ -0,0 +1,163 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/nlopes/slack"
+)
+
+const (
+	apiTokenPrefix = "tsd_"
+	maxAPITokens   = 10
+)
+
+var errTooManyAPITokens = errors.New("too many API tokens")
+
+// apiToken is a personal token authenticating the API requests of the user.
+// Only the digest is stored, so the token itself is shown once when it is issued.
+type apiToken struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name,omitempty"`
+	Digest    string    `json:"digest"`
+	TeamID    string    `json:"team_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func getAPITokenDigest(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// getAPITokenDigestStoreKey returns the hash looking up users by the digests of their tokens
+func (ctx *Context) getAPITokenDigestStoreKey() string {
+	return ctx.APITokenStoreKey + ":digests"
+}
+
+func (ctx *Context) getAPITokens() []apiToken {
+	tokens := []apiToken{}
+	data := ctx.getVariableInHash(ctx.APITokenStoreKey, ctx.UserID)
+	if data == "" {
+		return tokens
+	}
+	json.Unmarshal([]byte(data), &tokens)
+	return tokens
+}
+
+func (ctx *Context) setAPITokens(tokens []apiToken) error {
+	if len(tokens) == 0 {
+		_, err := ctx.RedisConn.Do("HDEL", ctx.APITokenStoreKey, ctx.UserID)
+		return err
+	}
+	data, err := json.Marshal(tokens)
+	if err != nil {
+		return err
+	}
+	return ctx.setVariableInHash(ctx.APITokenStoreKey, data)
+}
+
+// createAPIToken issues a new token of the user, and returns it with the stored record
+func (ctx *Context) createAPIToken(teamID, name string) (string, *apiToken, error) {
+	tokens := ctx.getAPITokens()
+	if len(tokens) >= maxAPITokens {
+		return "", nil, errTooManyAPITokens
+	}
+	secret := apiTokenPrefix + ctx.randomString(40)
+	token := apiToken{
+		Name:      name,
+		Digest:    getAPITokenDigest(secret),
+		TeamID:    teamID,
+		CreatedAt: ctx.now(),
+	}
+	token.ID = token.Digest[:8]
+	if _, err := redis.Bool(ctx.RedisConn.Do("HSET", ctx.getAPITokenDigestStoreKey(), token.Digest, ctx.UserID)); err != nil {
+		return "", nil, err
+	}
+	if err := ctx.setAPITokens(append(tokens, token)); err != nil {
+		return "", nil, err
+	}
+	return secret, &token, nil
+}
+
+func (ctx *Context) revokeAPIToken(id string) bool {
+	tokens := ctx.getAPITokens()
+	for i, token := range tokens {
+		if token.ID == id {
+			ctx.RedisConn.Do("HDEL", ctx.getAPITokenDigestStoreKey(), token.Digest)
+			ctx.setAPITokens(append(tokens[:i], tokens[i+1:]...))
+			return true
+		}
+	}
+	return false
+}
+
+// authenticateAPIToken sets the owner of the token to the context, and returns nil if it is unknown or revoked
+func (ctx *Context) authenticateAPIToken(secret string) *apiToken {
+	if !strings.HasPrefix(secret, apiTokenPrefix) {
+		return nil
+	}
+	digest := getAPITokenDigest(secret)
+	userID := ctx.getVariableInHash(ctx.getAPITokenDigestStoreKey(), digest)
+	if userID == "" {
+		return nil
+	}
+	ctx.UserID = userID
+	for _, token := range ctx.getAPITokens() {
+		if token.Digest == digest {
+			return &token
+		}
+	}
+	return nil
+}
+
+func (ctx *Context) getAPITokenSlackMessage(teamID string, args []string) *slack.Msg {
+	if len(args) > 0 && args[0] == "new" {
+		secret, token, err := ctx.createAPIToken(teamID, strings.Join(args[1:], " "))
+		if err == errTooManyAPITokens {
+			return &slack.Msg{
+				Text: "API トークンは " + strconv.Itoa(maxAPITokens) + " 個まで発行できます。`/ts token revoke ID` で不要なトークンを無効化してください :warning:",
+			}
+		}
+		if err != nil {
+			return &slack.Msg{
+				Text: "API トークンの発行に失敗しました :warning:",
+			}
+		}
+		return &slack.Msg{
+			Text: "API トークン `" + token.ID + "` を発行しました :key: このトークンは再表示できないため、安全な場所に保管してください\n" +
+				"```" + secret + "```\n" +
+				"例: `curl -H 'Authorization: Bearer " + secret + "' " + ctx.BaseURL + "/api/v1/timetable`",
+		}
+	}
+	if len(args) > 1 && args[0] == "revoke" {
+		if !ctx.revokeAPIToken(args[1]) {
+			return &slack.Msg{
+				Text: "API トークン `" + args[1] + "` が見つかりません :warning:",
+			}
+		}
+		return &slack.Msg{
+			Text: "API トークン `" + args[1] + "` を無効化しました :wastebasket:",
+		}
+	}
+	lines := []string{}
+	for _, token := range ctx.getAPITokens() {
+		line := "• `" + token.ID + "` " + token.CreatedAt.In(ctx.getLocationForUser()).Format("2006/01/02") + " 発行"
+		if token.Name != "" {
+			line += " (" + token.Name + ")"
+		}
+		lines = append(lines, line)
+	}
+	text := "API トークンはありません"
+	if len(lines) > 0 {
+		text = "API トークン:\n" + strings.Join(lines, "\n")
+	}
+	return &slack.Msg{
+		Text: text + "\n`/ts token new [名前]` で発行、`/ts token revoke ID` で無効化できます",
+	}
+}
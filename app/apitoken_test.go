@@ -0,0 +1,74 @@
+package app
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCreateAndRevokeAPIToken(t *testing.T) {
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := app.createContext(nil)
+	ctx.UserID = "FOO"
+	ctx.now = getMockTime
+	secret, token, err := ctx.createAPIToken("T12345678", "Stream Deck")
+	for _, test := range []Test{
+		{nil, err},
+		{true, strings.HasPrefix(secret, "tsd_")},
+		{44, len(secret)},
+		{token.Digest[:8], token.ID},
+		{"Stream Deck", token.Name},
+		{"T12345678", token.TeamID},
+		{1, len(ctx.getAPITokens())},
+		{false, strings.Contains(ctx.getVariableInHash(ctx.APITokenStoreKey, "FOO"), secret)},
+	} {
+		test.Compare(t)
+	}
+
+	other := app.createContext(nil)
+	for _, test := range []Test{
+		{true, other.authenticateAPIToken("tsd_unknown") == nil},
+		{true, other.authenticateAPIToken(strings.TrimPrefix(secret, "tsd_")) == nil},
+		{token.ID, other.authenticateAPIToken(secret).ID},
+		{"FOO", other.UserID},
+	} {
+		test.Compare(t)
+	}
+
+	Test{false, ctx.revokeAPIToken("unknown")}.Compare(t)
+	Test{true, ctx.revokeAPIToken(token.ID)}.Compare(t)
+	Test{0, len(ctx.getAPITokens())}.Compare(t)
+	Test{true, app.createContext(nil).authenticateAPIToken(secret) == nil}.Compare(t)
+
+	for i := 0; i < maxAPITokens; i++ {
+		ctx.createAPIToken("T12345678", "")
+	}
+	_, _, err = ctx.createAPIToken("T12345678", "")
+	Test{errTooManyAPITokens, err}.Compare(t)
+}
+
+func TestGetAPITokenSlackMessage(t *testing.T) {
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := app.createContext(nil)
+	ctx.UserID = "FOO"
+	ctx.now = getMockTime
+	ctx.location = getMockTime().Location()
+
+	Test{"API トークンはありません\n`/ts token new [名前]` で発行、`/ts token revoke ID` で無効化できます", ctx.getAPITokenSlackMessage("T12345678", []string{}).Text}.Compare(t)
+
+	text := ctx.getAPITokenSlackMessage("T12345678", []string{"new", "Stream", "Deck"}).Text
+	tokens := ctx.getAPITokens()
+	for _, test := range []Test{
+		{1, len(tokens)},
+		{"Stream Deck", tokens[0].Name},
+		{0, strings.Index(text, "API トークン `"+tokens[0].ID+"` を発行しました :key:")},
+		{true, strings.Contains(text, "https://example.com/api/v1/timetable")},
+		{"API トークン:\n• `" + tokens[0].ID + "` 2018/09/01 発行 (Stream Deck)\n`/ts token new [名前]` で発行、`/ts token revoke ID` で無効化できます", ctx.getAPITokenSlackMessage("T12345678", nil).Text},
+		{"API トークン `foo` が見つかりません :warning:", ctx.getAPITokenSlackMessage("T12345678", []string{"revoke", "foo"}).Text},
+		{"API トークン `" + tokens[0].ID + "` を無効化しました :wastebasket:", ctx.getAPITokenSlackMessage("T12345678", []string{"revoke", tokens[0].ID}).Text},
+		{0, len(ctx.getAPITokens())},
+	} {
+		test.Compare(t)
+	}
+}
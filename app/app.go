@@ -4,30 +4,57 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/garyburd/redigo/redis"
+	gcontext "github.com/gorilla/context"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
 	apachelog "github.com/lestrrat/go-apache-logformat"
 )
 
 // App main appplication
 type App struct {
 	Port                    int
+	BaseURL                 string
 	SalesforceClientSecret  string
 	SalesforceClientID      string
 	SlackClientSecret       string
 	SlackClientID           string
 	SlackVerificationToken  string
-	StateStoreKey           string
 	SalesforceTokenStoreKey string
 	SlackTokenStoreKey      string
 	NotifyChannelStoreKey   string
+	TimeZoneStoreKey        string
+	PunchQueueStoreKey      string
+	TimeTableCacheStoreKey  string
+	TokenHealthStoreKey     string
+	APITokenStoreKey        string
+	WebhookStoreKey         string
+	PresenceStoreKey        string
+	ScheduleStoreKey        string
+	RestPolicyStoreKey      string
+	ComplianceStoreKey      string
+	CalendarStoreKey        string
+	HolidayWorkStoreKey     string
 	TeamSpiritHost          string
 	RedisConn               redis.Conn
+	RedisPool               *redis.Pool
 	TimeoutDuration         time.Duration
+	DayBoundaryHour         int
+	PunchQueueInterval      time.Duration
+	RequestTimeout          time.Duration
+	RequestRetries          int
+	TimeTableCacheTTL       time.Duration
+	TokenCheckInterval      time.Duration
+	Secret                  []byte
+	SessionStore            sessions.Store
+	webhookDeliveries       sync.WaitGroup
 }
 
 // New Returns new app
@@ -39,6 +66,22 @@ func new() (*App, error) {
 	slackClientID := os.Getenv("SLACK_CLIENT_ID")
 	slackVerificationToken := os.Getenv("SLACK_VERIFICATION_TOKEN")
 	teamSpilitHost := os.Getenv("TEAMSPIRIT_HOST")
+	// Links are never built from the Host header, which can be forged
+	baseURL := strings.TrimRight(os.Getenv("BASE_URL"), "/")
+	// Signs sessions and states, which must survive restarts and be shared by instances
+	secret := []byte(os.Getenv("SESSION_SECRET"))
+	if os.Getenv("APP_ENV") == "development" {
+		if baseURL == "" {
+			port := os.Getenv("PORT")
+			if port == "" {
+				port = "8000"
+			}
+			baseURL = "http://localhost:" + port
+		}
+		if len(secret) == 0 {
+			secret = securecookie.GenerateRandomKey(32)
+		}
+	}
 	var errVars = []string{}
 	if salesforceClientSecret == "" {
 		errVars = append(errVars, "SALESFORCE_CLIENT_SECRET")
@@ -58,14 +101,17 @@ func new() (*App, error) {
 	if teamSpilitHost == "" {
 		errVars = append(errVars, "TEAMSPIRIT_HOST")
 	}
+	if baseURL == "" {
+		errVars = append(errVars, "BASE_URL")
+	}
+	if len(secret) == 0 {
+		errVars = append(errVars, "SESSION_SECRET")
+	}
 	if len(errVars) > 0 {
 		return app, fmt.Errorf("%s are not configured", strings.Join(errVars, ", "))
 	}
-
-	if k := os.Getenv("STATE_STORE_KEY"); k != "" {
-		app.StateStoreKey = k
-	} else {
-		app.StateStoreKey = "tsdakoku:states"
+	if u, err := url.Parse(baseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return app, fmt.Errorf("BASE_URL %s is not a valid URL", baseURL)
 	}
 
 	if k := os.Getenv("OAUTH_TOKEN_STORE_KEY"); k != "" {
@@ -86,6 +132,78 @@ func new() (*App, error) {
 		app.NotifyChannelStoreKey = "tsdakoku:notify_channels"
 	}
 
+	if k := os.Getenv("TIME_ZONE_STORE_KEY"); k != "" {
+		app.TimeZoneStoreKey = k
+	} else {
+		app.TimeZoneStoreKey = "tsdakoku:time_zones"
+	}
+
+	if k := os.Getenv("PUNCH_QUEUE_STORE_KEY"); k != "" {
+		app.PunchQueueStoreKey = k
+	} else {
+		app.PunchQueueStoreKey = "tsdakoku:punch_queue"
+	}
+
+	if k := os.Getenv("TIME_TABLE_CACHE_STORE_KEY"); k != "" {
+		app.TimeTableCacheStoreKey = k
+	} else {
+		app.TimeTableCacheStoreKey = "tsdakoku:time_table_cache"
+	}
+
+	if k := os.Getenv("TOKEN_HEALTH_STORE_KEY"); k != "" {
+		app.TokenHealthStoreKey = k
+	} else {
+		app.TokenHealthStoreKey = "tsdakoku:token_health"
+	}
+
+	if k := os.Getenv("API_TOKEN_STORE_KEY"); k != "" {
+		app.APITokenStoreKey = k
+	} else {
+		app.APITokenStoreKey = "tsdakoku:api_tokens"
+	}
+
+	if k := os.Getenv("WEBHOOK_STORE_KEY"); k != "" {
+		app.WebhookStoreKey = k
+	} else {
+		app.WebhookStoreKey = "tsdakoku:webhooks"
+	}
+
+	if k := os.Getenv("PRESENCE_STORE_KEY"); k != "" {
+		app.PresenceStoreKey = k
+	} else {
+		app.PresenceStoreKey = "tsdakoku:presence"
+	}
+
+	if k := os.Getenv("SCHEDULE_STORE_KEY"); k != "" {
+		app.ScheduleStoreKey = k
+	} else {
+		app.ScheduleStoreKey = "tsdakoku:schedules"
+	}
+
+	if k := os.Getenv("REST_POLICY_STORE_KEY"); k != "" {
+		app.RestPolicyStoreKey = k
+	} else {
+		app.RestPolicyStoreKey = "tsdakoku:rest_policies"
+	}
+
+	if k := os.Getenv("COMPLIANCE_STORE_KEY"); k != "" {
+		app.ComplianceStoreKey = k
+	} else {
+		app.ComplianceStoreKey = "tsdakoku:compliance"
+	}
+
+	if k := os.Getenv("CALENDAR_STORE_KEY"); k != "" {
+		app.CalendarStoreKey = k
+	} else {
+		app.CalendarStoreKey = "tsdakoku:calendars"
+	}
+
+	if k := os.Getenv("HOLIDAY_WORK_STORE_KEY"); k != "" {
+		app.HolidayWorkStoreKey = k
+	} else {
+		app.HolidayWorkStoreKey = "tsdakoku:holiday_work"
+	}
+
 	duration, _ := strconv.Atoi(os.Getenv("SALESFORCE_TIMEOUT_MINUTES"))
 	if duration > 0 {
 		app.TimeoutDuration = time.Duration(duration) * time.Minute
@@ -93,12 +211,55 @@ func new() (*App, error) {
 		app.TimeoutDuration = time.Hour
 	}
 
+	interval, _ := strconv.Atoi(os.Getenv("PUNCH_QUEUE_INTERVAL_SECONDS"))
+	if interval > 0 {
+		app.PunchQueueInterval = time.Duration(interval) * time.Second
+	} else {
+		app.PunchQueueInterval = time.Minute
+	}
+
+	checkInterval, _ := strconv.Atoi(os.Getenv("TOKEN_CHECK_INTERVAL_MINUTES"))
+	if checkInterval > 0 {
+		app.TokenCheckInterval = time.Duration(checkInterval) * time.Minute
+	} else {
+		app.TokenCheckInterval = time.Hour
+	}
+
+	timeout, _ := strconv.Atoi(os.Getenv("TEAMSPIRIT_TIMEOUT_SECONDS"))
+	if timeout > 0 {
+		app.RequestTimeout = time.Duration(timeout) * time.Second
+	} else {
+		app.RequestTimeout = 10 * time.Second
+	}
+
+	if retries, err := strconv.Atoi(os.Getenv("TEAMSPIRIT_RETRIES")); err == nil && retries >= 0 {
+		app.RequestRetries = retries
+	} else {
+		app.RequestRetries = 2
+	}
+
+	if ttl, err := strconv.Atoi(os.Getenv("TIME_TABLE_CACHE_SECONDS")); err == nil && ttl >= 0 {
+		app.TimeTableCacheTTL = time.Duration(ttl) * time.Second
+	} else {
+		app.TimeTableCacheTTL = 30 * time.Second
+	}
+
+	if hour, err := strconv.Atoi(os.Getenv("DAY_BOUNDARY_HOUR")); err == nil && hour >= 0 && hour < 24 {
+		app.DayBoundaryHour = hour
+	} else {
+		app.DayBoundaryHour = 5
+	}
+
+	app.Secret = secret
+	app.SessionStore = sessions.NewCookieStore(secret)
+
 	app.SalesforceClientID = salesforceClientID
 	app.SalesforceClientSecret = salesforceClientSecret
 	app.SlackClientID = slackClientID
 	app.SlackClientSecret = slackClientSecret
 	app.SlackVerificationToken = slackVerificationToken
 	app.TeamSpiritHost = teamSpilitHost
+	app.BaseURL = baseURL
 	if err := app.setupRedis(); err != nil {
 		return app, err
 	}
@@ -117,7 +278,10 @@ func Run() (*App, error) {
 	}
 	app.Port = port
 	router := app.setupRouter()
+	go app.runPunchQueueWorker()
+	go app.runTokenHealthWorker()
+	go app.runScheduleWorker()
 	fmt.Println("Listeninng on 0.0.0.0:" + strconv.Itoa(port))
-	log.Fatal(http.ListenAndServe(":"+strconv.Itoa(port), apachelog.CombinedLog.Wrap(router, os.Stderr)))
+	log.Fatal(http.ListenAndServe(":"+strconv.Itoa(port), apachelog.CombinedLog.Wrap(gcontext.ClearHandler(router), os.Stderr)))
 	return app, nil
 }
@@ -5,30 +5,65 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"golang.org/x/oauth2"
 )
 
 func (app *App) CleanRedis() {
 	app.RedisConn.Do("DEL", app.SalesforceTokenStoreKey)
-	app.RedisConn.Do("DEL", app.StateStoreKey)
 	app.RedisConn.Do("DEL", app.SlackTokenStoreKey)
 	app.RedisConn.Do("DEL", app.NotifyChannelStoreKey)
+	app.RedisConn.Do("DEL", app.TimeZoneStoreKey)
+	app.RedisConn.Do("DEL", app.TimeZoneStoreKey+":slack")
+	app.RedisConn.Do("DEL", app.PunchQueueStoreKey)
+	app.RedisConn.Do("DEL", app.PunchQueueStoreKey+":lock:FOO")
+	app.RedisConn.Do("DEL", app.TokenHealthStoreKey+":lock:FOO")
+	app.RedisConn.Do("DEL", app.ScheduleStoreKey+":lock:FOO")
+	app.RedisConn.Do("DEL", app.TimeTableCacheStoreKey)
+	app.RedisConn.Do("DEL", app.TokenHealthStoreKey)
+	app.RedisConn.Do("DEL", app.APITokenStoreKey)
+	app.RedisConn.Do("DEL", app.APITokenStoreKey+":digests")
+	app.RedisConn.Do("DEL", app.WebhookStoreKey)
+	app.RedisConn.Do("DEL", app.WebhookStoreKey+":deliveries:T12345678")
+	app.RedisConn.Do("DEL", app.PresenceStoreKey)
+	app.RedisConn.Do("DEL", app.PresenceStoreKey+":tokens")
+	app.RedisConn.Do("DEL", app.ScheduleStoreKey)
+	app.RedisConn.Do("DEL", app.RestPolicyStoreKey)
+	app.RedisConn.Do("DEL", app.ComplianceStoreKey)
+	app.RedisConn.Do("DEL", app.CalendarStoreKey)
+	app.RedisConn.Do("DEL", app.HolidayWorkStoreKey)
 }
 
 func createMockApp() *App {
-	os.Setenv("STATE_STORE_KEY", "tsdakoku-test:states")
+	os.Setenv("SESSION_SECRET", "SESSION_SECRET is set!")
 	os.Setenv("OAUTH_TOKEN_STORE_KEY", "tsdakoku-test:oauth_tokens")
+	os.Setenv("DAY_BOUNDARY_HOUR", "0")
+	os.Setenv("TIME_TABLE_CACHE_SECONDS", "0")
 	for _, name := range []string{
 		"SALESFORCE_CLIENT_SECRET",
 		"SALESFORCE_CLIENT_ID",
+		"SLACK_CLIENT_SECRET",
+		"SLACK_CLIENT_ID",
 		"SLACK_VERIFICATION_TOKEN",
 	} {
 		os.Setenv(name, name+" is set!")
 	}
 	os.Setenv("TEAMSPIRIT_HOST", "teamspirit-1234.cloudforce.test")
+	os.Setenv("BASE_URL", "https://example.com")
 	app, _ := new()
 	return app
 }
 
+// createTestContext returns the context of the user FOO at the mock time, authenticated with Salesforce
+func createTestContext(app *App) *Context {
+	ctx := app.createContext(nil)
+	ctx.UserID = "FOO"
+	ctx.now = getMockTime
+	ctx.location = getMockTime().Location()
+	ctx.setSalesforceAccessToken(&oauth2.Token{AccessToken: "foo", RefreshToken: "bar", TokenType: "Bearer"})
+	return ctx
+}
+
 func TestNewApp(t *testing.T) {
 	for _, name := range []string{
 		"SALESFORCE_CLIENT_SECRET",
@@ -38,14 +73,18 @@ func TestNewApp(t *testing.T) {
 		"SLACK_VERIFICATION_TOKEN",
 		"TEAMSPIRIT_HOST",
 		"OAUTH_TOKEN_STORE_KEY",
-		"STATE_STORE_KEY",
+		"DAY_BOUNDARY_HOUR",
+		"TIME_TABLE_CACHE_SECONDS",
+		"BASE_URL",
+		"SESSION_SECRET",
+		"APP_ENV",
 	} {
 		os.Setenv(name, "")
 	}
 	app, err := new()
 	for _, test := range []Test{
 		{false, app == nil},
-		{"SALESFORCE_CLIENT_SECRET, SALESFORCE_CLIENT_ID, SLACK_CLIENT_SECRET, SLACK_CLIENT_ID, SLACK_VERIFICATION_TOKEN, TEAMSPIRIT_HOST are not configured", err.Error()},
+		{"SALESFORCE_CLIENT_SECRET, SALESFORCE_CLIENT_ID, SLACK_CLIENT_SECRET, SLACK_CLIENT_ID, SLACK_VERIFICATION_TOKEN, TEAMSPIRIT_HOST, BASE_URL, SESSION_SECRET are not configured", err.Error()},
 	} {
 		test.Compare(t)
 	}
@@ -59,38 +98,77 @@ func TestNewApp(t *testing.T) {
 	} {
 		os.Setenv(name, "ok")
 	}
+	os.Setenv("APP_ENV", "development")
+	app, err = new()
+	for _, test := range []Test{
+		{true, err == nil},
+		{"http://localhost:8000", app.BaseURL},
+		{32, len(app.Secret)},
+	} {
+		test.Compare(t)
+	}
+	os.Setenv("APP_ENV", "")
+	os.Setenv("SESSION_SECRET", "ok")
+	os.Setenv("BASE_URL", "ts-dakoku.example.com")
+	app, err = new()
+	Test{"BASE_URL ts-dakoku.example.com is not a valid URL", err.Error()}.Compare(t)
+	os.Setenv("BASE_URL", "https://ts-dakoku.example.com/")
 	app, err = new()
 	for _, test := range []Test{
 		{false, app == nil},
 		{true, err == nil},
-		{"tsdakoku:states", app.StateStoreKey},
+		{"https://ts-dakoku.example.com", app.BaseURL},
+		{"ok", string(app.Secret)},
 		{"tsdakoku:oauth_tokens", app.SalesforceTokenStoreKey},
 		{time.Hour, app.TimeoutDuration},
+		{5, app.DayBoundaryHour},
+		{10 * time.Second, app.RequestTimeout},
+		{2, app.RequestRetries},
+		{"tsdakoku:time_table_cache", app.TimeTableCacheStoreKey},
+		{30 * time.Second, app.TimeTableCacheTTL},
+		{"tsdakoku:token_health", app.TokenHealthStoreKey},
+		{"tsdakoku:api_tokens", app.APITokenStoreKey},
+		{"tsdakoku:webhooks", app.WebhookStoreKey},
+		{"tsdakoku:presence", app.PresenceStoreKey},
+		{"tsdakoku:schedules", app.ScheduleStoreKey},
+		{"tsdakoku:rest_policies", app.RestPolicyStoreKey},
+		{"tsdakoku:compliance", app.ComplianceStoreKey},
+		{"tsdakoku:calendars", app.CalendarStoreKey},
+		{"tsdakoku:holiday_work", app.HolidayWorkStoreKey},
+		{time.Hour, app.TokenCheckInterval},
 	} {
 		test.Compare(t)
 	}
-	os.Setenv("STATE_STORE_KEY", "tsdakoku-test:states")
 	os.Setenv("OAUTH_TOKEN_STORE_KEY", "tsdakoku-test:oauth_tokens")
 	os.Setenv("SLACK_TOKEN_STORE_KEY", "tsdakoku-test:slack_tokens")
 	os.Setenv("SLACK_NOTIFY_CHANNEL_STORE_KEY", "tsdakoku-test:notify_channels")
 	os.Setenv("SALESFORCE_TIMEOUT_MINUTES", "20")
+	os.Setenv("DAY_BOUNDARY_HOUR", "3")
+	os.Setenv("TEAMSPIRIT_TIMEOUT_SECONDS", "5")
+	os.Setenv("TEAMSPIRIT_RETRIES", "0")
+	os.Setenv("TIME_TABLE_CACHE_SECONDS", "0")
 	app, err = new()
 	for _, test := range []Test{
 		{false, app == nil},
 		{true, err == nil},
-		{"tsdakoku-test:states", app.StateStoreKey},
 		{"tsdakoku-test:oauth_tokens", app.SalesforceTokenStoreKey},
 		{"tsdakoku-test:slack_tokens", app.SlackTokenStoreKey},
 		{"tsdakoku-test:notify_channels", app.NotifyChannelStoreKey},
 		{20 * time.Minute, app.TimeoutDuration},
+		{3, app.DayBoundaryHour},
+		{5 * time.Second, app.RequestTimeout},
+		{0, app.RequestRetries},
+		{time.Duration(0), app.TimeTableCacheTTL},
 	} {
 		test.Compare(t)
 	}
 	os.Setenv("SALESFORCE_TIMEOUT_MINUTES", "100hoge")
+	os.Setenv("DAY_BOUNDARY_HOUR", "24")
 
 	app, err = new()
 	for _, test := range []Test{
 		{time.Hour, app.TimeoutDuration},
+		{5, app.DayBoundaryHour},
 	} {
 		test.Compare(t)
 	}
@@ -0,0 +1,105 @@
+package app
+
+import "time"
+
+type attendanceState int
+
+const (
+	attendanceStateNotStarted attendanceState = iota
+	attendanceStateWorking
+	attendanceStateResting
+	attendanceStateLeft
+	attendanceStateHoliday
+)
+
+type attendanceTransition struct {
+	From   attendanceState
+	Action string
+	To     attendanceState
+}
+
+var attendanceTransitions = []attendanceTransition{
+	{attendanceStateNotStarted, actionTypeAttend, attendanceStateWorking},
+	{attendanceStateWorking, actionTypeRest, attendanceStateResting},
+	{attendanceStateWorking, actionTypeLeave, attendanceStateLeft},
+	{attendanceStateResting, actionTypeUnrest, attendanceStateWorking},
+}
+
+func (state attendanceState) String() string {
+	switch state {
+	case attendanceStateWorking:
+		return "勤務中"
+	case attendanceStateResting:
+		return "休憩中"
+	case attendanceStateLeft:
+		return "退勤済"
+	case attendanceStateHoliday:
+		return "休日"
+	}
+	return "未出勤"
+}
+
+// AllowedActions returns actions which can be performed in the state
+func (state attendanceState) AllowedActions() []string {
+	actions := []string{}
+	for _, transition := range attendanceTransitions {
+		if transition.From == state {
+			actions = append(actions, transition.Action)
+		}
+	}
+	return actions
+}
+
+// Next returns the state after the action, and false if the action is not allowed
+func (state attendanceState) Next(action string) (attendanceState, bool) {
+	for _, transition := range attendanceTransitions {
+		if transition.From == state && transition.Action == action {
+			return transition.To, true
+		}
+	}
+	return state, false
+}
+
+// Can reports whether the action is allowed in the state
+func (state attendanceState) Can(action string) bool {
+	_, ok := state.Next(action)
+	return ok
+}
+
+func (tt *timeTable) State() attendanceState {
+	if tt.IsLeaving() {
+		return attendanceStateLeft
+	}
+	// Punching is allowed on the holiday once the user started working on it
+	if tt.IsHoliday != nil && *tt.IsHoliday && !tt.IsAttending() {
+		return attendanceStateHoliday
+	}
+	if tt.IsResting() {
+		return attendanceStateResting
+	}
+	if tt.IsAttending() {
+		return attendanceStateWorking
+	}
+	return attendanceStateNotStarted
+}
+
+// Apply applies the action at the time to the time table if the transition is allowed
+func (tt *timeTable) Apply(action string, t time.Time) error {
+	state := tt.State()
+	if !state.Can(action) {
+		return &timeTableValidationError{"現在は" + state.String() + "のため、その操作はできません"}
+	}
+	switch action {
+	case actionTypeAttend:
+		tt.Attend(t)
+	case actionTypeRest:
+		tt.Rest(t)
+	case actionTypeUnrest:
+		if !tt.Unrest(t) {
+			return &timeTableValidationError{"開始されていない休憩は終了できません"}
+		}
+	case actionTypeLeave:
+		tt.Leave(t)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package app
+
+import (
+	"testing"
+
+	null "gopkg.in/guregu/null.v3"
+)
+
+func TestTimeTableState(t *testing.T) {
+	holiday := true
+	for _, test := range []Test{
+		{attendanceStateNotStarted, (&timeTable{}).State()},
+		{attendanceStateNotStarted, (&timeTable{Items: []timeTableItem{
+			newAttendanceItem(null.Int{}, null.Int{}),
+		}}).State()},
+		{attendanceStateWorking, (&timeTable{Items: []timeTableItem{
+			newAttendanceItem(null.IntFrom(600), null.Int{}),
+			newRestItem(null.IntFrom(720), null.IntFrom(780)),
+		}}).State()},
+		{attendanceStateResting, (&timeTable{Items: []timeTableItem{
+			newAttendanceItem(null.IntFrom(600), null.Int{}),
+			newRestItem(null.IntFrom(720), null.Int{}),
+		}}).State()},
+		{attendanceStateLeft, (&timeTable{Items: []timeTableItem{
+			newAttendanceItem(null.IntFrom(600), null.IntFrom(1140)),
+		}}).State()},
+		{attendanceStateHoliday, (&timeTable{IsHoliday: &holiday}).State()},
+		{attendanceStateHoliday, (&timeTable{IsHoliday: &holiday, HolidayWork: "リリース対応"}).State()},
+		{attendanceStateWorking, (&timeTable{IsHoliday: &holiday, Items: []timeTableItem{
+			newAttendanceItem(null.IntFrom(600), null.Int{}),
+		}}).State()},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestAttendanceStateTransitions(t *testing.T) {
+	for _, test := range []Test{
+		{[]string{actionTypeAttend}, attendanceStateNotStarted.AllowedActions()},
+		{[]string{actionTypeRest, actionTypeLeave}, attendanceStateWorking.AllowedActions()},
+		{[]string{actionTypeUnrest}, attendanceStateResting.AllowedActions()},
+		{[]string{}, attendanceStateLeft.AllowedActions()},
+		{[]string{}, attendanceStateHoliday.AllowedActions()},
+	} {
+		test.DeepEqual(t)
+	}
+	next, ok := attendanceStateWorking.Next(actionTypeRest)
+	for _, test := range []Test{
+		{attendanceStateResting, next},
+		{true, ok},
+		{true, attendanceStateResting.Can(actionTypeUnrest)},
+		{false, attendanceStateResting.Can(actionTypeLeave)},
+		{false, attendanceStateLeft.Can(actionTypeAttend)},
+		{false, attendanceStateNotStarted.Can(actionTypeRest)},
+		{"休憩中", attendanceStateResting.String()},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestTimeTableApply(t *testing.T) {
+	tt := timeTable{}
+	for _, test := range []Test{
+		{nil, tt.Apply(actionTypeAttend, getMockTime())},
+		{attendanceStateWorking, tt.State()},
+		{nil, tt.Apply(actionTypeRest, getMockTime())},
+		{attendanceStateResting, tt.State()},
+		{"現在は休憩中のため、その操作はできません", tt.Apply(actionTypeLeave, getMockTime()).Error()},
+		{nil, tt.Apply(actionTypeUnrest, getMockTime())},
+		{nil, tt.Apply(actionTypeLeave, getMockTime())},
+		{attendanceStateLeft, tt.State()},
+	} {
+		test.Compare(t)
+	}
+}
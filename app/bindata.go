@@ -1,5 +1,7 @@
 // Code generated by go-bindata.
 // sources:
+// assets/dashboard.html
+// assets/error.html
 // assets/favicon.ico
 // assets/index.html
 // assets/success.html
@@ -70,6 +72,46 @@ func (fi bindataFileInfo) Sys() interface{} {
 	return nil
 }
 
+var _assetsDashboardHtml = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x02\xff\xbd\x58\xed\x6f\xd3\x46\x18\xff\xbe\xbf\xe2\x64\x4d\x02\x24\x1c\x97\xc2\xc4\x84\x92\x48\x88\x81\x84\x84\xf8\x40\xcb\x97\x7d\x41\x17\xfb\x12\xdf\x6a\xfb\x2c\xdf\xb9\x69\x17\x55\x6a\x12\xc6\xca\x0a\x62\xda\xb4\xb1\xb2\x4e\xbc\x16\x2a\x18\xdd\x07\xc6\x36\x31\x04\x7f\xcc\x91\xb4\xfc\x17\x7b\xee\x1c\x3b\x76\x9a\xb6\xb0\x75\x54\x6a\x92\x7b\xf2\xdc\xf3\xfa\x7b\x5e\x9c\xb2\x2b\x7c\xaf\xfa\x11\x42\x65\x97\x60\x47\x7d\x80\x8f\x3e\x11\x18\xd9\x2e\x8e\x38\x11\x15\x23\x16\x75\xf3\x53\x23\xff\x55\x80\x7d\x52\x31\x22\x56\x63\x82\x1b\xc8\x66\x81\x20\x01\x30\x06\x8c\x06\x0e\x99\x3b\x8c\x02\x56\x67\x9e\xc7\x9a\x63\x2e\xcd\x52\xd2\x0c\x59\x24\x72\xd7\x9a\xd4\x11\x6e\xc5\x21\xb3\xd4\x26\xa6\x3e\x1c\x46\x34\xa0\x82\x62\xcf\xe4\x36\xf6\x48\xe5\x48\x2a\x48\x50\xe1\x91\xaa\xec\x2e\xca\x6e\x57\x76\xfe\x94\xdd\x35\xd9\x5d\x95\xdd\x97\xb2\x7b\x15\x99\x48\x70\xd3\xc1\x33\x6c\x26\x2e\x5b\x09\x63\x72\xc9\xa3\xc1\x0c\x8a\x88\x57\x31\xb8\x98\xf7\x08\x77\x09\x01\xf5\x6e\x44\xea\x15\xc3\x15\x22\xe4\x27\x2c\xcb\xc7\x73\xb6\x13\x94\x6a\x0c\x3c\x12\x11\x0e\xd5\xc1\x66\xbe\x55\x07\x23\x4d\xdc\x24\x9c\xf9\xc4\x3a\x56\x3a\x5e\x9a\xb0\x6c\xce\x0b\xe4\x92\x4f\x81\x97\x43\x20\xc4\x7c\x08\x1e\x0a\x32\x27\x14\x93\xb1\x0f\xea\x33\x02\xe8\x9e\x18\xe8\xce\x68\xbb\x2a\x2e\x5b\x69\x3e\xcb\x35\xe6\xcc\x0f\x6c\x71\xe8\x2c\xb2\x3d\xcc\x79\xc5\x50\xe1\xc7\x34\x20\x11\x0a\xcd\xa3\x06\xd2\xb6\x55\x0c\x30\x24\x49\xc1\x89\xe3\x93\x13\xe1\xdc\xc0\x07\x85\x8e\x23\xe9\x45\xf7\x28\xf2\x6b\xe6\x31\xa3\x9a\x0b\xb7\x7b\x24\x65\x6c\xb5\x68\x1d\xf2\x2f\x50\xe9\x22\x27\xd1\xd9\xcf\x16\x16\x52\x09\x39\xdd\xca\x52\xd3\x86\xe4\x93\x28\xd3\x00\x1c\x61\xfa\xbd\x07\xa6\x1b\xd5\x29\x0f\xdb\x33\x48\xb6\x37\x64\xe7\x9e\xec\x3c\x91\x9d\x87\xb2\xfb\x4c\x76\x97\x64\xfb\x91\xec\x3c\x97\x9d\x07\xea\x98\xbc\xb6\x6f\xca\xf6\x43\xd9\xbe\x21\xdb\x77\x64\xfb\x07\xd9\xbe\x5c\xb6\xc2\x9c\x60\x3c\x08\xb7\xe5\xb1\x06\x0d\x8c\x54\x4d\x4d\x04\x08\xfe\x4d\xaf\xa1\xdf\xc2\x88\xfa\x38\x9a\x37\xaa\x65\x9a\x72\xd4\x31\xaa\x63\x93\x2b\x43\x80\x6c\xd1\x2a\x9a\xa2\x8d\x00\xd0\x89\x9a\x54\xb8\x48\x5b\x58\xb6\x70\x16\x25\x0b\x9c\x1c\x46\x82\x78\x9c\x64\xfe\xb7\x5a\x11\x0e\x1a\x04\x95\xce\x80\x68\x97\xf0\xb1\x81\x01\xb0\x47\x02\xe9\x57\x93\x06\x75\x66\x54\x5b\xad\xd2\xc2\xc2\xa8\xdc\xc0\xc9\x89\x85\x78\x97\x4e\x47\x11\x8b\xf6\x94\xd8\xc4\x51\x40\x83\x86\x16\x3a\xb8\x31\x56\x72\x2a\x86\x13\x5b\x50\x16\xa4\xa2\x92\xac\x0f\xa3\xea\x4e\x66\x90\xf8\xc4\xa8\xf6\x57\x7f\xed\xdf\x5c\x83\x6c\xf5\x96\x1f\xf4\x96\x57\xb6\xee\xae\x83\x00\x1f\x7b\x5e\x21\xe9\x7e\x2c\x88\xa3\x0d\x38\xcf\x9a\x4a\xbd\x66\x81\xd0\xba\x93\x43\xc9\x89\x4f\x53\x02\x8b\x61\xf8\x14\x3c\xaa\x9b\x37\x5e\xf5\x56\xd7\x41\xc7\xe6\x37\x7f\xf4\xbf\x5a\x3e\x01\x1a\x44\xc4\x82\x86\x92\x37\x60\x07\x89\x09\xa9\x80\x80\x62\xcc\x52\x0d\x67\x05\xf1\x79\x5e\x83\xc0\x35\x8f\x64\xf6\xea\x83\x7e\x35\xb9\x9f\x73\x5c\x31\xea\xe2\x2a\x8b\x08\xfe\xdd\xea\xe6\xfa\x46\x6f\x69\x0d\x9a\x8e\xab\x8f\x6f\x7f\x5c\xee\x3d\x5a\xce\x8e\x9b\xcf\x3b\x6f\x5e\x5c\x49\x8e\x96\xba\x61\x89\x61\xab\x4d\xe5\x0d\x6b\x74\x68\xe2\x00\x2f\xa3\x56\x26\x17\x94\x66\x47\xf9\x7d\x0e\xd7\x88\xa7\xfc\x16\x4e\x4a\x3a\x13\x31\xbf\x48\x99\x66\xe9\x59\x59\x30\xa2\xa7\x18\x1a\x85\xe2\x11\x73\x80\xa0\xa2\xb0\x5b\x38\x07\xb6\x9e\xd4\x80\x29\xc4\xb4\xce\x22\x1f\xc1\x00\x70\x99\x53\x31\x42\xc6\xa1\xf7\x61\xcd\x05\xe5\xe8\x40\x25\xd4\x18\x8e\x1c\x2b\x8c\x03\xdb\xcd\x0a\xd3\x01\xf0\x43\xdb\x24\x46\x92\xa7\x53\x2c\xa8\xd3\x08\x5c\x42\x20\x3b\xae\xf9\x14\x86\x46\x44\x44\x1c\x05\x6a\x88\xa8\xaf\x0e\x1e\x00\x27\x33\xb6\x03\x87\x8c\x81\x85\x85\x20\xd3\x20\x8c\xc5\xa0\x57\xba\xd4\x71\x08\x74\x82\x64\x28\xd9\x3c\xaa\x5f\x12\x6c\x46\x51\x66\xb1\x17\x03\xa9\xd5\xfa\xb8\x74\x6a\xea\xc2\x99\x69\x45\x5d\x58\x30\xde\x51\x52\xe2\x5a\x4e\x4a\xe9\x3c\xd0\x47\xef\xd7\x62\x21\xa0\xae\x12\x01\x89\x47\x85\xa6\xa4\x9c\x51\x27\x75\x4f\x65\x0f\x2a\x47\xe5\x2f\xb9\x96\xcf\x8b\x0a\xee\x4e\x69\x81\x4a\x48\xea\xb7\xfa\xef\x0a\x7a\xa4\xeb\xbe\x5d\xbc\xdf\xff\xf6\x45\xb1\x50\xcb\x71\x56\xdd\x1e\xe5\xc2\x6c\x44\x2c\x0e\x8b\xae\x7a\x74\x3b\x87\x49\x01\xd2\xc8\x31\xeb\x1e\x99\x43\x5f\xc4\x5c\xd0\xfa\xbc\x39\x58\x07\xcc\x1a\x11\x4d\x42\x02\x68\x59\xd0\x69\x35\x27\xdf\x3e\x2a\xd4\xdf\x34\xc1\xfe\x54\x48\x23\x2a\x46\xf0\xac\x9b\x07\x74\x3c\x0e\xd1\xb1\xc9\xe9\x39\xe0\x21\xce\x68\x01\xa5\x23\x41\x75\x8e\x8c\xf7\x64\x0c\xa5\x19\x08\x6a\x43\x2b\xb9\x78\xe1\x1c\x84\x7f\x74\x54\x70\x5f\xbf\x65\x9d\x74\xeb\xf1\xf5\xad\xf5\x97\xb2\x7d\xad\xb7\xf4\xb5\xec\x5c\xd3\x53\xe8\xb2\x6c\xbf\x92\xed\x15\xb9\xd8\xe9\x5d\xb9\x9e\x32\xac\xc8\xce\x72\x6e\x52\xe4\x47\x04\x2a\x1a\x7c\x0e\xf6\x85\xed\xf6\xf2\x10\x67\x79\xab\x61\x07\x8a\x4d\xbf\x9a\x3c\xb6\x6d\xa2\x66\x7e\x92\x9f\xfe\x5f\x4b\x90\x77\xe0\x1d\xa7\x68\x7f\x63\x90\x8d\xcb\xbd\x5c\xdc\xd6\x5e\x3c\xfa\x81\x20\x92\x6c\x10\x07\xfb\x57\xbf\xef\x2d\xfd\x0d\x63\xe3\xed\xe2\xad\xcd\xdb\x6b\x87\xc6\xe1\x45\x71\x7e\xb8\xc8\xef\x28\x93\x80\x8f\x8e\x8e\x6a\x7f\xf5\x71\x5a\x72\x63\xa5\xee\x1a\xd5\xb2\x15\x7b\xd5\x7d\xea\x03\x49\xd0\xb6\xd6\x9f\xf6\x36\x6e\x8d\x94\xff\xbb\xf5\x76\x78\x88\x10\x50\x2c\xdc\xf8\x2f\xdd\x78\xe7\x66\x9c\x5b\x76\x94\x3d\x63\x9a\x90\xc2\x98\x9a\x92\xd5\x04\x08\xfd\x95\x8e\x6c\x3f\x49\xdc\x4a\x50\x2b\xbb\x6d\xd9\xbd\x2f\xbb\xd7\x65\xf7\x09\x04\x52\xf3\x16\xef\x87\x05\x15\x0a\x88\x11\xf3\xcc\xd0\x83\x0d\x5a\xed\x35\xaa\x4d\x2b\x18\x9d\x67\x0a\xa8\xa7\x5c\x1c\x04\x6a\x28\xeb\x35\x67\x84\x92\xc0\x21\xd5\x0e\x7b\xeb\x63\xe8\x18\x83\x7c\x16\x76\x96\x21\x38\x47\x64\x14\x2d\x1b\x3b\x4b\x92\x40\x06\xfa\xde\x25\x3b\xb9\x98\x05\x73\xa7\x82\x66\xb1\x50\x43\x17\x96\x7a\x98\xe5\x51\x9a\x78\xd9\xf9\xae\xff\x14\x26\x41\x5b\x57\xf7\xe8\x08\x4a\xe0\x94\x5f\xf3\x74\x80\x54\x4c\x50\x7e\xe1\xcb\x47\x58\xed\x88\x0f\xae\xf6\x7f\xfe\x5d\xb6\x7f\x43\xe9\x92\xff\x08\x95\x6d\xe6\x90\xaa\x25\x38\x1a\x18\x5c\xb6\x34\x05\x81\x05\xbd\x8d\xdb\x5b\x77\xaf\x8d\x5b\xf3\x93\xfd\x71\xcf\xe2\xc8\x6d\xb9\xdb\xe7\xe6\xfb\xe2\xb8\xe0\xea\x60\x53\xf9\x7f\xb0\xad\xa1\x98\x95\x69\x64\x4e\x1a\x08\x94\xc2\x6e\x4a\x7d\x72\xe9\x4b\xa6\xf4\xca\xce\x6b\xfd\x10\x74\x47\x76\x5e\xe9\x27\xe1\x67\x63\x10\x5c\xb0\x48\x03\x76\x1c\x9e\x51\x01\xdc\x80\x8a\x44\x23\x75\xf2\x0a\x07\x8e\xe4\x08\x43\x3f\xa6\x81\xf8\x39\xd0\xd4\xd0\x80\xda\xb0\x89\xcb\x3c\x87\x80\xbd\x27\x39\xc5\x16\x78\x38\xcf\xde\x6f\x11\xca\xa1\x33\xd7\x1a\xdf\xbc\xfe\xa5\xf7\xf4\xa7\xbd\xf6\xa1\x31\x7d\x6f\xb7\x3c\xc3\xa3\x21\x14\x40\xbe\x0d\xee\x4f\x16\xdf\xc9\x47\xfd\x1b\x41\x68\x4e\xa8\x74\x66\x4f\xb6\xf7\xf4\xee\xb5\x34\xea\x67\xd1\xcb\x3c\xd8\x33\x98\xc3\x15\xbd\xc0\x43\xbb\xd6\xbf\xee\xfc\x03\x2a\x74\x99\xc3\xe5\x11\x00\x00")
+
+func assetsDashboardHtmlBytes() ([]byte, error) {
+	return bindataRead(
+		_assetsDashboardHtml,
+		"assets/dashboard.html",
+	)
+}
+
+func assetsDashboardHtml() (*asset, error) {
+	bytes, err := assetsDashboardHtmlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "assets/dashboard.html", size: 4581, mode: os.FileMode(420), modTime: time.Unix(1792411916, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var _assetsErrorHtml = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x02\xff\xad\x53\xcb\x6e\x13\x31\x14\xdd\xf7\x2b\xac\x61\x8b\xe3\x44\x29\x02\xaa\x49\x7e\x82\x2f\x70\x3c\x9e\x8c\x15\x8f\x3d\xb2\x9d\x76\xb2\xab\x13\x04\x85\xb4\x02\x21\x51\x54\xa9\x52\x60\x41\x52\x58\x74\x89\x04\xea\xdf\x58\x53\xa5\x7f\x81\x9d\x74\x42\x52\x21\x56\xec\xee\xe3\xcc\x39\xe7\xfa\xde\x89\x33\x93\xf3\xee\x1e\x00\x71\x46\x71\x12\x02\x1f\xe6\xd4\x60\x40\x32\xac\x34\x35\x9d\x68\x68\x52\xf8\x2c\xda\x6e\x09\x9c\xd3\x4e\xa4\x64\x4f\x1a\x1d\x01\x22\x85\xa1\xc2\x03\x85\x64\x22\xa1\xe5\x63\x20\x64\x2a\x39\x97\x47\xf5\x47\x86\x19\x4e\xbb\xcb\xef\x67\xcb\xab\x1b\x37\xbe\x72\x93\x6f\x6e\x72\x03\x20\x30\x1a\x26\x78\x20\x07\xc3\x18\xad\x21\x6b\x38\x67\x62\x00\x14\xe5\x9d\x48\x9b\x11\xa7\x3a\xa3\xd4\x44\x20\x53\x34\xed\x44\x99\x31\x85\x3e\x40\x28\xc7\x25\x49\x44\xa3\x27\xbd\x05\xa3\x70\x11\x12\x22\x73\x94\x7a\x33\x10\x1f\x51\x2d\x73\x8a\xf6\x1b\x4f\x1b\x4d\x44\xb4\xde\x29\x37\x72\xe6\xb1\xda\x3b\x37\xa3\xc2\xcf\x61\x68\x69\x02\x28\xfa\x0f\xf2\x9b\x82\xd7\x6e\xde\x6b\x6f\x6a\xff\x14\x8e\x51\xbd\x80\xb8\x27\x93\x11\x20\x1c\x6b\xbd\xc6\x40\xe2\x9f\x97\xaa\xda\x5f\xc2\x0e\xeb\x2e\x91\x87\x54\xc1\xb0\x00\xcc\x04\x55\x20\x81\x29\xa7\x25\xc8\x60\xab\xd9\x04\x05\x6c\x83\xbc\x84\x78\x68\x24\x08\x65\x8f\xe3\xc3\x5c\x00\xcc\x59\x5f\xc0\x9c\x25\x09\xa7\xf7\x9c\x61\xb1\x9e\x01\x28\xc9\xbd\xaf\x10\x46\xb5\x04\x13\x81\x78\x25\xb4\x01\x87\x6b\x69\xed\x7a\x08\xe6\x99\xe8\x6f\x41\x3c\x88\xd5\x98\x14\x83\x14\x43\x5a\xfa\x34\xc7\x86\x49\x01\x09\x53\x84\xd3\x50\x6d\x97\x11\x58\x3d\x74\xa0\xe2\x52\x1d\x3c\x4a\x9e\x3f\x69\xef\xa7\x51\x37\x46\x6c\x87\xae\xa7\xb6\xd3\x07\xe7\xf4\xc7\x1a\xca\x5a\x5b\x46\x8b\xda\x03\xf7\x0e\xa3\xbf\x10\xd8\xeb\xdb\xcb\x37\xd5\xdb\x9f\xb7\x97\xb3\xbb\x8b\xf7\xce\x9e\x56\x27\xaf\xdd\xf8\xd4\xd9\x99\xb3\x53\x77\x6c\xab\x93\xaf\x1e\xe3\x26\xe7\x41\x67\x3c\x77\xe3\x1f\xce\x2e\xee\xce\xa7\xd5\x62\xea\xec\xc7\x35\xb2\xa6\x5a\x38\x7b\xe1\x8e\xc7\x0f\x9c\xbe\xe0\x98\x0c\x80\xef\x56\xaf\xce\xaa\x5f\x73\x10\x13\x99\xd0\x2e\x32\x1a\x70\xd9\x67\x22\x46\xab\x1c\xb8\xf1\x87\xea\x7a\xb6\xfc\xe2\x09\x3f\x39\x3b\x77\xf6\x9d\xb3\x9f\x83\x84\x7d\xe9\x39\xb7\xe6\x2b\x36\x4b\x43\x61\x55\xeb\xeb\x09\x47\xd3\xdd\xf3\xc3\xaf\xfe\xe7\xdf\x48\x12\x6a\x07\xd7\x03\x00\x00")
+
+func assetsErrorHtmlBytes() ([]byte, error) {
+	return bindataRead(
+		_assetsErrorHtml,
+		"assets/error.html",
+	)
+}
+
+func assetsErrorHtml() (*asset, error) {
+	bytes, err := assetsErrorHtmlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "assets/error.html", size: 983, mode: os.FileMode(420), modTime: time.Unix(1792411608, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
 var _assetsFaviconIco = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x62\x60\x60\x64\x60\x64\x10\x10\x60\x02\xd3\x1b\x18\x18\x18\xc4\x18\x18\x18\x34\x18\x18\x18\x04\x18\x18\x18\x14\x18\x20\xf2\x20\xd0\xc0\x80\x1d\xfc\xff\xff\x1f\x87\x0c\xf1\x00\x64\x04\x25\x18\x10\x00\x00\xff\xff\x7d\xe8\x67\x8d\xc6\x00\x00\x00")
 
 func assetsFaviconIcoBytes() ([]byte, error) {
@@ -90,7 +132,7 @@ func assetsFaviconIco() (*asset, error) {
 	return a, nil
 }
 
-var _assetsIndexHtml = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x8c\x52\xb1\x8e\xdb\x30\x0c\xdd\xef\x2b\x08\xcd\x95\x95\xa0\x1d\x8a\xc2\xce\x5a\xf4\x07\xba\xcb\x12\x63\x0b\x91\x48\x43\xa2\x2f\xce\xdf\x17\xb2\xeb\x9c\x53\x74\xb8\xc9\x34\xf9\xf8\xf8\xc8\xa7\x76\x94\x14\x2f\x6f\x00\xed\x88\xd6\xd7\x00\xa0\x4d\x28\x16\xdc\x68\x73\x41\xe9\xd4\x2c\x57\xfd\x5d\x1d\x4b\x64\x13\x76\x2a\x73\xcf\x52\x14\x38\x26\x41\x92\x4e\x11\x07\xf2\xb8\x7c\x01\xe2\x2b\xc7\xc8\xf7\xbd\x49\x82\x44\xbc\x48\xd1\xde\xde\xf8\x36\xb7\x66\x4b\x6c\xc5\x18\xe8\x06\x19\x63\xa7\x8a\x3c\x22\x96\x11\x51\x14\x8c\x19\xaf\x9d\x1a\x45\xa6\xf2\xc3\x98\x64\x17\xe7\xa9\xe9\x99\xa5\x48\xb6\x53\xfd\x71\x9c\xcc\x33\x61\xbe\x35\xa7\xe6\x64\x5c\x29\x1f\xb9\x26\x05\x6a\x5c\x29\x0a\xe4\x31\x61\xa7\x04\x17\xa9\x88\x55\x55\x6b\xf6\x7d\xdb\x9e\xfd\x03\x5c\xb4\xa5\x6c\x18\xed\x90\x04\xf3\x2e\xde\x87\xf7\xbd\xea\xf8\x1d\xb3\xae\xfb\xda\x40\x98\xc1\xeb\x6b\xc4\x05\x46\x7d\x3e\x9d\x60\xd2\x5f\x21\x2d\xda\xce\xc2\x50\xd3\xda\x71\x9c\x13\x81\x8d\x61\x20\x9d\x82\xf7\x11\xff\x72\xd6\x3b\xda\x40\x90\x39\x62\xa7\x6a\xa8\xf6\x11\x81\x2a\xf1\x3a\xe8\x09\xae\xe6\x9c\x5f\x35\x54\xf1\x81\x06\x75\x3c\xea\x78\x3e\x34\x4c\x3b\x3e\xa2\xf5\x07\x26\x80\x5f\x02\x77\xce\xb7\xf2\x81\x35\xd3\xa7\x1a\x5b\xfb\x8f\x2b\x43\x90\x71\xee\x57\x23\x68\x28\xe6\x29\xe5\xb9\x4c\x2f\x04\xbd\x90\x8e\xc3\xfa\x29\xe8\x98\xbc\xcd\x8f\x17\x5a\x80\xdf\x01\xef\xc0\x04\x3f\x57\xbe\xe3\x44\x63\x2f\xff\x93\xd9\x9a\x7a\xb3\xcd\xc6\xea\xde\xe5\xad\x35\xdb\x3b\xfe\x13\x00\x00\xff\xff\x4b\x33\x1a\x12\xcf\x02\x00\x00")
+var _assetsIndexHtml = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x02\xff\x8d\x53\x4b\x6e\xdb\x30\x10\xdd\xe7\x14\x03\xae\x4b\xd3\x46\xb3\x28\x0a\xd9\xdb\xa2\x17\xe8\x9e\x12\xc7\x22\x61\x7e\x04\x72\x14\xcb\xbb\xa2\x5a\xe5\x0e\xd9\xe6\x0c\xdd\xf4\x36\xba\x48\x49\x39\x72\x14\x34\x01\xba\x10\x34\x9a\x79\xf3\xe6\xcd\x47\x95\x26\x67\x0f\x77\x00\x95\x46\xa9\x8a\x91\x4d\x87\x24\xa1\xd1\x32\x26\xa4\x3d\xeb\xe9\xc8\xbf\xb0\x75\xc8\x4b\x87\x7b\x16\x43\x1d\x28\x31\x68\x82\x27\xf4\x19\xe8\x83\xf1\x0a\x87\x4f\xe0\xc3\x31\x58\x1b\xce\x4b\x12\x19\xb2\x78\xa0\xc4\x95\x3c\x85\x53\x5f\x89\xab\xe3\x1a\xb4\xc6\x9f\x20\xa2\xdd\xb3\x44\x17\x8b\x49\x23\x12\x03\x1d\xf1\xb8\x67\x9a\xa8\x4b\x5f\x85\x70\x72\x68\x94\xdf\xd4\x21\x17\xa4\x28\xbb\xf2\xd1\x04\x27\x6e\x0e\x71\xbf\xd9\x6e\xb6\xa2\x49\xe9\xd5\xb7\x71\x26\xa3\x52\x56\x48\x97\x2e\xeb\x25\x1c\xa8\x20\x66\x55\x95\x58\xfa\xad\xea\xa0\x2e\xd0\x58\x99\xd2\x15\xc3\x9b\xdc\x0d\xc6\x45\xbc\x32\x0f\x4b\xb4\x09\x0f\x18\x79\xe9\x57\x1a\x8f\x11\x14\x3f\x5a\x1c\x40\xf3\xdd\x76\x0b\x1d\xff\x0c\x6e\xe0\xb2\xa7\x00\xc5\x9d\x71\xb6\x77\x1e\xa4\x35\xad\xe7\xce\x28\x65\xf1\x85\xb3\xcc\x31\x33\x40\x0c\x36\xeb\x2a\x26\x5b\x4a\x18\x5f\x88\xe7\x42\x37\x70\x59\xce\xee\xad\x86\x22\xde\xf8\x96\xad\x87\xaa\x77\xab\x84\x6e\xc1\xdb\x8c\x5c\x31\x01\x7c\x27\x38\x87\x78\x4a\xaf\x58\xd1\xfd\x57\x62\x25\x5f\xb6\x22\x94\x4c\xba\x0e\x32\xaa\x9b\xec\x9a\x3c\xe4\x87\xdb\x76\x7e\x75\xd1\x38\x19\x2f\x6f\xd2\x01\xa6\xf1\xe7\x34\x8e\xd3\xaf\xdf\xd3\xf8\x3c\x8d\x4f\xd3\xf8\x67\x1a\x1f\xd7\x05\x84\x7c\xb7\xde\x72\x05\xad\x21\xdd\xd7\xf3\xe2\x7d\x9b\xc4\xad\xf5\x8f\x54\x24\xcc\xab\x52\xff\xea\xf8\x61\xf0\x0c\xc1\xc3\xb7\x99\xef\x23\x01\xab\xb1\x54\xa2\xec\xe8\x7a\x36\xe5\x5a\x0e\x77\x79\xda\xf3\x7f\xf3\x17\x98\x79\x4a\x7c\x3f\x03\x00\x00")
 
 func assetsIndexHtmlBytes() ([]byte, error) {
 	return bindataRead(
@@ -105,7 +147,7 @@ func assetsIndexHtml() (*asset, error) {
 		return nil, err
 	}
 
-	info := bindataFileInfo{name: "assets/index.html", size: 719, mode: os.FileMode(420), modTime: time.Unix(1518490916, 0)}
+	info := bindataFileInfo{name: "assets/index.html", size: 831, mode: os.FileMode(420), modTime: time.Unix(1792411955, 0)}
 	a := &asset{bytes: bytes, info: info}
 	return a, nil
 }
@@ -182,6 +224,8 @@ func AssetNames() []string {
 
 // _bindata is a table, holding each asset generator, mapped to its name.
 var _bindata = map[string]func() (*asset, error){
+	"assets/dashboard.html": assetsDashboardHtml,
+	"assets/error.html": assetsErrorHtml,
 	"assets/favicon.ico": assetsFaviconIco,
 	"assets/index.html": assetsIndexHtml,
 	"assets/success.html": assetsSuccessHtml,
@@ -228,6 +272,8 @@ type bintree struct {
 }
 var _bintree = &bintree{nil, map[string]*bintree{
 	"assets": &bintree{nil, map[string]*bintree{
+		"dashboard.html": &bintree{assetsDashboardHtml, map[string]*bintree{}},
+		"error.html": &bintree{assetsErrorHtml, map[string]*bintree{}},
 		"favicon.ico": &bintree{assetsFaviconIco, map[string]*bintree{}},
 		"index.html": &bintree{assetsIndexHtml, map[string]*bintree{}},
 		"success.html": &bintree{assetsSuccessHtml, map[string]*bintree{}},
@@ -20,6 +20,8 @@ func TestAssetDir(t *testing.T) {
 	files, err := AssetDir("assets")
 	sort.Strings(files)
 	Test{[]string{
+		"dashboard.html",
+		"error.html",
 		"favicon.ico",
 		"index.html",
 		"success.html",
@@ -31,6 +33,8 @@ func TestAssetNames(t *testing.T) {
 	names := AssetNames()
 	sort.Strings(names)
 	Test{[]string{
+		"assets/dashboard.html",
+		"assets/error.html",
 		"assets/favicon.ico",
 		"assets/index.html",
 		"assets/success.html",
@@ -43,7 +47,7 @@ func TestAssetInfo(t *testing.T) {
 	for _, test := range []Test{
 		{true, err == nil},
 		{"assets/index.html", info.Name()},
-		{int64(719), info.Size()},
+		{int64(831), info.Size()},
 		{"-rw-r--r--", info.Mode().String()},
 		{false, info.ModTime().IsZero()},
 		{false, info.IsDir()},
@@ -62,7 +66,7 @@ func TestRestoreAsset(t *testing.T) {
 	stat, _ := os.Stat(".restored-assets/assets/index.html")
 	for _, test := range []Test{
 		{"index.html", stat.Name()},
-		{int64(719), stat.Size()},
+		{int64(831), stat.Size()},
 	} {
 		test.Compare(t)
 	}
@@ -0,0 +1,90 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+type cachedTimeTable struct {
+	TimeTable *timeTable `json:"timeTable"`
+	Date      time.Time  `json:"date"`
+	CachedAt  time.Time  `json:"cachedAt"`
+}
+
+// getTimeTableOn returns the time table of the workday, served from the cache while it is fresh.
+// The cache is only for displaying, and updates must be built from fetchTimeTableOn.
+func (ctx *Context) getTimeTableOn(c context.Context, client *timeTableClient, date time.Time) (*timeTable, error) {
+	key := date.Format("2006-01-02")
+	if timeTable := ctx.getCachedTimeTable(key); timeTable != nil {
+		timeTable.HolidayWork = ctx.getHolidayWorkReason(key)
+		return timeTable, nil
+	}
+	return ctx.fetchTimeTableOn(c, client, date)
+}
+
+// fetchTimeTableOn fetches the time table of the workday from TeamSpirit, and caches it
+func (ctx *Context) fetchTimeTableOn(c context.Context, client *timeTableClient, date time.Time) (*timeTable, error) {
+	key := date.Format("2006-01-02")
+	var timeTable *timeTable
+	var err error
+	if key != ctx.now().In(date.Location()).Format("2006-01-02") {
+		timeTable, err = client.GetTimeTableOn(c, date)
+	} else {
+		timeTable, err = client.GetTimeTable(c)
+	}
+	if err != nil {
+		return nil, err
+	}
+	ctx.setCachedTimeTable(key, timeTable)
+	timeTable.HolidayWork = ctx.getHolidayWorkReason(key)
+	return timeTable, nil
+}
+
+func (ctx *Context) getCachedTimeTables() map[string]cachedTimeTable {
+	cache := map[string]cachedTimeTable{}
+	if data := ctx.getVariableInHash(ctx.TimeTableCacheStoreKey, ctx.UserID); data != "" {
+		json.Unmarshal([]byte(data), &cache)
+	}
+	return cache
+}
+
+func (ctx *Context) getCachedTimeTable(key string) *timeTable {
+	if ctx.TimeTableCacheTTL <= 0 {
+		return nil
+	}
+	cached, ok := ctx.getCachedTimeTables()[key]
+	if !ok || cached.TimeTable == nil || ctx.now().Sub(cached.CachedAt) >= ctx.TimeTableCacheTTL {
+		return nil
+	}
+	cached.TimeTable.Date = cached.Date
+	return cached.TimeTable
+}
+
+func (ctx *Context) setCachedTimeTable(key string, timeTable *timeTable) error {
+	if ctx.TimeTableCacheTTL <= 0 {
+		return nil
+	}
+	now := ctx.now()
+	cache := ctx.getCachedTimeTables()
+	for k, cached := range cache {
+		if now.Sub(cached.CachedAt) >= ctx.TimeTableCacheTTL {
+			delete(cache, k)
+		}
+	}
+	cache[key] = cachedTimeTable{
+		TimeTable: timeTable,
+		Date:      timeTable.Date,
+		CachedAt:  now,
+	}
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	return ctx.setVariableInHash(ctx.TimeTableCacheStoreKey, data)
+}
+
+func (ctx *Context) clearTimeTableCache() error {
+	_, err := ctx.RedisConn.Do("HDEL", ctx.TimeTableCacheStoreKey, ctx.UserID)
+	return err
+}
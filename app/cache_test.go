@@ -0,0 +1,154 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nlopes/slack"
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func mockTimeTableResponse(items []map[string]interface{}) {
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Get("/services/apexrest/Dakoku").
+		Reply(200).
+		JSON(map[string]interface{}{
+			"timeTable": items,
+			"isHoliday": false,
+		})
+}
+
+func TestTimeTableCache(t *testing.T) {
+	defer gock.Off()
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := createTestContext(app)
+	ctx.TimeTableCacheTTL = 30 * time.Second
+	client := ctx.createTimeTableClient(context.Background())
+	now := getMockTime()
+
+	mockTimeTableResponse([]map[string]interface{}{{"from": 600, "to": nil, "type": 1}})
+	tt, err := ctx.getCurrentTimeTable(context.Background(), client, now)
+	cached, cachedErr := ctx.getCurrentTimeTable(context.Background(), client, now)
+	for _, test := range []Test{
+		{nil, err},
+		{nil, cachedErr},
+		{true, gock.IsDone()},
+		{attendanceStateWorking, tt.State()},
+		{attendanceStateWorking, cached.State()},
+		{true, cached.Date.IsZero()},
+	} {
+		test.Compare(t)
+	}
+
+	ctx.now = func() time.Time { return now.Add(30 * time.Second) }
+	mockTimeTableResponse([]map[string]interface{}{{"from": 600, "to": nil, "type": 1}, {"from": 720, "to": nil, "type": 21}})
+	tt, err = ctx.getCurrentTimeTable(context.Background(), client, now)
+	for _, test := range []Test{
+		{nil, err},
+		{true, gock.IsDone()},
+		{attendanceStateResting, tt.State()},
+	} {
+		test.Compare(t)
+	}
+
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Put("/services/apexrest/Dakoku").
+		Reply(200).
+		BodyString(`"OK"`)
+	ok, err := client.SetAttendance(context.Background(), false, time.Time{}, "")
+	for _, test := range []Test{
+		{true, ok},
+		{nil, err},
+		{true, gock.IsDone()},
+		{"", ctx.getVariableInHash(ctx.TimeTableCacheStoreKey, "FOO")},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestPunchBypassesTimeTableCache(t *testing.T) {
+	defer gock.Off()
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := createTestContext(app)
+	ctx.TimeTableCacheTTL = 30 * time.Second
+	client := ctx.createTimeTableClient(context.Background())
+	now := getMockTime()
+
+	mockTimeTableResponse([]map[string]interface{}{{"from": 600, "to": nil, "type": 1}})
+	_, err := ctx.getCurrentTimeTable(context.Background(), client, now)
+	Test{nil, err}.Compare(t)
+
+	// The rest recorded in TeamSpirit after the cache was filled must be kept
+	mockTimeTableResponse([]map[string]interface{}{{"from": 600, "to": nil, "type": 1}, {"from": 660, "to": 670, "type": 21}})
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Post("/services/apexrest/Dakoku").
+		JSON(map[string]interface{}{
+			"timeTable": []map[string]interface{}{{"from": 600, "to": nil, "type": 1}, {"from": 660, "to": 670, "type": 21}, {"from": 672, "to": nil, "type": 21}},
+		}).
+		Reply(200).
+		BodyString(`"OK"`)
+	_, err = ctx.punch(context.Background(), client, queuedPunch{Action: actionTypeRest, Time: now})
+	for _, test := range []Test{
+		{nil, err},
+		{true, gock.IsDone()},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestTimeTableCacheDisabled(t *testing.T) {
+	defer gock.Off()
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := createTestContext(app)
+	client := ctx.createTimeTableClient(context.Background())
+
+	mockTimeTableResponse([]map[string]interface{}{})
+	_, err := ctx.getCurrentTimeTable(context.Background(), client, getMockTime())
+	for _, test := range []Test{
+		{nil, err},
+		{true, gock.IsDone()},
+		{"", ctx.getVariableInHash(ctx.TimeTableCacheStoreKey, "FOO")},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestGetSlackMessageRefresh(t *testing.T) {
+	defer gock.Off()
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := createTestContext(app)
+	ctx.TimeTableCacheTTL = 30 * time.Second
+
+	mockTimeTableResponse([]map[string]interface{}{})
+	msg, err := ctx.getSlackMessage(context.Background(), slack.SlashCommand{UserID: "FOO"})
+	for _, test := range []Test{
+		{nil, err},
+		{true, gock.IsDone()},
+		{"出勤する", msg.Attachments[0].Actions[0].Text},
+	} {
+		test.Compare(t)
+	}
+
+	msg, err = ctx.getSlackMessage(context.Background(), slack.SlashCommand{UserID: "FOO"})
+	for _, test := range []Test{
+		{nil, err},
+		{"出勤する", msg.Attachments[0].Actions[0].Text},
+	} {
+		test.Compare(t)
+	}
+
+	mockTimeTableResponse([]map[string]interface{}{{"from": 600, "to": nil, "type": 1}})
+	msg, err = ctx.getSlackMessage(context.Background(), slack.SlashCommand{UserID: "FOO", Text: "refresh"})
+	for _, test := range []Test{
+		{nil, err},
+		{true, gock.IsDone()},
+		{"休憩を開始する", msg.Attachments[0].Actions[0].Text},
+	} {
+		test.Compare(t)
+	}
+}
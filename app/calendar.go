@@ -0,0 +1,260 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+const (
+	// maxCompanyDaysOff limits the size of the calendar stored for a team
+	maxCompanyDaysOff = 1000
+	// maxCalendarSize limits the ICS file to import
+	maxCalendarSize = 1 << 20
+	// maxCompanyDayOffSpan ignores long events, which are unlikely days off
+	maxCompanyDayOffSpan = 31
+)
+
+var (
+	errInvalidCalendar       = errors.New("calendar has no all-day events")
+	errInvalidCalendarURL    = errors.New("calendar URL must be http or https")
+	errTooManyCompanyDaysOff = errors.New("too many days off")
+)
+
+// companyCalendar maps the dates like 2018-12-28 to the names of the days off of the team
+type companyCalendar map[string]string
+
+func (ctx *Context) getCompanyCalendar(teamID string) companyCalendar {
+	calendar := companyCalendar{}
+	if data := ctx.getVariableInHash(ctx.CalendarStoreKey, teamID); data != "" {
+		json.Unmarshal([]byte(data), &calendar)
+	}
+	return calendar
+}
+
+func (ctx *Context) setCompanyCalendar(teamID string, calendar companyCalendar) error {
+	if len(calendar) > maxCompanyDaysOff {
+		return errTooManyCompanyDaysOff
+	}
+	if len(calendar) == 0 {
+		_, err := ctx.RedisConn.Do("HDEL", ctx.CalendarStoreKey, teamID)
+		return err
+	}
+	data, err := json.Marshal(calendar)
+	if err != nil {
+		return err
+	}
+	_, err = ctx.RedisConn.Do("HSET", ctx.CalendarStoreKey, teamID, data)
+	return err
+}
+
+// getDayOff returns the name of the national holiday or the day off of the team on the date,
+// looking up the built-in and the stored calendars without calling TeamSpirit
+func (ctx *Context) getDayOff(teamID string, date time.Time) (string, bool) {
+	if name, ok := getJapaneseHoliday(date); ok {
+		return name, true
+	}
+	if teamID == "" {
+		return "", false
+	}
+	name, ok := ctx.getCompanyCalendar(teamID)[date.Format("2006-01-02")]
+	return name, ok
+}
+
+// getNextWorkingDay returns the first weekday from the date which is not a day off
+func (ctx *Context) getNextWorkingDay(teamID string, from time.Time) time.Time {
+	day := from
+	for i := 0; i < 366; i++ {
+		if _, ok := ctx.getDayOff(teamID, day); !ok && day.Weekday() != time.Saturday && day.Weekday() != time.Sunday {
+			return day
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+	return from
+}
+
+// unescapeICSText unescapes the TEXT values of RFC 5545
+func unescapeICSText(value string) string {
+	return strings.NewReplacer(`\n`, " ", `\N`, " ", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(value)
+}
+
+// parseICSDate parses DATE and DATE-TIME values, using only the date
+func parseICSDate(value string) (time.Time, error) {
+	if len(value) < 8 {
+		return time.Time{}, errInvalidCalendar
+	}
+	return time.Parse("20060102", value[:8])
+}
+
+// parseCompanyCalendar reads the all-day events of the ICS file as days off. Recurring
+// events are not expanded, so yearly days off must be exported as separate events.
+func parseCompanyCalendar(r io.Reader) (companyCalendar, error) {
+	calendar := companyCalendar{}
+	lines := []string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		// Long lines are folded with a leading space or tab
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	var start, end time.Time
+	summary := ""
+	allDay := false
+	for _, line := range lines {
+		i := strings.Index(line, ":")
+		if i < 0 {
+			continue
+		}
+		name, value := line[:i], line[i+1:]
+		params := strings.Split(name, ";")
+		switch params[0] {
+		case "BEGIN":
+			if value == "VEVENT" {
+				start, end, summary, allDay = time.Time{}, time.Time{}, "", false
+			}
+		case "DTSTART":
+			start, _ = parseICSDate(value)
+			allDay = len(value) == 8
+		case "DTEND":
+			end, _ = parseICSDate(value)
+		case "SUMMARY":
+			summary = unescapeICSText(value)
+		case "END":
+			if value != "VEVENT" || start.IsZero() || !allDay {
+				continue
+			}
+			// DTEND of all-day events is exclusive, and omitted for single days
+			if !end.After(start) {
+				end = start.AddDate(0, 0, 1)
+			}
+			if end.Sub(start) > maxCompanyDayOffSpan*24*time.Hour {
+				continue
+			}
+			for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+				calendar[d.Format("2006-01-02")] = summary
+			}
+		}
+	}
+	if len(calendar) == 0 {
+		return nil, errInvalidCalendar
+	}
+	return calendar, nil
+}
+
+// importCompanyCalendar adds the days off in the ICS file at the URL, and returns the number of the days
+func (ctx *Context) importCompanyCalendar(c context.Context, teamID, url string) (int, error) {
+	if !strings.HasPrefix(url, "https://") && !strings.HasPrefix(url, "http://") {
+		return 0, errInvalidCalendarURL
+	}
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	res, err := ctx.newExternalHTTPClient().Do(req.WithContext(c))
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return 0, errors.New("calendar responded with " + res.Status)
+	}
+	imported, err := parseCompanyCalendar(io.LimitReader(res.Body, maxCalendarSize))
+	if err != nil {
+		return 0, err
+	}
+	calendar := ctx.getCompanyCalendar(teamID)
+	for date, name := range imported {
+		calendar[date] = name
+	}
+	return len(imported), ctx.setCompanyCalendar(teamID, calendar)
+}
+
+// getUpcomingDaysOff returns the lines of the days off from the date, up to the count
+func (ctx *Context) getUpcomingDaysOff(teamID string, from time.Time, count int) []string {
+	lines := []string{}
+	calendar := ctx.getCompanyCalendar(teamID)
+	for d := from; len(lines) < count && d.Before(from.AddDate(1, 0, 0)); d = d.AddDate(0, 0, 1) {
+		date := d.Format("2006-01-02")
+		if name, ok := getJapaneseHoliday(d); ok {
+			lines = append(lines, "• "+date+" "+name)
+		} else if name, ok := calendar[date]; ok {
+			lines = append(lines, "• "+date+" "+name+" (会社休日)")
+		}
+	}
+	return lines
+}
+
+func (ctx *Context) getCalendarSlackMessage(c context.Context, state State, args []string) (*slack.Msg, error) {
+	usage := "`/ts calendar import ICSのURL`、`/ts calendar add YYYY-MM-DD [名前]`、`/ts calendar remove YYYY-MM-DD`、`/ts calendar clear` で会社休日を変更できます (管理者のみ)"
+	if len(args) == 0 {
+		lines := []string{"今後の休日 (祝日と会社休日):"}
+		lines = append(lines, ctx.getUpcomingDaysOff(state.TeamID, ctx.getCurrentTimeForUser(), 10)...)
+		lines = append(lines, "登録済の会社休日: "+strconv.Itoa(len(ctx.getCompanyCalendar(state.TeamID)))+" 日", usage)
+		return &slack.Msg{Text: strings.Join(lines, "\n")}, nil
+	}
+	switch err := ctx.checkSlackTeamAdmin(); err {
+	case nil:
+	case errSlackNotAuthorized:
+		return ctx.getAuthenticateSlackMessage(state)
+	case errNotSlackTeamAdmin:
+		return &slack.Msg{Text: "会社休日は Slack ワークスペースの管理者のみ設定できます :no_entry_sign:"}, nil
+	default:
+		return &slack.Msg{Text: "Slack のユーザー情報の取得に失敗しました :warning:"}, nil
+	}
+	calendar := ctx.getCompanyCalendar(state.TeamID)
+	switch {
+	case args[0] == "import" && len(args) == 2:
+		n, err := ctx.importCompanyCalendar(c, state.TeamID, parseSlackURL(args[1]))
+		switch err {
+		case nil:
+			return &slack.Msg{Text: strconv.Itoa(n) + " 日の会社休日を取り込みました :calendar:"}, nil
+		case errInvalidCalendarURL:
+			return &slack.Msg{Text: "URL `" + args[1] + "` は http または https で指定してください :warning:"}, nil
+		case errInvalidCalendar:
+			return &slack.Msg{Text: "終日の予定が見つかりませんでした :warning:"}, nil
+		case errTooManyCompanyDaysOff:
+			return &slack.Msg{Text: "会社休日は " + strconv.Itoa(maxCompanyDaysOff) + " 日まで登録できます :warning:"}, nil
+		}
+		return &slack.Msg{Text: "カレンダーの取り込みに失敗しました :warning:"}, nil
+	case args[0] == "add" && len(args) >= 2:
+		date, err := time.Parse("2006-01-02", args[1])
+		if err != nil {
+			return &slack.Msg{Text: usage + " :warning:"}, nil
+		}
+		name := strings.Join(args[2:], " ")
+		if name == "" {
+			name = "会社休日"
+		}
+		calendar[date.Format("2006-01-02")] = name
+		if err := ctx.setCompanyCalendar(state.TeamID, calendar); err != nil {
+			return &slack.Msg{Text: "会社休日の登録に失敗しました :warning:"}, nil
+		}
+		return &slack.Msg{Text: date.Format("2006-01-02") + " を会社休日 (" + name + ") に登録しました"}, nil
+	case args[0] == "remove" && len(args) == 2:
+		if _, ok := calendar[args[1]]; !ok {
+			return &slack.Msg{Text: args[1] + " は会社休日に登録されていません :warning:"}, nil
+		}
+		delete(calendar, args[1])
+		ctx.setCompanyCalendar(state.TeamID, calendar)
+		return &slack.Msg{Text: args[1] + " を会社休日から削除しました"}, nil
+	case args[0] == "clear":
+		ctx.setCompanyCalendar(state.TeamID, companyCalendar{})
+		return &slack.Msg{Text: "会社休日をすべて削除しました :wastebasket:"}, nil
+	}
+	return &slack.Msg{Text: usage + " :warning:"}, nil
+}
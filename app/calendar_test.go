@@ -0,0 +1,220 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nlopes/slack"
+	"golang.org/x/oauth2"
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+const testCompanyCalendar = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTART;VALUE=DATE:20181228\r\n" +
+	"DTEND;VALUE=DATE:20190104\r\n" +
+	"SUMMARY:年末年始\\, 休業\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTART;VALUE=DATE:20180903\r\n" +
+	"SUMMARY:創立\r\n" +
+	" 記念日\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTART:20180904T100000Z\r\n" +
+	"DTEND:20180904T110000Z\r\n" +
+	"SUMMARY:会議\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTART;VALUE=DATE:20180101\r\n" +
+	"DTEND;VALUE=DATE:20181231\r\n" +
+	"SUMMARY:長期\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestParseCompanyCalendar(t *testing.T) {
+	calendar, err := parseCompanyCalendar(strings.NewReader(testCompanyCalendar))
+	Test{nil, err}.Compare(t)
+	Test{companyCalendar{
+		"2018-09-03": "創立記念日",
+		"2018-12-28": "年末年始, 休業",
+		"2018-12-29": "年末年始, 休業",
+		"2018-12-30": "年末年始, 休業",
+		"2018-12-31": "年末年始, 休業",
+		"2019-01-01": "年末年始, 休業",
+		"2019-01-02": "年末年始, 休業",
+		"2019-01-03": "年末年始, 休業",
+	}, calendar}.DeepEqual(t)
+	_, err = parseCompanyCalendar(strings.NewReader("BEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n"))
+	Test{errInvalidCalendar, err}.Compare(t)
+}
+
+func TestGetDayOff(t *testing.T) {
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := app.createContext(nil)
+	ctx.setCompanyCalendar("T12345678", companyCalendar{"2018-09-03": "創立記念日"})
+	for _, test := range []struct {
+		teamID   string
+		date     time.Time
+		expected string
+	}{
+		{"T12345678", time.Date(2018, time.September, 3, 9, 0, 0, 0, time.UTC), "創立記念日"},
+		{"T87654321", time.Date(2018, time.September, 3, 9, 0, 0, 0, time.UTC), ""},
+		{"", time.Date(2018, time.September, 3, 9, 0, 0, 0, time.UTC), ""},
+		{"", time.Date(2018, time.September, 17, 9, 0, 0, 0, time.UTC), "敬老の日"},
+	} {
+		name, ok := ctx.getDayOff(test.teamID, test.date)
+		Test{test.expected, name}.Compare(t)
+		Test{test.expected != "", ok}.Compare(t)
+	}
+	Test{[]string{
+		"• 2018-09-03 創立記念日 (会社休日)",
+		"• 2018-09-17 敬老の日",
+		"• 2018-09-23 秋分の日",
+	}, ctx.getUpcomingDaysOff("T12345678", time.Date(2018, time.September, 1, 0, 0, 0, 0, time.UTC), 3)}.DeepEqual(t)
+}
+
+func TestGetNextWorkingDay(t *testing.T) {
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := app.createContext(nil)
+	ctx.setCompanyCalendar("T12345678", companyCalendar{"2018-09-18": "創立記念日"})
+	for _, test := range []struct {
+		teamID   string
+		from     time.Time
+		expected string
+	}{
+		{"T12345678", time.Date(2018, time.September, 14, 9, 0, 0, 0, time.UTC), "2018-09-14"},
+		{"", time.Date(2018, time.September, 15, 9, 0, 0, 0, time.UTC), "2018-09-18"},
+		{"T12345678", time.Date(2018, time.September, 15, 9, 0, 0, 0, time.UTC), "2018-09-19"},
+	} {
+		Test{test.expected, ctx.getNextWorkingDay(test.teamID, test.from).Format("2006-01-02")}.Compare(t)
+	}
+}
+
+func TestImportCompanyCalendarInvalidURL(t *testing.T) {
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := app.createContext(nil)
+	_, err := ctx.importCompanyCalendar(context.Background(), "T12345678", "ftp://calendar.example.com/company.ics")
+	Test{errInvalidCalendarURL, err}.Compare(t)
+}
+
+func TestImportCompanyCalendarInternalAddress(t *testing.T) {
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := app.createContext(nil)
+	requested := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = true
+		w.Write([]byte(testCompanyCalendar))
+	}))
+	defer server.Close()
+	_, err := ctx.importCompanyCalendar(context.Background(), "T12345678", server.URL+"/company.ics")
+	Test{true, errors.Is(err, errInternalAddress)}.Compare(t)
+	Test{false, requested}.Compare(t)
+	Test{0, len(ctx.getCompanyCalendar("T12345678"))}.Compare(t)
+}
+
+func TestRunPunchSchedulesOnDayOff(t *testing.T) {
+	defer gock.Off()
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := app.createContext(nil)
+	ctx.UserID = "FOO"
+	ctx.location = time.FixedZone("Asia/Tokyo", 9*60*60)
+	ctx.setSalesforceAccessToken(&oauth2.Token{AccessToken: "foo", RefreshToken: "bar", TokenType: "Bearer"})
+	ctx.getScheduleSlackMessage("T12345678", []string{"add", "12:00-13:00", "auto", "everyday"})
+	ctx.setCompanyCalendar("T12345678", companyCalendar{"2018-09-03": "創立記念日"})
+	for _, now := range []time.Time{
+		time.Date(2018, time.September, 3, 12, 0, 30, 0, ctx.location),
+		time.Date(2018, time.September, 17, 12, 0, 30, 0, ctx.location),
+	} {
+		ctx.now = func() time.Time { return now }
+		ctx.runPunchSchedules(context.Background())
+		Test{0, len(gock.Pending())}.Compare(t)
+		Test{false, gock.HasUnmatchedRequest()}.Compare(t)
+		Test{now.Format("2006-01-02"), ctx.getPunchSchedules().Entries[0].LastRest}.Compare(t)
+	}
+}
+
+func TestGetCalendarSlackMessage(t *testing.T) {
+	defer gock.Off()
+	defer func(transport http.RoundTripper) { externalTransport = transport }(externalTransport)
+	externalTransport = nil
+	defer gock.RestoreClient(slack.HTTPClient)
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := app.createContext(nil)
+	ctx.UserID = "FOO"
+	ctx.now = getMockTime
+	state := State{TeamID: "T12345678", UserID: "FOO"}
+	usage := "`/ts calendar import ICSのURL`、`/ts calendar add YYYY-MM-DD [名前]`、`/ts calendar remove YYYY-MM-DD`、`/ts calendar clear` で会社休日を変更できます (管理者のみ)"
+
+	ctx.setSlackAccessToken("xoxp-foo")
+	client := &http.Client{Transport: &http.Transport{}}
+	gock.InterceptClient(client)
+	slack.SetHTTPClient(client)
+	gock.New("https://slack.com").
+		Post("/api/users.info").
+		Reply(200).
+		JSON(map[string]interface{}{"ok": true, "user": map[string]interface{}{"id": "FOO", "is_admin": false}})
+	msg, _ := ctx.getCalendarSlackMessage(context.Background(), state, []string{"clear"})
+	Test{"会社休日は Slack ワークスペースの管理者のみ設定できます :no_entry_sign:", msg.Text}.Compare(t)
+
+	gock.New("https://slack.com").
+		Post("/api/users.info").
+		Persist().
+		Reply(200).
+		JSON(map[string]interface{}{"ok": true, "user": map[string]interface{}{"id": "FOO", "is_admin": true}})
+	gock.New("https://calendar.example.com").
+		Get("/company.ics").
+		Reply(200).
+		BodyString(testCompanyCalendar)
+	gock.New("https://calendar.example.com").
+		Get("/empty.ics").
+		Reply(200).
+		BodyString("BEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n")
+	gock.New("https://calendar.example.com").
+		Get("/missing.ics").
+		Reply(404)
+	for _, test := range []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"import", "<https://calendar.example.com/company.ics>"}, "8 日の会社休日を取り込みました :calendar:"},
+		{[]string{"import", "<https://calendar.example.com/empty.ics>"}, "終日の予定が見つかりませんでした :warning:"},
+		{[]string{"import", "<https://calendar.example.com/missing.ics>"}, "カレンダーの取り込みに失敗しました :warning:"},
+		{[]string{"import", "calendar.ics"}, "URL `calendar.ics` は http または https で指定してください :warning:"},
+		{[]string{"add", "2018-09-10", "夏季", "休業"}, "2018-09-10 を会社休日 (夏季 休業) に登録しました"},
+		{[]string{"add", "2018-09-11"}, "2018-09-11 を会社休日 (会社休日) に登録しました"},
+		{[]string{"add", "9/12"}, usage + " :warning:"},
+		{[]string{"remove", "2018-09-11"}, "2018-09-11 を会社休日から削除しました"},
+		{[]string{"remove", "2018-09-11"}, "2018-09-11 は会社休日に登録されていません :warning:"},
+		{[]string{}, "今後の休日 (祝日と会社休日):\n" +
+			"• 2018-09-03 創立記念日 (会社休日)\n" +
+			"• 2018-09-10 夏季 休業 (会社休日)\n" +
+			"• 2018-09-17 敬老の日\n" +
+			"• 2018-09-23 秋分の日\n" +
+			"• 2018-09-24 振替休日\n" +
+			"• 2018-10-08 体育の日\n" +
+			"• 2018-11-03 文化の日\n" +
+			"• 2018-11-23 勤労感謝の日\n" +
+			"• 2018-12-23 天皇誕生日\n" +
+			"• 2018-12-24 振替休日\n" +
+			"登録済の会社休日: 9 日\n" + usage},
+		{[]string{"clear"}, "会社休日をすべて削除しました :wastebasket:"},
+		{[]string{"foo"}, usage + " :warning:"},
+	} {
+		msg, _ := ctx.getCalendarSlackMessage(context.Background(), state, test.args)
+		Test{test.expected, msg.Text}.Compare(t)
+	}
+	Test{0, len(ctx.getCompanyCalendar("T12345678"))}.Compare(t)
+}
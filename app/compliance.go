@@ -0,0 +1,341 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+const (
+	complianceRuleRest      = "rest"
+	complianceRuleLateNight = "late_night"
+	complianceRuleMaxHours  = "max_hours"
+	complianceRuleCoreTime  = "core_time"
+	// lateNightEnd is the end of the late-night hours of the Labor Standards Act
+	lateNightEnd = 5 * 60
+)
+
+var errInvalidComplianceSetting = errors.New("compliance setting is invalid")
+
+// complianceSetting enables a rule for the team. Limit is the minutes from midnight
+// for late_night and the minutes of working for max_hours, and From and To are
+// the core time.
+type complianceSetting struct {
+	Enabled bool `json:"enabled"`
+	// Block refuses the punch violating the rule, instead of warning
+	Block bool `json:"block,omitempty"`
+	Limit int  `json:"limit,omitempty"`
+	From  int  `json:"from,omitempty"`
+	To    int  `json:"to,omitempty"`
+}
+
+type complianceSettings map[string]complianceSetting
+
+// complianceRule checks the time table after the action taken at the minutes from the beginning of the workday
+type complianceRule struct {
+	ID      string
+	Name    string
+	Default complianceSetting
+	Check   func(setting complianceSetting, tt *timeTable, action string, at int) string
+	Format  func(setting complianceSetting) string
+	Parse   func(setting *complianceSetting, value string) error
+}
+
+type complianceViolation struct {
+	Rule    string
+	Message string
+	Block   bool
+}
+
+// complianceError is returned when the punch violates the rules blocking it
+type complianceError struct {
+	Violations []complianceViolation
+}
+
+func (err *complianceError) Error() string {
+	rules := []string{}
+	for _, violation := range err.Violations {
+		rules = append(rules, violation.Rule)
+	}
+	return "punch violates compliance rules: " + strings.Join(rules, ", ")
+}
+
+// Text explains why the punch was refused, with a line for each violation
+func (err *complianceError) Text() string {
+	lines := []string{"労務ルールにより打刻できません :no_entry_sign:"}
+	for _, violation := range err.Violations {
+		lines = append(lines, violation.Message)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// getComplianceWarningText appends the violations not blocking the punch to the response
+func getComplianceWarningText(violations []complianceViolation) string {
+	text := ""
+	for _, violation := range violations {
+		text += "\n:warning: " + violation.Message
+	}
+	return text
+}
+
+// getComplianceWarnings returns the messages of the violations for the API
+func getComplianceWarnings(violations []complianceViolation) []string {
+	messages := []string{}
+	for _, violation := range violations {
+		messages = append(messages, violation.Message)
+	}
+	return messages
+}
+
+// workedMinutes returns the minutes of working and resting, counting the open items until now
+func (tt *timeTable) workedMinutes(now int) (int, int) {
+	work, rest := 0, 0
+	for _, item := range tt.Items {
+		if !item.From.Valid {
+			continue
+		}
+		from, to := int(item.From.Int64), now
+		if item.To.Valid {
+			to = int(item.To.Int64)
+		}
+		if to < from {
+			continue
+		}
+		if item.IsAttendance() {
+			work += to - from
+		} else if item.IsRest() {
+			rest += to - from
+		}
+	}
+	return work - rest, rest
+}
+
+func parseComplianceWindow(value string) (int, int, error) {
+	window := strings.SplitN(value, "-", 2)
+	if len(window) != 2 {
+		return 0, 0, errInvalidComplianceSetting
+	}
+	from, err := parseClock(window[0])
+	if err != nil || from < 0 {
+		return 0, 0, errInvalidComplianceSetting
+	}
+	to, err := parseClock(window[1])
+	if err != nil || to <= from {
+		return 0, 0, errInvalidComplianceSetting
+	}
+	return from, to, nil
+}
+
+var complianceRules = []complianceRule{
+	{
+		ID:   complianceRuleRest,
+		Name: "休憩時間",
+		Check: func(setting complianceSetting, tt *timeTable, action string, at int) string {
+			if action != actionTypeLeave {
+				return ""
+			}
+			work, rest := tt.workedMinutes(at)
+			switch {
+			case work > 8*60 && rest < 60:
+				return "8 時間を超える勤務には 60 分以上の休憩が必要です (休憩 " + strconv.Itoa(rest) + " 分)"
+			case work > 6*60 && rest < 45:
+				return "6 時間を超える勤務には 45 分以上の休憩が必要です (休憩 " + strconv.Itoa(rest) + " 分)"
+			}
+			return ""
+		},
+		Format: func(setting complianceSetting) string {
+			return "6 時間超で 45 分、8 時間超で 60 分"
+		},
+	},
+	{
+		ID:      complianceRuleLateNight,
+		Name:    "深夜勤務",
+		Default: complianceSetting{Limit: 22 * 60},
+		Check: func(setting complianceSetting, tt *timeTable, action string, at int) string {
+			clock := at % (24 * 60)
+			if at > setting.Limit || clock < lateNightEnd {
+				return formatClock(setting.Limit) + " 以降の深夜勤務です"
+			}
+			return ""
+		},
+		Format: func(setting complianceSetting) string {
+			return formatClock(setting.Limit) + " 以降"
+		},
+		Parse: func(setting *complianceSetting, value string) error {
+			limit, err := parseClock(value)
+			if err != nil || limit < 0 {
+				return errInvalidComplianceSetting
+			}
+			setting.Limit = limit
+			return nil
+		},
+	},
+	{
+		ID:      complianceRuleMaxHours,
+		Name:    "勤務時間の上限",
+		Default: complianceSetting{Limit: 10 * 60},
+		Check: func(setting complianceSetting, tt *timeTable, action string, at int) string {
+			if work, _ := tt.workedMinutes(at); work > setting.Limit {
+				return "1 日の勤務時間が " + strconv.Itoa(setting.Limit/60) + " 時間を超えています"
+			}
+			return ""
+		},
+		Format: func(setting complianceSetting) string {
+			return strconv.Itoa(setting.Limit/60) + " 時間"
+		},
+		Parse: func(setting *complianceSetting, value string) error {
+			hours, err := strconv.Atoi(strings.TrimSuffix(value, "h"))
+			if err != nil || hours < 1 || hours > 24 {
+				return errInvalidComplianceSetting
+			}
+			setting.Limit = hours * 60
+			return nil
+		},
+	},
+	{
+		ID:      complianceRuleCoreTime,
+		Name:    "コアタイム",
+		Default: complianceSetting{From: 10 * 60, To: 15 * 60},
+		Check: func(setting complianceSetting, tt *timeTable, action string, at int) string {
+			window := formatClock(setting.From) + "-" + formatClock(setting.To)
+			switch {
+			case action == actionTypeAttend && at > setting.From:
+				return "コアタイム (" + window + ") の開始後の出勤です"
+			case action == actionTypeLeave && at < setting.To:
+				return "コアタイム (" + window + ") の終了前の退勤です"
+			}
+			return ""
+		},
+		Format: func(setting complianceSetting) string {
+			return formatClock(setting.From) + "-" + formatClock(setting.To)
+		},
+		Parse: func(setting *complianceSetting, value string) error {
+			from, to, err := parseComplianceWindow(value)
+			if err != nil {
+				return err
+			}
+			setting.From, setting.To = from, to
+			return nil
+		},
+	},
+}
+
+// Describe returns the rule with the parameters and whether it warns or blocks
+func (rule complianceRule) Describe(setting complianceSetting) string {
+	status := "無効"
+	if setting.Block {
+		status = "打刻を拒否"
+	} else if setting.Enabled {
+		status = "警告"
+	}
+	return "`" + rule.ID + "` " + rule.Name + " (" + rule.Format(setting) + "): " + status
+}
+
+func findComplianceRule(id string) (complianceRule, bool) {
+	for _, rule := range complianceRules {
+		if rule.ID == id {
+			return rule, true
+		}
+	}
+	return complianceRule{}, false
+}
+
+// get returns the setting of the rule, which is disabled with the default parameters if not configured
+func (settings complianceSettings) get(rule complianceRule) complianceSetting {
+	if setting, ok := settings[rule.ID]; ok {
+		return setting
+	}
+	return rule.Default
+}
+
+// check returns the violations of the enabled rules by the time table after the action at the time
+func (settings complianceSettings) check(tt *timeTable, action string, t time.Time) []complianceViolation {
+	violations := []complianceViolation{}
+	at := int(tt.convertTime(t).Int64)
+	for _, rule := range complianceRules {
+		setting := settings.get(rule)
+		if !setting.Enabled {
+			continue
+		}
+		if message := rule.Check(setting, tt, action, at); message != "" {
+			violations = append(violations, complianceViolation{Rule: rule.ID, Message: message, Block: setting.Block})
+		}
+	}
+	return violations
+}
+
+// preview returns a copy of the time table with the action applied
+func (tt *timeTable) preview(action string, t time.Time) *timeTable {
+	preview := *tt
+	preview.Items = append([]timeTableItem{}, tt.Items...)
+	preview.Apply(action, t)
+	return &preview
+}
+
+func (ctx *Context) getComplianceSettings(teamID string) complianceSettings {
+	settings := complianceSettings{}
+	if data := ctx.getVariableInHash(ctx.ComplianceStoreKey, teamID); data != "" {
+		json.Unmarshal([]byte(data), &settings)
+	}
+	return settings
+}
+
+func (ctx *Context) setComplianceSettings(teamID string, settings complianceSettings) error {
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	_, err = ctx.RedisConn.Do("HSET", ctx.ComplianceStoreKey, teamID, data)
+	return err
+}
+
+func (ctx *Context) getComplianceSlackMessage(state State, args []string) (*slack.Msg, error) {
+	usage := "`/ts compliance ルール off|warn|block [設定値]` で変更できます (管理者のみ)"
+	settings := ctx.getComplianceSettings(state.TeamID)
+	if len(args) == 0 {
+		lines := []string{"労務ルール:"}
+		for _, rule := range complianceRules {
+			lines = append(lines, "• "+rule.Describe(settings.get(rule)))
+		}
+		lines = append(lines, usage)
+		return &slack.Msg{Text: strings.Join(lines, "\n")}, nil
+	}
+	rule, ok := findComplianceRule(args[0])
+	if !ok || len(args) < 2 || len(args) > 3 {
+		return &slack.Msg{Text: usage + " :warning:"}, nil
+	}
+	switch err := ctx.checkSlackTeamAdmin(); err {
+	case nil:
+	case errSlackNotAuthorized:
+		return ctx.getAuthenticateSlackMessage(state)
+	case errNotSlackTeamAdmin:
+		return &slack.Msg{Text: "労務ルールは Slack ワークスペースの管理者のみ設定できます :no_entry_sign:"}, nil
+	default:
+		return &slack.Msg{Text: "Slack のユーザー情報の取得に失敗しました :warning:"}, nil
+	}
+	setting := settings.get(rule)
+	switch args[1] {
+	case "off":
+		setting.Enabled, setting.Block = false, false
+	case "warn":
+		setting.Enabled, setting.Block = true, false
+	case "block":
+		setting.Enabled, setting.Block = true, true
+	default:
+		return &slack.Msg{Text: usage + " :warning:"}, nil
+	}
+	if len(args) == 3 {
+		if rule.Parse == nil || rule.Parse(&setting, args[2]) != nil {
+			return &slack.Msg{Text: "`" + args[2] + "` は " + rule.Name + " の設定値として不正です :warning:"}, nil
+		}
+	}
+	settings[rule.ID] = setting
+	if err := ctx.setComplianceSettings(state.TeamID, settings); err != nil {
+		return &slack.Msg{Text: "設定の保存に失敗しました :warning:"}, nil
+	}
+	return &slack.Msg{Text: "労務ルールを変更しました: " + rule.Describe(setting)}, nil
+}
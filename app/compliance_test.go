@@ -0,0 +1,183 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nlopes/slack"
+	"golang.org/x/oauth2"
+	null "gopkg.in/guregu/null.v3"
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func TestWorkedMinutes(t *testing.T) {
+	tt := &timeTable{Items: []timeTableItem{
+		{null.IntFrom(9 * 60), null.IntFromPtr(nil), timeTableItemTypeAttendance},
+		{null.IntFrom(12 * 60), null.IntFrom(12*60 + 30), timeTableItemTypeRest},
+		{null.IntFrom(15 * 60), null.IntFromPtr(nil), timeTableItemTypeRest},
+	}}
+	work, rest := tt.workedMinutes(16 * 60)
+	Test{420 - 90, work}.Compare(t)
+	Test{90, rest}.Compare(t)
+	work, rest = (&timeTable{}).workedMinutes(16 * 60)
+	Test{0, work}.Compare(t)
+	Test{0, rest}.Compare(t)
+}
+
+func TestCheckCompliance(t *testing.T) {
+	loc := getMockTime().Location()
+	settings := complianceSettings{
+		complianceRuleRest:      {Enabled: true},
+		complianceRuleLateNight: {Enabled: true, Block: true, Limit: 22 * 60},
+		complianceRuleMaxHours:  {Enabled: true, Limit: 10 * 60},
+		complianceRuleCoreTime:  {Enabled: true, From: 10 * 60, To: 15 * 60},
+	}
+	working := &timeTable{Items: []timeTableItem{{null.IntFrom(9 * 60), null.IntFromPtr(nil), timeTableItemTypeAttendance}}}
+	for _, test := range []struct {
+		tt       *timeTable
+		action   string
+		hour     int
+		min      int
+		expected []complianceViolation
+	}{
+		{&timeTable{}, actionTypeAttend, 9, 30, []complianceViolation{}},
+		{&timeTable{}, actionTypeAttend, 10, 1, []complianceViolation{
+			{complianceRuleCoreTime, "コアタイム (10:00-15:00) の開始後の出勤です", false},
+		}},
+		{&timeTable{}, actionTypeAttend, 4, 30, []complianceViolation{
+			{complianceRuleLateNight, "22:00 以降の深夜勤務です", true},
+		}},
+		{working, actionTypeRest, 12, 0, []complianceViolation{}},
+		{working, actionTypeLeave, 14, 0, []complianceViolation{
+			{complianceRuleCoreTime, "コアタイム (10:00-15:00) の終了前の退勤です", false},
+		}},
+		{working, actionTypeLeave, 15, 30, []complianceViolation{
+			{complianceRuleRest, "6 時間を超える勤務には 45 分以上の休憩が必要です (休憩 0 分)", false},
+		}},
+		{working, actionTypeLeave, 22, 30, []complianceViolation{
+			{complianceRuleRest, "8 時間を超える勤務には 60 分以上の休憩が必要です (休憩 0 分)", false},
+			{complianceRuleLateNight, "22:00 以降の深夜勤務です", true},
+			{complianceRuleMaxHours, "1 日の勤務時間が 10 時間を超えています", false},
+		}},
+	} {
+		now := time.Date(2018, time.September, 3, test.hour, test.min, 0, 0, loc)
+		Test{test.expected, settings.check(test.tt.preview(test.action, now), test.action, now)}.DeepEqual(t)
+	}
+	Test{1, len(working.Items)}.Compare(t)
+	Test{false, working.Items[0].To.Valid}.Compare(t)
+	Test{[]complianceViolation{}, complianceSettings{}.check(working.preview(actionTypeLeave, time.Date(2018, time.September, 3, 23, 0, 0, 0, loc)), actionTypeLeave, time.Date(2018, time.September, 3, 23, 0, 0, 0, loc))}.DeepEqual(t)
+}
+
+func TestPunchWithComplianceRules(t *testing.T) {
+	defer gock.Off()
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := app.createContext(nil)
+	ctx.UserID = "FOO"
+	ctx.setSalesforceAccessToken(&oauth2.Token{AccessToken: "foo", RefreshToken: "bar", TokenType: "Bearer"})
+	ctx.setComplianceSettings("T12345678", complianceSettings{
+		complianceRuleRest:     {Enabled: true, Block: true},
+		complianceRuleCoreTime: {Enabled: true, From: 10 * 60, To: 16 * 60},
+	})
+	items := []timeTableItem{{null.IntFrom(9 * 60), null.IntFromPtr(nil), timeTableItemTypeAttendance}}
+	now := time.Date(2018, time.September, 3, 18, 0, 0, 0, getMockTime().Location())
+	ctx.now = func() time.Time { return now }
+	client := ctx.createTimeTableClient(context.Background())
+
+	setupTimeTableGocks(items, &[]bool{false}[0])
+	result, err := ctx.punch(context.Background(), client, queuedPunch{TeamID: "T12345678", Action: actionTypeLeave, Time: now})
+	blocked, ok := err.(*complianceError)
+	for _, test := range []Test{
+		{true, ok},
+		{true, gock.IsDone()},
+		{"労務ルールにより打刻できません :no_entry_sign:\n8 時間を超える勤務には 60 分以上の休憩が必要です (休憩 0 分)", blocked.Text()},
+		{"punch violates compliance rules: rest", blocked.Error()},
+		{"勤務表の更新に失敗しました\n" + blocked.Text(), getTimeTableErrorText("勤務表の更新に失敗しました", err)},
+	} {
+		test.Compare(t)
+	}
+	status, res := ctx.getAPIError("勤務表の更新に失敗しました", "T12345678", err)
+	Test{http.StatusUnprocessableEntity, status}.Compare(t)
+	Test{"compliance_violation", res.Code}.Compare(t)
+
+	ctx.setRestPolicy("T12345678", restPolicy{Enabled: true, From: 12 * 60, To: 13 * 60, MinWorkMinutes: 6 * 60})
+	ctx.TimeTableClient = nil
+	client = ctx.createTimeTableClient(context.Background())
+	setupTimeTableGocks(items, &[]bool{false}[0])
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Post("/services/apexrest/Dakoku").
+		Reply(200).
+		BodyString(`"OK"`)
+	now = time.Date(2018, time.September, 3, 15, 30, 0, 0, getMockTime().Location())
+	result, err = ctx.punch(context.Background(), client, queuedPunch{TeamID: "T12345678", Action: actionTypeLeave, Time: now})
+	for _, test := range []Test{
+		{nil, err},
+		{true, gock.IsDone()},
+		{true, result.Rest != nil},
+		{"\n:warning: コアタイム (10:00-16:00) の終了前の退勤です", getComplianceWarningText(result.Warnings)},
+		{[]string{"コアタイム (10:00-16:00) の終了前の退勤です"}, getComplianceWarnings(result.Warnings)},
+	} {
+		test.DeepEqual(t)
+	}
+}
+
+func TestGetComplianceSlackMessage(t *testing.T) {
+	defer gock.Off()
+	defer gock.RestoreClient(slack.HTTPClient)
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := app.createContext(nil)
+	ctx.UserID = "FOO"
+	state := State{TeamID: "T12345678", UserID: "FOO"}
+	usage := "`/ts compliance ルール off|warn|block [設定値]` で変更できます (管理者のみ)"
+
+	msg, _ := ctx.getComplianceSlackMessage(state, []string{})
+	Test{"労務ルール:\n" +
+		"• `rest` 休憩時間 (6 時間超で 45 分、8 時間超で 60 分): 無効\n" +
+		"• `late_night` 深夜勤務 (22:00 以降): 無効\n" +
+		"• `max_hours` 勤務時間の上限 (10 時間): 無効\n" +
+		"• `core_time` コアタイム (10:00-15:00): 無効\n" + usage, msg.Text}.Compare(t)
+	msg, _ = ctx.getComplianceSlackMessage(state, []string{"foo", "warn"})
+	Test{usage + " :warning:", msg.Text}.Compare(t)
+
+	ctx.setSlackAccessToken("xoxp-foo")
+	client := &http.Client{Transport: &http.Transport{}}
+	gock.InterceptClient(client)
+	slack.SetHTTPClient(client)
+	gock.New("https://slack.com").
+		Post("/api/users.info").
+		Reply(200).
+		JSON(map[string]interface{}{"ok": true, "user": map[string]interface{}{"id": "FOO", "is_admin": false}})
+	msg, _ = ctx.getComplianceSlackMessage(state, []string{"rest", "block"})
+	Test{"労務ルールは Slack ワークスペースの管理者のみ設定できます :no_entry_sign:", msg.Text}.Compare(t)
+
+	gock.New("https://slack.com").
+		Post("/api/users.info").
+		Persist().
+		Reply(200).
+		JSON(map[string]interface{}{"ok": true, "user": map[string]interface{}{"id": "FOO", "is_owner": true}})
+	for _, test := range []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"rest", "block"}, "労務ルールを変更しました: `rest` 休憩時間 (6 時間超で 45 分、8 時間超で 60 分): 打刻を拒否"},
+		{[]string{"rest", "warn", "1h"}, "`1h` は 休憩時間 の設定値として不正です :warning:"},
+		{[]string{"late_night", "warn", "21:30"}, "労務ルールを変更しました: `late_night` 深夜勤務 (21:30 以降): 警告"},
+		{[]string{"max_hours", "block", "12h"}, "労務ルールを変更しました: `max_hours` 勤務時間の上限 (12 時間): 打刻を拒否"},
+		{[]string{"max_hours", "block", "25h"}, "`25h` は 勤務時間の上限 の設定値として不正です :warning:"},
+		{[]string{"core_time", "warn", "11:00-14:00"}, "労務ルールを変更しました: `core_time` コアタイム (11:00-14:00): 警告"},
+		{[]string{"core_time", "on"}, usage + " :warning:"},
+		{[]string{"core_time", "off"}, "労務ルールを変更しました: `core_time` コアタイム (11:00-14:00): 無効"},
+	} {
+		msg, _ := ctx.getComplianceSlackMessage(state, test.args)
+		Test{test.expected, msg.Text}.Compare(t)
+	}
+	Test{complianceSettings{
+		complianceRuleRest:      {Enabled: true, Block: true},
+		complianceRuleLateNight: {Enabled: true, Limit: 21*60 + 30},
+		complianceRuleMaxHours:  {Enabled: true, Block: true, Limit: 12 * 60},
+		complianceRuleCoreTime:  {From: 11 * 60, To: 14 * 60},
+	}, ctx.getComplianceSettings("T12345678")}.DeepEqual(t)
+}
@@ -2,6 +2,7 @@ package app
 
 import (
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/garyburd/redigo/redis"
@@ -10,39 +11,82 @@ import (
 // Context in request
 type Context struct {
 	RedisConn               redis.Conn
+	RedisPool               *redis.Pool
 	Request                 *http.Request
+	BaseURL                 string
+	Secret                  []byte
 	SalesforceClientSecret  string
 	SalesforceClientID      string
 	SlackClientSecret       string
 	SlackClientID           string
 	UserID                  string
-	StateStoreKey           string
 	SalesforceTokenStoreKey string
 	SlackTokenStoreKey      string
 	NotifyChannelStoreKey   string
+	TimeZoneStoreKey        string
+	PunchQueueStoreKey      string
+	TimeTableCacheStoreKey  string
+	TokenHealthStoreKey     string
+	APITokenStoreKey        string
+	WebhookStoreKey         string
+	PresenceStoreKey        string
+	ScheduleStoreKey        string
+	RestPolicyStoreKey      string
+	ComplianceStoreKey      string
+	CalendarStoreKey        string
+	HolidayWorkStoreKey     string
 	TeamSpiritHost          string
 	SlackVerificationToken  string
 	TimeoutDuration         time.Duration
+	DayBoundaryHour         int
+	RequestTimeout          time.Duration
+	RequestRetries          int
+	TimeTableCacheTTL       time.Duration
+	TokenCheckInterval      time.Duration
 	TimeTableClient         *timeTableClient
 	randomString            func(len int) string
+	now                     func() time.Time
+	location                *time.Location
+	webhookDeliveries       *sync.WaitGroup
 }
 
 func (app *App) createContext(r *http.Request) *Context {
 	return &Context{
 		RedisConn:               app.RedisConn,
+		RedisPool:               app.RedisPool,
+		BaseURL:                 app.BaseURL,
+		Secret:                  app.Secret,
 		SalesforceClientID:      app.SalesforceClientID,
 		SalesforceClientSecret:  app.SalesforceClientSecret,
 		SlackClientID:           app.SlackClientID,
 		SlackClientSecret:       app.SlackVerificationToken,
-		StateStoreKey:           app.StateStoreKey,
 		SalesforceTokenStoreKey: app.SalesforceTokenStoreKey,
 		SlackTokenStoreKey:      app.SlackTokenStoreKey,
 		NotifyChannelStoreKey:   app.NotifyChannelStoreKey,
+		TimeZoneStoreKey:        app.TimeZoneStoreKey,
+		PunchQueueStoreKey:      app.PunchQueueStoreKey,
+		TimeTableCacheStoreKey:  app.TimeTableCacheStoreKey,
+		TokenHealthStoreKey:     app.TokenHealthStoreKey,
+		APITokenStoreKey:        app.APITokenStoreKey,
+		WebhookStoreKey:         app.WebhookStoreKey,
+		PresenceStoreKey:        app.PresenceStoreKey,
+		ScheduleStoreKey:        app.ScheduleStoreKey,
+		RestPolicyStoreKey:      app.RestPolicyStoreKey,
+		ComplianceStoreKey:      app.ComplianceStoreKey,
+		CalendarStoreKey:        app.CalendarStoreKey,
+		HolidayWorkStoreKey:     app.HolidayWorkStoreKey,
 		TeamSpiritHost:          app.TeamSpiritHost,
 		SlackVerificationToken:  app.SlackVerificationToken,
 		TimeoutDuration:         app.TimeoutDuration,
+		DayBoundaryHour:         app.DayBoundaryHour,
+		RequestTimeout:          app.RequestTimeout,
+		RequestRetries:          app.RequestRetries,
+		TimeTableCacheTTL:       app.TimeTableCacheTTL,
+		TokenCheckInterval:      app.TokenCheckInterval,
 		Request:                 r,
 		randomString:            randomString,
+		now:                     time.Now,
+		webhookDeliveries:       &app.webhookDeliveries,
 	}
 }
 
@@ -14,7 +14,7 @@ func TestCreateContext(t *testing.T) {
 		{false, ctx.RedisConn == nil},
 		{"SALESFORCE_CLIENT_ID is set!", ctx.SalesforceClientID},
 		{"SALESFORCE_CLIENT_SECRET is set!", ctx.SalesforceClientSecret},
-		{"tsdakoku-test:states", ctx.StateStoreKey},
+		{"SESSION_SECRET is set!", string(ctx.Secret)},
 		{"tsdakoku-test:oauth_tokens", ctx.SalesforceTokenStoreKey},
 		{"teamspirit-1234.cloudforce.test", ctx.TeamSpiritHost},
 		{"SLACK_VERIFICATION_TOKEN is set!", ctx.SlackVerificationToken},
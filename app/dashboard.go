@@ -0,0 +1,322 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/nlopes/slack"
+	null "gopkg.in/guregu/null.v3"
+)
+
+const (
+	// dashboardSessionName is the cookie keeping the Slack user signed in to the dashboard
+	dashboardSessionName   = "ts-dakoku"
+	dashboardSessionExpiry = 7 * 24 * time.Hour
+)
+
+var (
+	dashboardTemplate = template.Must(template.New("dashboard").Parse(string(MustAsset("assets/dashboard.html"))))
+	emojiPattern      = regexp.MustCompile(` ?:[a-z0-9_+-]+:`)
+)
+
+type dashboard struct {
+	UserID                    string
+	Now                       string
+	State                     string
+	Items                     []dashboardItem
+	Actions                   []dashboardAction
+	SalesforceLinked          bool
+	SalesforceExpired         bool
+	SalesforceAuthenticateURL string
+	SlackLinked               bool
+	NotifyChannel             string
+	TimeZone                  string
+	Flashes                   []interface{}
+	Error                     string
+	CSRFToken                 string
+}
+
+type dashboardItem struct {
+	Label string
+	From  string
+	To    string
+}
+
+type dashboardAction struct {
+	Name    string
+	Text    string
+	Class   string
+	Confirm string
+}
+
+var buttonClasses = map[string]string{
+	"primary": "btn-primary",
+	"danger":  "btn-danger",
+	"default": "btn-secondary",
+}
+
+// stripEmoji removes Slack emoji codes from texts shared with the Slack messages
+func stripEmoji(text string) string {
+	return emojiPattern.ReplaceAllString(text, "")
+}
+
+func formatMinutes(minutes null.Int) string {
+	if !minutes.Valid {
+		return ""
+	}
+	return fmt.Sprintf("%02d:%02d", minutes.Int64/60, minutes.Int64%60)
+}
+
+func newDashboardItems(tt *timeTable) []dashboardItem {
+	items := []dashboardItem{}
+	for _, item := range tt.Items {
+		label := "休憩"
+		if item.IsAttendance() {
+			label = "勤務"
+		}
+		items = append(items, dashboardItem{
+			Label: label,
+			From:  formatMinutes(item.From),
+			To:    formatMinutes(item.To),
+		})
+	}
+	return items
+}
+
+func newDashboardActions(buttons []slack.AttachmentAction) []dashboardAction {
+	actions := []dashboardAction{}
+	for _, button := range buttons {
+		action := dashboardAction{
+			Name:  button.Name,
+			Text:  button.Text,
+			Class: buttonClasses[button.Style],
+		}
+		if button.Confirm != nil {
+			action.Confirm = button.Confirm.Text
+		}
+		actions = append(actions, action)
+	}
+	return actions
+}
+
+func (app *App) getDashboardSession(r *http.Request) *sessions.Session {
+	session, _ := app.SessionStore.Get(r, dashboardSessionName)
+	session.Options = &sessions.Options{
+		Path:     "/",
+		MaxAge:   int(dashboardSessionExpiry / time.Second),
+		Secure:   app.isSecure(),
+		HttpOnly: true,
+	}
+	return session
+}
+
+func (app *App) isSecure() bool {
+	u, err := url.Parse(app.BaseURL)
+	return err == nil && u.Scheme == "https"
+}
+
+// getCSRFToken returns the token embedded in the forms of the session
+func (app *App) getCSRFToken(session *sessions.Session) string {
+	if token, ok := session.Values["csrf_token"].(string); ok && token != "" {
+		return token
+	}
+	token := randomString(32)
+	session.Values["csrf_token"] = token
+	return token
+}
+
+// getDashboardContext returns the context of the signed in user, or nil with the error response written
+func (app *App) getDashboardContext(w http.ResponseWriter, r *http.Request) (*Context, *sessions.Session) {
+	app.reconnectRedisIfNeeeded()
+	session := app.getDashboardSession(r)
+	userID, _ := session.Values["user_id"].(string)
+	if userID == "" {
+		http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
+		return nil, nil
+	}
+	token, _ := session.Values["csrf_token"].(string)
+	if token == "" || r.PostFormValue("csrf_token") != token {
+		http.Error(w, "invalid CSRF token", http.StatusForbidden)
+		return nil, nil
+	}
+	ctx := app.createContext(r)
+	ctx.UserID = userID
+	return ctx, session
+}
+
+func (app *App) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	app.reconnectRedisIfNeeeded()
+	session := app.getDashboardSession(r)
+	data := dashboard{}
+	if userID, _ := session.Values["user_id"].(string); userID != "" {
+		ctx := app.createContext(r)
+		ctx.UserID = userID
+		teamID, _ := session.Values["team_id"].(string)
+		data = ctx.getDashboard(r.Context(), teamID)
+		data.Flashes = session.Flashes()
+		data.CSRFToken = app.getCSRFToken(session)
+	}
+	if err := session.Save(r, w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	dashboardTemplate.Execute(w, data)
+}
+
+func (ctx *Context) getDashboard(c context.Context, teamID string) dashboard {
+	now := ctx.getCurrentTimeForUser()
+	data := dashboard{
+		UserID:           ctx.UserID,
+		Now:              now.Format("2006/01/02 ") + formatTime(now),
+		SalesforceLinked: ctx.getSalesforceAccessTokenForUser() != nil,
+		SlackLinked:      ctx.getSlackAccessTokenForUser() != "",
+		NotifyChannel:    ctx.getSlackNotifyChannelForUser(),
+		TimeZone:         ctx.getVariableInHash(ctx.TimeZoneStoreKey, ctx.UserID),
+	}
+	data.SalesforceExpired = data.SalesforceLinked && !ctx.getTokenHealth().NotifiedAt.IsZero()
+	if !data.SalesforceLinked || data.SalesforceExpired {
+		if stateKey, err := ctx.storeState(State{TeamID: teamID}); err == nil {
+			data.SalesforceAuthenticateURL = ctx.getSalesforceAuthenticateURL(stateKey)
+		}
+		return data
+	}
+	client := ctx.createTimeTableClient(c)
+	timeTable, err := ctx.getCurrentTimeTable(c, client, now)
+	if err != nil {
+		data.Error = stripEmoji(getTimeTableErrorText("勤務表の取得に失敗しました", err))
+		return data
+	}
+	state := timeTable.State()
+	data.State = state.String()
+	data.Items = newDashboardItems(timeTable)
+	data.Actions = newDashboardActions(ctx.getAttendanceButtons(teamID, timeTable, now))
+	return data
+}
+
+func (app *App) handleDashboardPunch(w http.ResponseWriter, r *http.Request) {
+	ctx, session := app.getDashboardContext(w, r)
+	if ctx == nil {
+		return
+	}
+	teamID, _ := session.Values["team_id"].(string)
+	session.AddFlash(stripEmoji(ctx.punchFromDashboard(r.Context(), teamID, r.PostFormValue("action"))))
+	session.Save(r, w)
+	http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
+}
+
+// punchFromDashboard applies the action like the buttons in Slack, and returns the message to show
+func (ctx *Context) punchFromDashboard(c context.Context, teamID, action string) string {
+	if _, ok := attendanceButtons[action]; !ok {
+		return "不明な操作です"
+	}
+	now := ctx.getCurrentTimeForUser()
+	result, err := ctx.punch(c, ctx.createTimeTableClient(c), queuedPunch{TeamID: teamID, Action: action, Time: now})
+	if err == errNotAuthenticated {
+		return "TeamSpirit で認証を行ってください"
+	}
+	if result.Queued != nil {
+		return "TeamSpirit に接続できないため打刻を保留しました: " + result.Queued.Describe(now.Location())
+	}
+	if refused, ok := err.(*punchRefusedError); ok {
+		return ctx.getRefusalSlackMessage(refused.State, action).Text
+	}
+	if blocked, ok := err.(*complianceError); ok {
+		return blocked.Text()
+	}
+	if err != nil {
+		return getTimeTableErrorText("勤務表の更新に失敗しました", err)
+	}
+	text := attendanceActionTexts[action] + " (" + formatTime(now) + ")"
+	ctx.notifyPunch(text)
+	return text + getAddedRestText(result.Rest) + getComplianceWarningText(result.Warnings)
+}
+
+func (app *App) handleDashboardSettings(w http.ResponseWriter, r *http.Request) {
+	ctx, session := app.getDashboardContext(w, r)
+	if ctx == nil {
+		return
+	}
+	if _, ok := r.PostForm["notify_channel"]; ok && r.PostFormValue("notify_channel") == "" {
+		ctx.setVariableInHash(ctx.NotifyChannelStoreKey, "")
+		session.AddFlash("通知を止めました")
+	}
+	if _, ok := r.PostForm["time_zone"]; ok {
+		if err := ctx.setTimeZoneForUser(r.PostFormValue("time_zone")); err != nil {
+			session.AddFlash("タイムゾーン " + r.PostFormValue("time_zone") + " が見つかりません")
+		} else {
+			session.AddFlash("タイムゾーンを保存しました")
+		}
+	}
+	session.Save(r, w)
+	http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
+}
+
+func (app *App) handleLogin(w http.ResponseWriter, r *http.Request) {
+	app.reconnectRedisIfNeeeded()
+	ctx := app.createContext(r)
+	stateKey, err := ctx.storeState(State{})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	session := app.getDashboardSession(r)
+	session.Values["login_state"] = stateKey
+	if err := session.Save(r, w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	q := url.Values{
+		"client_id":    []string{app.SlackClientID},
+		"redirect_uri": []string{ctx.getSlackLoginCallbackURL()},
+		"state":        []string{stateKey},
+		"scope":        []string{"identity.basic"},
+	}
+	http.Redirect(w, r, "https://slack.com/oauth/authorize?"+q.Encode(), http.StatusSeeOther)
+}
+
+func (app *App) handleLoginCallback(w http.ResponseWriter, r *http.Request) {
+	app.reconnectRedisIfNeeeded()
+	ctx := app.createContext(r)
+	stateKey := r.URL.Query().Get("state")
+	session := app.getDashboardSession(r)
+	if ctx.getState(stateKey) == nil || session.Values["login_state"] != stateKey {
+		app.handleAuthError(w, r)
+		return
+	}
+	res, err := slack.GetOAuthResponse(app.SlackClientID, app.SlackClientSecret, r.URL.Query().Get("code"), ctx.getSlackLoginCallbackURL(), false)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	identity, err := slack.New(res.AccessToken).GetUserIdentity()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	delete(session.Values, "login_state")
+	session.Values["user_id"] = identity.User.ID
+	session.Values["team_id"] = identity.Team.ID
+	session.Values["csrf_token"] = randomString(32)
+	if err := session.Save(r, w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/dashboard", http.StatusFound)
+}
+
+func (app *App) handleLogout(w http.ResponseWriter, r *http.Request) {
+	_, session := app.getDashboardContext(w, r)
+	if session == nil {
+		return
+	}
+	session.Options.MaxAge = -1
+	session.Save(r, w)
+	http.Redirect(w, r, "/dashboard", http.StatusSeeOther)
+}
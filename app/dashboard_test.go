@@ -0,0 +1,235 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/nlopes/slack"
+	"golang.org/x/oauth2"
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func signInDashboard(app *App, userID string) []*http.Cookie {
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/dashboard", nil)
+	session := app.getDashboardSession(req)
+	session.Values["user_id"] = userID
+	session.Values["team_id"] = "T12345678"
+	session.Values["csrf_token"] = "csrf"
+	session.Save(req, res)
+	return res.Result().Cookies()
+}
+
+func newDashboardRequest(method, path string, form url.Values, cookies []*http.Cookie) *http.Request {
+	req, _ := http.NewRequest(method, "https://example.com"+path, strings.NewReader(form.Encode()))
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	return req
+}
+
+func TestHandleDashboardSignedOut(t *testing.T) {
+	app := createMockApp()
+	res := httptest.NewRecorder()
+	app.setupRouter().ServeHTTP(res, newDashboardRequest(http.MethodGet, "/dashboard", nil, nil))
+	for _, test := range []Test{
+		{200, res.Code},
+		{true, strings.Contains(res.Body.String(), "Sign in with Slack")},
+		{false, strings.Contains(res.Body.String(), "サインアウト")},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestHandleLogin(t *testing.T) {
+	defer gock.Off()
+	defer gock.RestoreClient(slack.HTTPClient)
+	app := createMockApp()
+	app.CleanRedis()
+	res := httptest.NewRecorder()
+	app.setupRouter().ServeHTTP(res, newDashboardRequest(http.MethodGet, "/login", nil, nil))
+	location, _ := url.Parse(res.Header().Get("Location"))
+	state := location.Query().Get("state")
+	for _, test := range []Test{
+		{303, res.Code},
+		{"slack.com", location.Host},
+		{"identity.basic", location.Query().Get("scope")},
+		{"https://example.com/login/callback", location.Query().Get("redirect_uri")},
+	} {
+		test.Compare(t)
+	}
+
+	gock.New("https://slack.com").
+		Post("/api/oauth.access").
+		Reply(200).
+		JSON(map[string]interface{}{"ok": true, "access_token": "xoxp-identity"})
+	gock.New("https://slack.com").
+		Post("/api/users.identity").
+		Reply(200).
+		JSON(map[string]interface{}{
+			"ok":   true,
+			"user": map[string]interface{}{"id": "FOO", "name": "foo"},
+			"team": map[string]interface{}{"id": "T12345678"},
+		})
+	client := &http.Client{Transport: &http.Transport{}}
+	gock.InterceptClient(client)
+	slack.SetHTTPClient(client)
+
+	cookies := res.Result().Cookies()
+	res = httptest.NewRecorder()
+	app.setupRouter().ServeHTTP(res, newDashboardRequest(http.MethodGet, "/login/callback?code=foo&state=unknown", nil, cookies))
+	Test{400, res.Code}.Compare(t)
+
+	res = httptest.NewRecorder()
+	app.setupRouter().ServeHTTP(res, newDashboardRequest(http.MethodGet, "/login/callback?code=foo&state="+url.QueryEscape(state), nil, cookies))
+	session := app.getDashboardSession(newDashboardRequest(http.MethodGet, "/dashboard", nil, res.Result().Cookies()))
+	for _, test := range []Test{
+		{302, res.Code},
+		{"/dashboard", res.Header().Get("Location")},
+		{true, gock.IsDone()},
+		{"FOO", session.Values["user_id"]},
+		{"T12345678", session.Values["team_id"]},
+		{nil, session.Values["login_state"]},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestHandleDashboard(t *testing.T) {
+	defer gock.Off()
+	app := createMockApp()
+	app.CleanRedis()
+	cookies := signInDashboard(app, "FOO")
+
+	res := httptest.NewRecorder()
+	app.setupRouter().ServeHTTP(res, newDashboardRequest(http.MethodGet, "/dashboard", nil, cookies))
+	body := res.Body.String()
+	for _, test := range []Test{
+		{200, res.Code},
+		{true, strings.Contains(body, "https://example.com/oauth/salesforce/authenticate/")},
+		{true, strings.Contains(body, "未連携")},
+		{false, strings.Contains(body, "出勤する")},
+	} {
+		test.Compare(t)
+	}
+
+	ctx := app.createContext(nil)
+	ctx.UserID = "FOO"
+	ctx.setSalesforceAccessToken(&oauth2.Token{AccessToken: "foo", RefreshToken: "bar", TokenType: "Bearer"})
+	ctx.setSlackAccessToken("xoxp-foo")
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Get("/services/apexrest/Dakoku").
+		Reply(200).
+		JSON(map[string]interface{}{
+			"timeTable": []map[string]interface{}{{"from": 0, "to": nil, "type": 1}},
+			"isHoliday": false,
+		})
+	res = httptest.NewRecorder()
+	app.setupRouter().ServeHTTP(res, newDashboardRequest(http.MethodGet, "/dashboard", nil, cookies))
+	body = res.Body.String()
+	for _, test := range []Test{
+		{200, res.Code},
+		{true, gock.IsDone()},
+		{true, strings.Contains(body, "<strong>勤務中</strong>")},
+		{true, strings.Contains(body, "<td>勤務</td><td>00:00</td><td></td>")},
+		{true, strings.Contains(body, `value="rest"`)},
+		{true, strings.Contains(body, `value="leave"`)},
+		{false, strings.Contains(body, `value="attend"`)},
+		{true, strings.Contains(body, "連携済")},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestHandleDashboardPunch(t *testing.T) {
+	defer gock.Off()
+	app := createMockApp()
+	app.CleanRedis()
+	cookies := signInDashboard(app, "FOO")
+	ctx := app.createContext(nil)
+	ctx.UserID = "FOO"
+	ctx.setSalesforceAccessToken(&oauth2.Token{AccessToken: "foo", RefreshToken: "bar", TokenType: "Bearer"})
+
+	res := httptest.NewRecorder()
+	app.setupRouter().ServeHTTP(res, newDashboardRequest(http.MethodPost, "/dashboard/punch", url.Values{"action": {"rest"}}, cookies))
+	Test{403, res.Code}.Compare(t)
+
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Get("/services/apexrest/Dakoku").
+		Reply(200).
+		JSON(map[string]interface{}{
+			"timeTable": []map[string]interface{}{{"from": 0, "to": nil, "type": 1}},
+			"isHoliday": false,
+		})
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Post("/services/apexrest/Dakoku").
+		Reply(200).
+		BodyString(`"OK"`)
+	res = httptest.NewRecorder()
+	app.setupRouter().ServeHTTP(res, newDashboardRequest(http.MethodPost, "/dashboard/punch", url.Values{"action": {"rest"}, "csrf_token": {"csrf"}}, cookies))
+	session := app.getDashboardSession(newDashboardRequest(http.MethodGet, "/dashboard", nil, res.Result().Cookies()))
+	flashes := session.Flashes()
+	for _, test := range []Test{
+		{303, res.Code},
+		{"/dashboard", res.Header().Get("Location")},
+		{true, gock.IsDone()},
+		{1, len(flashes)},
+		{true, strings.HasPrefix(flashes[0].(string), "休憩を開始しました (")},
+	} {
+		test.Compare(t)
+	}
+
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Get("/services/apexrest/Dakoku").
+		Reply(200).
+		JSON(map[string]interface{}{
+			"timeTable": []map[string]interface{}{{"from": 0, "to": nil, "type": 1}},
+			"isHoliday": false,
+		})
+	Test{"現在は勤務中のため「休憩を終了する」はできません", stripEmoji(ctx.punchFromDashboard(newDashboardRequest(http.MethodGet, "/", nil, nil).Context(), "T12345678", actionTypeUnrest))}.Compare(t)
+	Test{"不明な操作です", ctx.punchFromDashboard(newDashboardRequest(http.MethodGet, "/", nil, nil).Context(), "T12345678", "foo")}.Compare(t)
+}
+
+func TestHandleDashboardSettings(t *testing.T) {
+	app := createMockApp()
+	app.CleanRedis()
+	cookies := signInDashboard(app, "FOO")
+	ctx := app.createContext(nil)
+	ctx.UserID = "FOO"
+	ctx.setVariableInHash(ctx.NotifyChannelStoreKey, "C12345678")
+
+	res := httptest.NewRecorder()
+	app.setupRouter().ServeHTTP(res, newDashboardRequest(http.MethodPost, "/dashboard/settings", url.Values{"notify_channel": {""}, "csrf_token": {"csrf"}}, cookies))
+	Test{303, res.Code}.Compare(t)
+	Test{"", ctx.getSlackNotifyChannelForUser()}.Compare(t)
+
+	res = httptest.NewRecorder()
+	app.setupRouter().ServeHTTP(res, newDashboardRequest(http.MethodPost, "/dashboard/settings", url.Values{"time_zone": {"America/Los_Angeles"}, "csrf_token": {"csrf"}}, cookies))
+	Test{303, res.Code}.Compare(t)
+	Test{"America/Los_Angeles", ctx.getVariableInHash(ctx.TimeZoneStoreKey, "FOO")}.Compare(t)
+
+	res = httptest.NewRecorder()
+	app.setupRouter().ServeHTTP(res, newDashboardRequest(http.MethodPost, "/dashboard/settings", url.Values{"time_zone": {"Mars/Olympus"}, "csrf_token": {"csrf"}}, cookies))
+	session := app.getDashboardSession(newDashboardRequest(http.MethodGet, "/dashboard", nil, res.Result().Cookies()))
+	Test{[]interface{}{"タイムゾーン Mars/Olympus が見つかりません"}, session.Flashes()}.DeepEqual(t)
+	Test{"America/Los_Angeles", ctx.getVariableInHash(ctx.TimeZoneStoreKey, "FOO")}.Compare(t)
+}
+
+func TestHandleLogout(t *testing.T) {
+	app := createMockApp()
+	cookies := signInDashboard(app, "FOO")
+	res := httptest.NewRecorder()
+	app.setupRouter().ServeHTTP(res, newDashboardRequest(http.MethodPost, "/logout", url.Values{"csrf_token": {"csrf"}}, cookies))
+	for _, test := range []Test{
+		{303, res.Code},
+		{true, strings.Contains(res.Header().Get("Set-Cookie"), "Max-Age=0")},
+	} {
+		test.Compare(t)
+	}
+}
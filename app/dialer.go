@@ -0,0 +1,54 @@
+package app
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+var errInternalAddress = errors.New("connecting to internal addresses is not allowed")
+
+// externalTransport connects only to public addresses, for the URLs given by users.
+// Tests set it to nil to reach local servers and mocks through http.DefaultTransport.
+var externalTransport http.RoundTripper = newExternalTransport()
+
+// isInternalIP reports whether the IP is loopback, link-local, private or otherwise not on the internet
+func isInternalIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsPrivate() || ip.IsUnspecified()
+}
+
+// checkExternalAddress is the Control of the dialer, called with the resolved address
+// so that host names pointing to internal addresses are rejected as well
+func checkExternalAddress(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || isInternalIP(ip) {
+		return errInternalAddress
+	}
+	return nil
+}
+
+func newExternalTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   checkExternalAddress,
+	}
+	// Proxies are not used, as the address of the proxy would be checked instead of the destination
+	return &http.Transport{
+		DialContext:         dialer.DialContext,
+		MaxIdleConns:        10,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+}
+
+// newExternalHTTPClient returns the client to request the URLs given by users
+func (ctx *Context) newExternalHTTPClient() *http.Client {
+	return &http.Client{Timeout: ctx.RequestTimeout, Transport: externalTransport}
+}
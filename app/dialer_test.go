@@ -0,0 +1,50 @@
+package app
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIsInternalIP(t *testing.T) {
+	for _, test := range []struct {
+		ip       string
+		expected bool
+	}{
+		{"127.0.0.1", true},
+		{"::1", true},
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"192.168.1.1", true},
+		{"169.254.169.254", true},
+		{"fe80::1", true},
+		{"fd00::1", true},
+		{"0.0.0.0", true},
+		{"::ffff:127.0.0.1", true},
+		{"93.184.216.34", false},
+		{"2606:2800:220:1:248:1893:25c8:1946", false},
+	} {
+		Test{test.expected, isInternalIP(net.ParseIP(test.ip))}.Compare(t)
+	}
+}
+
+func TestDeliverWebhookToInternalAddress(t *testing.T) {
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := createTestContext(app)
+	requested := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = true
+	}))
+	defer server.Close()
+	_, retry, err := ctx.postWebhook(ctx.newExternalHTTPClient(), webhook{URL: server.URL}, []byte("{}"))
+	for _, test := range []Test{
+		{false, requested},
+		{false, retry},
+		{true, errors.Is(err, errInternalAddress)},
+	} {
+		test.Compare(t)
+	}
+}
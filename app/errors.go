@@ -0,0 +1,136 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var errTimeTableConflict = errors.New("time table was modified by another request")
+var errTimeTableUnavailable = errors.New("TeamSpirit is temporarily unavailable")
+var errTimeTableDateUnsupported = errors.New("Apex class does not support the date parameter")
+var errHolidayWorkNotApplied = errors.New("TeamSpirit requires the application of holiday work")
+
+// timeTableAuthError is returned when the access token is expired or revoked
+type timeTableAuthError struct {
+	Err error
+}
+
+// timeTableNotFoundError is returned when the Dakoku Apex class is not deployed
+type timeTableNotFoundError struct {
+	Err error
+}
+
+// timeTableBusinessError is returned when TeamSpirit refused the punch
+type timeTableBusinessError struct {
+	Response string
+}
+
+// timeTableRateLimitError is returned when the API request limit is exceeded
+type timeTableRateLimitError struct {
+	Err error
+}
+
+// timeTableNetworkError is returned when TeamSpirit could not be reached
+type timeTableNetworkError struct {
+	Err error
+}
+
+func (err *timeTableAuthError) Error() string {
+	return err.Err.Error()
+}
+
+func (err *timeTableNotFoundError) Error() string {
+	return err.Err.Error()
+}
+
+func (err *timeTableBusinessError) Error() string {
+	return "TeamSpirit responded " + err.Response
+}
+
+func (err *timeTableRateLimitError) Error() string {
+	return err.Err.Error()
+}
+
+func (err *timeTableNetworkError) Error() string {
+	return err.Err.Error()
+}
+
+func (err timeTableError) toError() error {
+	e := fmt.Errorf("Error: %+v (%+v)", err.Message, err.Code)
+	switch err.Code {
+	case "INVALID_SESSION_ID", "INVALID_AUTH_HEADER":
+		return &timeTableAuthError{e}
+	case "NOT_FOUND":
+		return &timeTableNotFoundError{e}
+	case "REQUEST_LIMIT_EXCEEDED":
+		return &timeTableRateLimitError{e}
+	}
+	return e
+}
+
+// newTimeTableRequestError classifies errors returned by http.Client.Do
+func newTimeTableRequestError(err error) error {
+	inner := err
+	if urlErr, ok := err.(*url.Error); ok {
+		inner = urlErr.Err
+	}
+	// The vendored oauth2 package reports token refresh failures only as formatted errors like
+	// "oauth2: cannot fetch token: 400 Bad Request\nResponse: {...}". Only a rejected refresh token
+	// requires the user to log in again, and outages of the token endpoint are retried.
+	if msg := inner.Error(); strings.HasPrefix(msg, "oauth2: cannot fetch token: ") {
+		status := strings.TrimPrefix(msg, "oauth2: cannot fetch token: ")
+		if (strings.HasPrefix(status, "400 ") || strings.HasPrefix(status, "401 ")) && strings.Contains(msg, "invalid_grant") {
+			return &timeTableAuthError{err}
+		}
+		return &timeTableNetworkError{err}
+	}
+	if _, ok := inner.(net.Error); ok {
+		return &timeTableNetworkError{err}
+	}
+	return err
+}
+
+// newTimeTableResponseError classifies error responses by their status codes
+func newTimeTableResponseError(res *http.Response, body []byte) error {
+	var errors []timeTableError
+	if err := json.Unmarshal(body, &errors); err == nil && len(errors) > 0 && errors[0].Code != "" {
+		if err := errors[0].toError(); err != nil && res.StatusCode != http.StatusConflict {
+			return err
+		}
+	}
+	e := fmt.Errorf("TeamSpirit responded with status %d", res.StatusCode)
+	switch {
+	case res.StatusCode == http.StatusConflict || string(body) == `"CONFLICT"`:
+		return errTimeTableConflict
+	case res.StatusCode == http.StatusUnauthorized:
+		return &timeTableAuthError{e}
+	case res.StatusCode == http.StatusNotFound:
+		return &timeTableNotFoundError{e}
+	case res.StatusCode == http.StatusTooManyRequests:
+		return &timeTableRateLimitError{e}
+	case res.StatusCode >= http.StatusInternalServerError:
+		return &timeTableNetworkError{errTimeTableUnavailable}
+	case res.StatusCode >= http.StatusBadRequest:
+		return e
+	}
+	return nil
+}
+
+// isTemporaryError returns true if the request may succeed when retried later
+func isTemporaryError(err error) bool {
+	switch err.(type) {
+	case *timeTableNetworkError, *timeTableRateLimitError:
+		return true
+	}
+	return false
+}
+
+func isAuthError(err error) bool {
+	_, ok := err.(*timeTableAuthError)
+	return ok
+}
@@ -0,0 +1,71 @@
+package app
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestNewTimeTableResponseError(t *testing.T) {
+	for _, test := range []struct {
+		status   int
+		body     string
+		expected string
+	}{
+		{200, `{"timeTable":[]}`, "<nil>"},
+		{200, `"NG"`, "<nil>"},
+		{401, `[{"message":"Session expired or invalid","errorCode":"INVALID_SESSION_ID"}]`, "*app.timeTableAuthError"},
+		{401, ``, "*app.timeTableAuthError"},
+		{404, `[{"message":"Could not find a match for URL","errorCode":"NOT_FOUND"}]`, "*app.timeTableNotFoundError"},
+		{403, `[{"message":"TotalRequests Limit exceeded.","errorCode":"REQUEST_LIMIT_EXCEEDED"}]`, "*app.timeTableRateLimitError"},
+		{429, ``, "*app.timeTableRateLimitError"},
+		{503, ``, "*app.timeTableNetworkError"},
+		{400, `[{"message":"Bad","errorCode":"JSON_PARSER_ERROR"}]`, "*errors.errorString"},
+	} {
+		err := newTimeTableResponseError(&http.Response{StatusCode: test.status}, []byte(test.body))
+		Test{test.expected, typeName(err)}.Compare(t)
+	}
+	err := newTimeTableResponseError(&http.Response{StatusCode: 409}, []byte(`"CONFLICT"`))
+	Test{errTimeTableConflict, err}.Compare(t)
+}
+
+func TestNewTimeTableRequestError(t *testing.T) {
+	for _, test := range []struct {
+		err      error
+		expected string
+	}{
+		{&url.Error{Op: "Get", URL: "https://example.com", Err: errors.New("oauth2: cannot fetch token: 400 Bad Request\nResponse: {\"error\":\"invalid_grant\"}")}, "*app.timeTableAuthError"},
+		{&url.Error{Op: "Get", URL: "https://example.com", Err: errors.New("oauth2: cannot fetch token: 401 Unauthorized\nResponse: {\"error\":\"invalid_grant\"}")}, "*app.timeTableAuthError"},
+		{&url.Error{Op: "Get", URL: "https://example.com", Err: errors.New("oauth2: cannot fetch token: 503 Service Unavailable\nResponse: <html>invalid_grant</html>")}, "*app.timeTableNetworkError"},
+		{&url.Error{Op: "Get", URL: "https://example.com", Err: errors.New("oauth2: cannot fetch token: 500 Internal Server Error\nResponse: ")}, "*app.timeTableNetworkError"},
+		{&url.Error{Op: "Get", URL: "https://example.com", Err: errors.New("oauth2: cannot fetch token: 400 Bad Request\nResponse: {\"error\":\"invalid_client_id\"}")}, "*app.timeTableNetworkError"},
+		{&url.Error{Op: "Get", URL: "https://example.com", Err: errors.New("oauth2: cannot fetch token: dial tcp: i/o timeout")}, "*app.timeTableNetworkError"},
+		{&url.Error{Op: "Get", URL: "https://example.com", Err: &net.DNSError{Err: "no such host", Name: "example.com"}}, "*app.timeTableNetworkError"},
+		{errors.New("omg"), "*errors.errorString"},
+	} {
+		Test{test.expected, typeName(newTimeTableRequestError(test.err))}.Compare(t)
+	}
+}
+
+func TestIsTemporaryError(t *testing.T) {
+	for _, test := range []Test{
+		{true, isTemporaryError(&timeTableNetworkError{errTimeTableUnavailable})},
+		{true, isTemporaryError(&timeTableRateLimitError{errors.New("limit")})},
+		{false, isTemporaryError(&timeTableAuthError{errors.New("auth")})},
+		{false, isTemporaryError(errTimeTableConflict)},
+		{true, isAuthError(&timeTableAuthError{errors.New("auth")})},
+		{false, isAuthError(&timeTableBusinessError{`"NG"`})},
+	} {
+		test.Compare(t)
+	}
+}
+
+func typeName(err error) string {
+	if err == nil {
+		return "<nil>"
+	}
+	return reflect.TypeOf(err).String()
+}
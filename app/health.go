@@ -0,0 +1,158 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/nlopes/slack"
+	"golang.org/x/oauth2"
+)
+
+// tokenHealth is the result of the last health check of the Salesforce token of the user
+type tokenHealth struct {
+	TeamID     string    `json:"teamId,omitempty"`
+	CheckedAt  time.Time `json:"checkedAt,omitempty"`
+	NotifiedAt time.Time `json:"notifiedAt,omitempty"`
+}
+
+func (ctx *Context) getTokenHealth() tokenHealth {
+	var health tokenHealth
+	if data := ctx.getVariableInHash(ctx.TokenHealthStoreKey, ctx.UserID); data != "" {
+		json.Unmarshal([]byte(data), &health)
+	}
+	return health
+}
+
+func (ctx *Context) setTokenHealth(health tokenHealth) error {
+	data, err := json.Marshal(health)
+	if err != nil {
+		return err
+	}
+	return ctx.setVariableInHash(ctx.TokenHealthStoreKey, data)
+}
+
+func (ctx *Context) getSalesforceUserInfoURL() string {
+	return strings.TrimSuffix(ctx.getSalesforceOAuth2Config().Endpoint.TokenURL, "token") + "userinfo"
+}
+
+// validateSalesforceToken calls the userinfo endpoint, refreshing the token once when it is rejected
+func (ctx *Context) validateSalesforceToken(c context.Context, src *salesforceTokenSource) error {
+	for retry := 0; ; retry++ {
+		client := oauth2.NewClient(c, src)
+		client.Timeout = ctx.RequestTimeout
+		res, err := client.Get(ctx.getSalesforceUserInfoURL())
+		if err != nil {
+			return newTimeTableRequestError(err)
+		}
+		res.Body.Close()
+		switch {
+		case res.StatusCode == http.StatusOK:
+			return nil
+		case res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden:
+			if retry > 0 {
+				return &timeTableAuthError{errors.New("Salesforce rejected the token: " + res.Status)}
+			}
+			if _, err := src.refresh(); err != nil {
+				return newTimeTableRequestError(err)
+			}
+		default:
+			return &timeTableNetworkError{errors.New("Salesforce responded with " + res.Status)}
+		}
+	}
+}
+
+// checkSalesforceToken refreshes the token of the user when it is about to expire,
+// and asks the user to authenticate again when it has been revoked
+func (ctx *Context) checkSalesforceToken(c context.Context) error {
+	token := ctx.getSalesforceAccessTokenForUser()
+	if token == nil {
+		return nil
+	}
+	health := ctx.getTokenHealth()
+	now := ctx.now()
+	// the button in the message expires with its state, so notify again after that
+	if !health.NotifiedAt.IsZero() && now.Sub(health.NotifiedAt) < stateExpiry {
+		return nil
+	}
+	src := ctx.newSalesforceTokenSource(c, token)
+	var err error
+	if token.Expiry.Sub(now) < ctx.TokenCheckInterval {
+		if _, err = src.refresh(); err != nil {
+			err = newTimeTableRequestError(err)
+		}
+	}
+	if err == nil {
+		err = ctx.validateSalesforceToken(c, src)
+	}
+	health.CheckedAt = now
+	if err == nil {
+		health.NotifiedAt = time.Time{}
+	}
+	if isAuthError(err) && ctx.notifyRevokedToken(health) == nil {
+		health.NotifiedAt = now
+	}
+	ctx.setTokenHealth(health)
+	return err
+}
+
+func (ctx *Context) notifyRevokedToken(health tokenHealth) error {
+	slackToken := ctx.getSlackAccessTokenForUser()
+	if slackToken == "" {
+		return errors.New("user can not be notified")
+	}
+	msg, err := ctx.getLoginSlackMessage(State{TeamID: health.TeamID, UserID: ctx.UserID})
+	if err != nil {
+		return err
+	}
+	now := ctx.getCurrentTimeForUser()
+	when := "本日"
+	if day := ctx.getNextWorkingDay(health.TeamID, now); day.Format("2006-01-02") != now.Format("2006-01-02") {
+		when = "次の出勤日 " + day.Format("1/2") + " (" + scheduleWeekdayTexts[day.Weekday()] + ") "
+	}
+	_, _, err = slack.New(slackToken).PostMessage(ctx.UserID, "TeamSpirit の認証が切れています。"+when+"の打刻の前に再度認証してください :key:", slack.PostMessageParameters{
+		AsUser:      true,
+		Attachments: msg.Attachments,
+	})
+	return err
+}
+
+func (ctx *Context) getTokenHealthLockKey() string {
+	return ctx.TokenHealthStoreKey + ":lock:" + ctx.UserID
+}
+
+func (app *App) checkSalesforceTokens() {
+	conn, err := app.getWorkerConn()
+	if err != nil {
+		log.Println("Failed to check the Salesforce tokens: " + err.Error())
+		return
+	}
+	defer conn.Close()
+	userIDs, err := redis.Strings(conn.Do("HKEYS", app.SalesforceTokenStoreKey))
+	if err != nil {
+		log.Println("Failed to check the Salesforce tokens: " + err.Error())
+		return
+	}
+	for _, userID := range userIDs {
+		ctx := app.createWorkerContext(conn, userID)
+		unlock, ok := ctx.tryLock(ctx.getTokenHealthLockKey(), backgroundTaskTimeout)
+		if !ok {
+			continue
+		}
+		c, cancel := context.WithTimeout(context.Background(), backgroundTaskTimeout)
+		ctx.checkSalesforceToken(c)
+		cancel()
+		unlock()
+	}
+}
+
+func (app *App) runTokenHealthWorker() {
+	for range time.Tick(app.TokenCheckInterval) {
+		app.checkSalesforceTokens()
+	}
+}
@@ -0,0 +1,203 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/nlopes/slack"
+	"golang.org/x/oauth2"
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+// setupTokenHealth stores the Salesforce token expiring at the time, with the Slack token to notify the user
+func setupTokenHealth(ctx *Context, expiry time.Time) {
+	ctx.setSalesforceAccessToken(&oauth2.Token{
+		AccessToken:  "foo",
+		RefreshToken: "bar",
+		TokenType:    "Bearer",
+		Expiry:       expiry,
+	})
+	ctx.setSlackAccessToken("xoxp-foo")
+	ctx.setTokenHealth(tokenHealth{TeamID: "T12345678"})
+}
+
+func TestCheckSalesforceToken(t *testing.T) {
+	defer gock.Off()
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := createTestContext(app)
+	setupTokenHealth(ctx, time.Now().Add(2*time.Hour))
+	gock.New("https://test.salesforce.com").
+		Get("/services/oauth2/userinfo").
+		MatchHeader("Authorization", "Bearer foo").
+		Reply(200).
+		JSON(map[string]interface{}{"user_id": "005"})
+	err := ctx.checkSalesforceToken(context.Background())
+	health := ctx.getTokenHealth()
+	for _, test := range []Test{
+		{nil, err},
+		{true, gock.IsDone()},
+		{false, health.CheckedAt.IsZero()},
+		{true, health.NotifiedAt.IsZero()},
+		{"T12345678", health.TeamID},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestCheckSalesforceTokenNearingExpiry(t *testing.T) {
+	defer gock.Off()
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := createTestContext(app)
+	setupTokenHealth(ctx, getMockTime().Add(10*time.Minute))
+	gock.New("https://test.salesforce.com").
+		Post("/services/oauth2/token").
+		Reply(200).
+		JSON(map[string]interface{}{
+			"access_token": "foo2",
+			"token_type":   "Bearer",
+		})
+	gock.New("https://test.salesforce.com").
+		Get("/services/oauth2/userinfo").
+		MatchHeader("Authorization", "Bearer foo2").
+		Reply(200).
+		JSON(map[string]interface{}{"user_id": "005"})
+	err := ctx.checkSalesforceToken(context.Background())
+	token := ctx.getSalesforceAccessTokenForUser()
+	for _, test := range []Test{
+		{nil, err},
+		{true, gock.IsDone()},
+		{"foo2", token.AccessToken},
+		{"bar", token.RefreshToken},
+		{true, token.Expiry.After(time.Now().Add(30 * time.Minute))},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestCheckSalesforceTokenRefreshUnavailable(t *testing.T) {
+	defer gock.Off()
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := createTestContext(app)
+	setupTokenHealth(ctx, getMockTime().Add(10*time.Minute))
+	gock.New("https://test.salesforce.com").
+		Post("/services/oauth2/token").
+		Reply(503).
+		BodyString("Service Unavailable")
+	err := ctx.checkSalesforceToken(context.Background())
+	health := ctx.getTokenHealth()
+	for _, test := range []Test{
+		{false, isAuthError(err)},
+		{true, isTemporaryError(err)},
+		{true, gock.IsDone()},
+		{true, health.NotifiedAt.IsZero()},
+		{"foo", ctx.getSalesforceAccessTokenForUser().AccessToken},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestCheckSalesforceTokenRevoked(t *testing.T) {
+	defer gock.Off()
+	defer gock.RestoreClient(slack.HTTPClient)
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := createTestContext(app)
+	setupTokenHealth(ctx, time.Now().Add(2*time.Hour))
+	gock.New("https://test.salesforce.com").
+		Get("/services/oauth2/userinfo").
+		Reply(401)
+	gock.New("https://test.salesforce.com").
+		Post("/services/oauth2/token").
+		Reply(400).
+		JSON(map[string]interface{}{
+			"error":             "invalid_grant",
+			"error_description": "expired access/refresh token",
+		})
+	gock.New("https://slack.com").
+		Post("/api/chat.postMessage").
+		BodyString(regexp.QuoteMeta(url.QueryEscape("次の出勤日 9/3 (月) の打刻の前に"))).
+		Reply(200).
+		JSON(map[string]interface{}{"ok": true, "channel": "FOO", "ts": "1535767920.000100"})
+	client := &http.Client{Transport: &http.Transport{}}
+	gock.InterceptClient(client)
+	slack.SetHTTPClient(client)
+	err := ctx.checkSalesforceToken(context.Background())
+	health := ctx.getTokenHealth()
+	for _, test := range []Test{
+		{true, isAuthError(err)},
+		{true, gock.IsDone()},
+		{false, health.NotifiedAt.IsZero()},
+		{"T12345678", health.TeamID},
+	} {
+		test.Compare(t)
+	}
+	Test{nil, ctx.checkSalesforceToken(context.Background())}.Compare(t)
+}
+
+func TestCheckSalesforceTokenNotifiedRecently(t *testing.T) {
+	defer gock.Off()
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := createTestContext(app)
+	setupTokenHealth(ctx, time.Now().Add(2*time.Hour))
+	notifiedAt := getMockTime().Add(-stateExpiry + time.Minute)
+	ctx.setTokenHealth(tokenHealth{TeamID: "T12345678", NotifiedAt: notifiedAt})
+	gock.New("https://test.salesforce.com").
+		Get("/services/oauth2/userinfo").
+		Reply(200).
+		JSON(map[string]interface{}{"user_id": "005"})
+	err := ctx.checkSalesforceToken(context.Background())
+	for _, test := range []Test{
+		{nil, err},
+		{false, gock.IsDone()},
+		{true, notifiedAt.Equal(ctx.getTokenHealth().NotifiedAt)},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestCheckSalesforceTokenNotificationExpired(t *testing.T) {
+	defer gock.Off()
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := createTestContext(app)
+	setupTokenHealth(ctx, time.Now().Add(2*time.Hour))
+	ctx.setTokenHealth(tokenHealth{TeamID: "T12345678", NotifiedAt: getMockTime().Add(-stateExpiry)})
+	gock.New("https://test.salesforce.com").
+		Get("/services/oauth2/userinfo").
+		Reply(200).
+		JSON(map[string]interface{}{"user_id": "005"})
+	err := ctx.checkSalesforceToken(context.Background())
+	for _, test := range []Test{
+		{nil, err},
+		{true, gock.IsDone()},
+		{true, ctx.getTokenHealth().NotifiedAt.IsZero()},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestCheckSalesforceTokensTakesLock(t *testing.T) {
+	defer gock.Off()
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := createTestContext(app)
+	setupTokenHealth(ctx, time.Now().Add(2*time.Hour))
+	app.RedisConn.Do("SET", ctx.getTokenHealthLockKey(), "other", "PX", 60000)
+	gock.New("https://test.salesforce.com").
+		Get("/services/oauth2/userinfo").
+		Reply(200).
+		JSON(map[string]interface{}{"user_id": "005"})
+	app.checkSalesforceTokens()
+	Test{false, gock.IsDone()}.Compare(t)
+	app.RedisConn.Do("DEL", ctx.getTokenHealthLockKey())
+	app.checkSalesforceTokens()
+	Test{true, gock.IsDone()}.Compare(t)
+}
@@ -0,0 +1,108 @@
+package app
+
+import "time"
+
+// japaneseHolidaysByDate are the holidays set by special laws, e.g. for the enthronement and the Olympics
+var japaneseHolidaysByDate = map[string]string{
+	"2019-04-30": "国民の休日",
+	"2019-05-01": "即位の日",
+	"2019-05-02": "国民の休日",
+	"2019-10-22": "即位礼正殿の儀の行われる日",
+}
+
+// japaneseHolidayMoves are the years when the holidays were moved for the Tokyo Olympics
+var japaneseHolidayMoves = map[int]map[string]string{
+	2020: {"07-23": "海の日", "07-24": "スポーツの日", "08-10": "山の日"},
+	2021: {"07-22": "海の日", "07-23": "スポーツの日", "08-08": "山の日"},
+}
+
+// nthMonday returns the day of the nth Monday of the month
+func nthMonday(year int, month time.Month, n int) int {
+	first := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC).Weekday()
+	return 1 + (int(time.Monday)-int(first)+7)%7 + (n-1)*7
+}
+
+// equinoxDay returns the day of the vernal or the autumnal equinox, which is valid from 1980 to 2099
+func equinoxDay(year int, base float64) int {
+	return int(base + 0.242194*float64(year-1980) - float64((year-1980)/4))
+}
+
+// getNationalHoliday returns the holiday defined by the National Holiday Act, without substitute holidays
+func getNationalHoliday(year int, month time.Month, day int) (string, bool) {
+	date := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	if name, ok := japaneseHolidaysByDate[date.Format("2006-01-02")]; ok {
+		return name, true
+	}
+	if moves, ok := japaneseHolidayMoves[year]; ok {
+		if name, ok := moves[date.Format("01-02")]; ok {
+			return name, true
+		}
+	}
+	_, moved := japaneseHolidayMoves[year]
+	switch {
+	case month == time.January && day == 1:
+		return "元日", true
+	case month == time.January && day == nthMonday(year, month, 2):
+		return "成人の日", true
+	case month == time.February && day == 11:
+		return "建国記念の日", true
+	case month == time.February && day == 23 && year >= 2020:
+		return "天皇誕生日", true
+	case month == time.March && day == equinoxDay(year, 20.8431):
+		return "春分の日", true
+	case month == time.April && day == 29:
+		return "昭和の日", true
+	case month == time.May && day == 3:
+		return "憲法記念日", true
+	case month == time.May && day == 4:
+		return "みどりの日", true
+	case month == time.May && day == 5:
+		return "こどもの日", true
+	case month == time.July && day == nthMonday(year, month, 3) && !moved:
+		return "海の日", true
+	case month == time.August && day == 11 && year >= 2016 && !moved:
+		return "山の日", true
+	case month == time.September && day == nthMonday(year, month, 3):
+		return "敬老の日", true
+	case month == time.September && day == equinoxDay(year, 23.2488):
+		return "秋分の日", true
+	case month == time.October && day == nthMonday(year, month, 2) && !moved:
+		if year >= 2020 {
+			return "スポーツの日", true
+		}
+		return "体育の日", true
+	case month == time.November && day == 3:
+		return "文化の日", true
+	case month == time.November && day == 23:
+		return "勤労感謝の日", true
+	case month == time.December && day == 23 && year >= 1989 && year <= 2018:
+		return "天皇誕生日", true
+	}
+	return "", false
+}
+
+// getJapaneseHoliday returns the national holiday on the date, including substitute holidays
+// for holidays on Sunday and citizens' holidays between two holidays
+func getJapaneseHoliday(date time.Time) (string, bool) {
+	year, month, day := date.Date()
+	if name, ok := getNationalHoliday(year, month, day); ok {
+		return name, true
+	}
+	// A holiday on Sunday moves to the next day which is not a holiday
+	for d := date.AddDate(0, 0, -1); ; d = d.AddDate(0, 0, -1) {
+		if _, ok := getNationalHoliday(d.Date()); !ok {
+			break
+		}
+		if d.Weekday() == time.Sunday {
+			return "振替休日", true
+		}
+	}
+	if date.Weekday() != time.Sunday {
+		_, before := getNationalHoliday(date.AddDate(0, 0, -1).Date())
+		_, after := getNationalHoliday(date.AddDate(0, 0, 1).Date())
+		if before && after {
+			return "国民の休日", true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,53 @@
+package app
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetJapaneseHoliday(t *testing.T) {
+	for _, test := range []struct {
+		date     string
+		expected string
+	}{
+		{"2018-01-01", "元日"},
+		{"2018-01-08", "成人の日"},
+		{"2018-02-12", "振替休日"},
+		{"2018-03-21", "春分の日"},
+		{"2018-04-30", "振替休日"},
+		{"2018-07-16", "海の日"},
+		{"2018-09-17", "敬老の日"},
+		{"2018-09-23", "秋分の日"},
+		{"2018-09-24", "振替休日"},
+		{"2018-10-08", "体育の日"},
+		{"2018-12-23", "天皇誕生日"},
+		{"2018-12-24", "振替休日"},
+		{"2019-02-23", ""},
+		{"2019-04-30", "国民の休日"},
+		{"2019-05-01", "即位の日"},
+		{"2019-05-06", "振替休日"},
+		{"2019-10-22", "即位礼正殿の儀の行われる日"},
+		{"2019-12-23", ""},
+		{"2020-02-24", "振替休日"},
+		{"2020-07-20", ""},
+		{"2020-07-23", "海の日"},
+		{"2020-07-24", "スポーツの日"},
+		{"2020-08-10", "山の日"},
+		{"2020-08-11", ""},
+		{"2021-08-09", "振替休日"},
+		{"2021-10-11", ""},
+		{"2015-09-22", "国民の休日"},
+		{"2026-09-22", "国民の休日"},
+		{"2024-05-06", "振替休日"},
+		{"2025-03-20", "春分の日"},
+		{"2025-09-23", "秋分の日"},
+		{"2025-10-13", "スポーツの日"},
+		{"2025-08-11", "山の日"},
+		{"2018-09-03", ""},
+	} {
+		date, _ := time.Parse("2006-01-02", test.date)
+		name, ok := getJapaneseHoliday(date)
+		Test{test.expected, name}.Compare(t)
+		Test{test.expected != "", ok}.Compare(t)
+	}
+}
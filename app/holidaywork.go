@@ -0,0 +1,287 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nlopes/slack"
+)
+
+const (
+	// maxHolidayWorkReason limits the reason recorded as the comment of the punch in TeamSpirit
+	maxHolidayWorkReason  = 100
+	actionTypeHolidayWork = "holiday-work"
+	callbackIDHolidayWork = "holiday_work_button"
+	// callbackIDHolidayWorkDialog is the dialog asking the reason, submitted with the reason in holidayWorkReasonField
+	callbackIDHolidayWorkDialog = "holiday_work_dialog"
+	holidayWorkReasonField      = "reason"
+)
+
+var holidayWorkButton = slack.AttachmentAction{
+	Name:  actionTypeHolidayWork,
+	Value: actionTypeHolidayWork,
+	Text:  "休日出勤する",
+	Style: "primary",
+	Type:  "button",
+	Confirm: &slack.ConfirmationField{
+		Text:        "本日は休日です。休日出勤の理由を入力しますか？",
+		OkText:      "はい",
+		DismissText: "いいえ",
+	},
+}
+
+// slackDialog is the dialog opened with dialog.open, which the Slack client does not support
+type slackDialog struct {
+	CallbackID  string               `json:"callback_id"`
+	Title       string               `json:"title"`
+	SubmitLabel string               `json:"submit_label,omitempty"`
+	Elements    []slackDialogElement `json:"elements"`
+}
+
+type slackDialogElement struct {
+	Type        string `json:"type"`
+	Label       string `json:"label"`
+	Name        string `json:"name"`
+	Placeholder string `json:"placeholder,omitempty"`
+	MaxLength   int    `json:"max_length,omitempty"`
+}
+
+// slackDialogSubmission is the payload sent to the interactive endpoint when the dialog is submitted
+type slackDialogSubmission struct {
+	Type        string            `json:"type"`
+	CallbackID  string            `json:"callback_id"`
+	Team        slack.Team        `json:"team"`
+	User        slack.User        `json:"user"`
+	Token       string            `json:"token"`
+	ResponseURL string            `json:"response_url"`
+	Submission  map[string]string `json:"submission"`
+}
+
+// slackDialogErrors is the response telling Slack which fields of the dialog are invalid
+type slackDialogErrors struct {
+	Errors []slackDialogError `json:"errors"`
+}
+
+type slackDialogError struct {
+	Name  string `json:"name"`
+	Error string `json:"error"`
+}
+
+// holidayWork is the holiday the user works on and why, with the manager to notify
+type holidayWork struct {
+	Date    string `json:"date,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+	Manager string `json:"manager,omitempty"`
+}
+
+func (ctx *Context) getHolidayWork() *holidayWork {
+	work := &holidayWork{}
+	if data := ctx.getVariableInHash(ctx.HolidayWorkStoreKey, ctx.UserID); data != "" {
+		json.Unmarshal([]byte(data), work)
+	}
+	return work
+}
+
+func (ctx *Context) setHolidayWork(work *holidayWork) error {
+	data, err := json.Marshal(work)
+	if err != nil {
+		return err
+	}
+	return ctx.setVariableInHash(ctx.HolidayWorkStoreKey, data)
+}
+
+// getHolidayWorkReason returns the reason of working on the date like 2018-09-01, or empty if the user does not
+func (ctx *Context) getHolidayWorkReason(date string) string {
+	if ctx.UserID == "" {
+		return ""
+	}
+	if work := ctx.getHolidayWork(); work.Date == date {
+		return work.Reason
+	}
+	return ""
+}
+
+// clearHolidayWorkReason asks for the reason again on the next holiday, once it is sent to TeamSpirit
+func (ctx *Context) clearHolidayWorkReason() error {
+	work := ctx.getHolidayWork()
+	work.Date = ""
+	work.Reason = ""
+	return ctx.setHolidayWork(work)
+}
+
+// parseSlackUserID parses the escaped mention like <@U1234|name>
+func parseSlackUserID(text string) (string, bool) {
+	if !strings.HasPrefix(text, "<@") || !strings.HasSuffix(text, ">") {
+		return "", false
+	}
+	userID := parseSlackURL(text)[1:]
+	return userID, userID != ""
+}
+
+// notifyHolidayWork tells the manager that the user works on the holiday, as a direct message from the user
+func (ctx *Context) notifyHolidayWork(work *holidayWork) {
+	slackToken := ctx.getSlackAccessTokenForUser()
+	if slackToken == "" || work.Manager == "" {
+		return
+	}
+	text := "<@" + ctx.UserID + "> が " + work.Date + " に休日出勤します :briefcase:\n理由: " + work.Reason
+	slack.New(slackToken).PostMessage(work.Manager, text, slack.PostMessageParameters{AsUser: true})
+}
+
+func (ctx *Context) getHolidayWorkManagerSlackMessage(args []string) *slack.Msg {
+	work := ctx.getHolidayWork()
+	usage := "`/ts holiday manager @ユーザー` で休日出勤を通知する上長を設定、`/ts holiday manager off` で解除できます"
+	if len(args) == 0 {
+		if work.Manager == "" {
+			return &slack.Msg{Text: "休日出勤の通知先は設定されていません\n" + usage}
+		}
+		return &slack.Msg{Text: "休日出勤を <@" + work.Manager + "> に通知します\n" + usage}
+	}
+	if args[0] == "off" {
+		work.Manager = ""
+		ctx.setHolidayWork(work)
+		return &slack.Msg{Text: "休日出勤の通知を止めました :no_bell:"}
+	}
+	manager, ok := parseSlackUserID(args[0])
+	if !ok || len(args) > 1 {
+		return &slack.Msg{Text: usage + " :warning:"}
+	}
+	work.Manager = manager
+	if err := ctx.setHolidayWork(work); err != nil {
+		return &slack.Msg{Text: "設定の保存に失敗しました :warning:"}
+	}
+	if ctx.getSlackAccessTokenForUser() == "" {
+		return &slack.Msg{Text: "休日出勤を <@" + manager + "> に通知します。通知には `/ts channel` で Slack の認証が必要です"}
+	}
+	return &slack.Msg{Text: "休日出勤を <@" + manager + "> に通知します :mega:"}
+}
+
+// getHolidaySlackMessage tells that today is a holiday, with the button to enter the reason of working on it
+func (ctx *Context) getHolidaySlackMessage() *slack.Msg {
+	return &slack.Msg{
+		Text: "本日は休日です :sunny:",
+		Attachments: []slack.Attachment{{
+			Text:       "休日出勤する場合は理由を入力し、" + ctx.getHolidayWorkApplicationText(),
+			CallbackID: callbackIDHolidayWork,
+			Actions:    []slack.AttachmentAction{holidayWorkButton},
+		}},
+	}
+}
+
+// getHolidayWorkApplicationText explains that TeamSpirit refuses punches on the holiday until the application is made
+func (ctx *Context) getHolidayWorkApplicationText() string {
+	return "<https://" + ctx.TeamSpiritHost + "|TeamSpirit> で休日出勤を申請すると打刻できます"
+}
+
+// validateHolidayWorkReason returns the message telling why the reason is invalid, or empty
+func validateHolidayWorkReason(reason string) string {
+	if reason == "" {
+		return "休日出勤の理由を入力してください"
+	}
+	if utf8.RuneCountInString(reason) > maxHolidayWorkReason {
+		return "理由は " + strconv.Itoa(maxHolidayWorkReason) + " 文字以内で入力してください"
+	}
+	return ""
+}
+
+// getHolidayWorkSlackMessage records the reason of working on the holiday. TeamSpirit accepts
+// punches on the holiday only after the application of holiday work, and the reason is sent as
+// the comment of attending then.
+func (ctx *Context) getHolidayWorkSlackMessage(teamID string, tt *timeTable, text string) *slack.Msg {
+	now := ctx.getCurrentTimeForUser()
+	if tt.IsAttending() {
+		msg := ctx.getAttendanceSlackMessage(ctx.getAttendanceButtons(teamID, tt, now))
+		msg.Text = "休日出勤として記録済です"
+		return msg
+	}
+	if tt.State() != attendanceStateHoliday {
+		return &slack.Msg{Text: "本日は休日ではありません。`/ts` で打刻してください"}
+	}
+	reason := strings.TrimSpace(text)
+	if reason == "" && tt.HolidayWork != "" {
+		return &slack.Msg{Text: "休日出勤の理由は記録済です: " + tt.HolidayWork + "\n" + ctx.getHolidayWorkApplicationText()}
+	}
+	if reason == "" {
+		return &slack.Msg{Text: "`/ts holiday 理由` の形式で休日出勤の理由を入力してください :warning:"}
+	}
+	if message := validateHolidayWorkReason(reason); message != "" {
+		return &slack.Msg{Text: message + " :warning:"}
+	}
+	work := ctx.getHolidayWork()
+	work.Date = now.Format("2006-01-02")
+	work.Reason = reason
+	if err := ctx.setHolidayWork(work); err != nil {
+		return &slack.Msg{Text: "休日出勤の記録に失敗しました :warning:"}
+	}
+	ctx.notifyHolidayWork(work)
+	msg := &slack.Msg{Text: "休日出勤の理由を記録しました :briefcase: 理由: " + reason + "\n" + ctx.getHolidayWorkApplicationText() + "。理由は出勤時に TeamSpirit のコメントとして記録します"}
+	if work.Manager != "" && ctx.getSlackAccessTokenForUser() != "" {
+		msg.Text += "\n<@" + work.Manager + "> に通知しました"
+	}
+	return msg
+}
+
+// openHolidayWorkDialog opens the dialog asking the reason with the trigger of the button
+func (ctx *Context) openHolidayWorkDialog(triggerID string) error {
+	slackToken := ctx.getSlackAccessTokenForUser()
+	if slackToken == "" {
+		return errSlackNotAuthorized
+	}
+	dialog, err := json.Marshal(slackDialog{
+		CallbackID:  callbackIDHolidayWorkDialog,
+		Title:       "休日出勤",
+		SubmitLabel: "記録する",
+		Elements: []slackDialogElement{{
+			Type:        "textarea",
+			Label:       "理由",
+			Name:        holidayWorkReasonField,
+			Placeholder: "TeamSpirit の出勤のコメントとして記録します",
+			MaxLength:   maxHolidayWorkReason,
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: ctx.RequestTimeout}
+	res, err := client.PostForm(slack.SLACK_API+"dialog.open", url.Values{
+		"token":      {slackToken},
+		"trigger_id": {triggerID},
+		"dialog":     {string(dialog)},
+	})
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	var body struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return err
+	}
+	if !body.OK {
+		return errors.New("dialog.open failed: " + body.Error)
+	}
+	return nil
+}
+
+// getHolidayWorkDialogCallback records the reason submitted with the dialog, like `/ts holiday 理由`
+func (ctx *Context) getHolidayWorkDialogCallback(c context.Context, submission *slackDialogSubmission, reason string) *slack.Msg {
+	msg, err := ctx.getSlackMessage(c, slack.SlashCommand{
+		TeamID:      submission.Team.ID,
+		UserID:      submission.User.ID,
+		ResponseURL: submission.ResponseURL,
+		Text:        "holiday " + reason,
+	})
+	if err != nil {
+		msg = &slack.Msg{Text: "休日出勤の記録に失敗しました :warning:"}
+	}
+	msg.ResponseType = "ephemeral"
+	return msg
+}
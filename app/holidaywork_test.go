@@ -0,0 +1,187 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/nlopes/slack"
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func TestParseSlackUserID(t *testing.T) {
+	for _, test := range []struct {
+		text     string
+		expected string
+		ok       bool
+	}{
+		{"<@U12345678|boss>", "U12345678", true},
+		{"<@U12345678>", "U12345678", true},
+		{"@boss", "", false},
+		{"<@>", "", false},
+	} {
+		userID, ok := parseSlackUserID(test.text)
+		Test{test.expected, userID}.Compare(t)
+		Test{test.ok, ok}.Compare(t)
+	}
+}
+
+func TestGetHolidayWorkSlackMessage(t *testing.T) {
+	defer gock.Off()
+	defer gock.RestoreClient(slack.HTTPClient)
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := createTestContext(app)
+
+	setupTimeTableGocks([]timeTableItem{}, &[]bool{true}[0])
+	msg, _ := ctx.getSlackMessage(context.Background(), slack.SlashCommand{TeamID: "T12345678", Text: "holiday"})
+	Test{"`/ts holiday 理由` の形式で休日出勤の理由を入力してください :warning:", msg.Text}.Compare(t)
+
+	msg, _ = ctx.getSlackMessage(context.Background(), slack.SlashCommand{TeamID: "T12345678", Text: "holiday manager <@U99999999|boss>"})
+	Test{"休日出勤を <@U99999999> に通知します。通知には `/ts channel` で Slack の認証が必要です", msg.Text}.Compare(t)
+
+	ctx.setSlackAccessToken("xoxp-foo")
+	gock.New("https://slack.com").
+		Post("/api/chat.postMessage").
+		MatchType("url").
+		BodyString("channel=U99999999").
+		Reply(200).
+		JSON(map[string]interface{}{"ok": true, "channel": "D12345678", "ts": "1535767920.000100"})
+	client := &http.Client{Transport: &http.Transport{}}
+	gock.InterceptClient(client)
+	slack.SetHTTPClient(client)
+	setupTimeTableGocks([]timeTableItem{}, &[]bool{true}[0])
+	msg, _ = ctx.getSlackMessage(context.Background(), slack.SlashCommand{TeamID: "T12345678", Text: "holiday リリース対応"})
+	for _, test := range []Test{
+		{"休日出勤の理由を記録しました :briefcase: 理由: リリース対応\n<https://teamspirit-1234.cloudforce.test|TeamSpirit> で休日出勤を申請すると打刻できます。理由は出勤時に TeamSpirit のコメントとして記録します\n<@U99999999> に通知しました", msg.Text},
+		{0, len(msg.Attachments)},
+		{&holidayWork{Date: "2018-09-01", Reason: "リリース対応", Manager: "U99999999"}, ctx.getHolidayWork()},
+		{"リリース対応", ctx.getHolidayWorkReason("2018-09-01")},
+		{"", ctx.getHolidayWorkReason("2018-09-02")},
+		{true, gock.IsDone()},
+	} {
+		test.DeepEqual(t)
+	}
+
+	setupTimeTableGocks([]timeTableItem{}, &[]bool{true}[0])
+	msg, _ = ctx.getSlackMessage(context.Background(), slack.SlashCommand{TeamID: "T12345678", Text: "holiday"})
+	Test{"休日出勤の理由は記録済です: リリース対応\n<https://teamspirit-1234.cloudforce.test|TeamSpirit> で休日出勤を申請すると打刻できます", msg.Text}.Compare(t)
+
+	setupTimeTableGocks([]timeTableItem{}, &[]bool{true}[0])
+	_, err := ctx.punch(context.Background(), ctx.createTimeTableClient(context.Background()), queuedPunch{
+		TeamID: "T12345678",
+		Action: actionTypeAttend,
+		Time:   getMockTime(),
+	})
+	Test{&punchRefusedError{attendanceStateHoliday, actionTypeAttend}, err}.DeepEqual(t)
+
+	// TeamSpirit no longer reports the holiday once the application of holiday work is made
+	setupTimeTableGocks([]timeTableItem{}, &[]bool{false}[0])
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Put("/services/apexrest/Dakoku").
+		JSON(map[string]interface{}{"attendance": true, "minute": 672, "comment": "リリース対応"}).
+		Reply(200).
+		BodyString(`"OK"`)
+	_, err = ctx.punch(context.Background(), ctx.createTimeTableClient(context.Background()), queuedPunch{
+		TeamID: "T12345678",
+		Action: actionTypeAttend,
+		Time:   getMockTime(),
+	})
+	for _, test := range []Test{
+		{nil, err},
+		{true, gock.IsDone()},
+		{"", ctx.getHolidayWorkReason("2018-09-01")},
+		{&holidayWork{Manager: "U99999999"}, ctx.getHolidayWork()},
+	} {
+		test.DeepEqual(t)
+	}
+
+	msg, _ = ctx.getSlackMessage(context.Background(), slack.SlashCommand{TeamID: "T12345678", Text: "holiday manager off"})
+	Test{"休日出勤の通知を止めました :no_bell:", msg.Text}.Compare(t)
+	Test{"", ctx.getHolidayWork().Manager}.Compare(t)
+}
+
+func TestGetHolidayWorkSlackMessageOnWorkday(t *testing.T) {
+	defer gock.Off()
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := createTestContext(app)
+	setupTimeTableGocks([]timeTableItem{}, &[]bool{false}[0])
+	msg, _ := ctx.getSlackMessage(context.Background(), slack.SlashCommand{TeamID: "T12345678", Text: "holiday リリース対応"})
+	Test{"本日は休日ではありません。`/ts` で打刻してください", msg.Text}.Compare(t)
+	Test{"", ctx.getHolidayWorkReason("2018-09-01")}.Compare(t)
+}
+
+func TestPunchOnHolidayWithoutApplication(t *testing.T) {
+	defer gock.Off()
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := createTestContext(app)
+	ctx.setHolidayWork(&holidayWork{Date: "2018-09-01", Reason: "リリース対応"})
+
+	// The time table fetched before the application was withdrawn
+	setupTimeTableGocks([]timeTableItem{}, &[]bool{false}[0])
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Put("/services/apexrest/Dakoku").
+		Reply(200).
+		BodyString(`"HOLIDAY"`)
+	_, err := ctx.punch(context.Background(), ctx.createTimeTableClient(context.Background()), queuedPunch{
+		TeamID: "T12345678",
+		Action: actionTypeAttend,
+		Time:   getMockTime(),
+	})
+	for _, test := range []Test{
+		{errHolidayWorkNotApplied, err},
+		{true, gock.IsDone()},
+		{"リリース対応", ctx.getHolidayWorkReason("2018-09-01")},
+		{"出勤に失敗しました\nTeamSpirit で休日出勤の申請を行ってから、再度打刻してください :memo:", getTimeTableErrorText("出勤に失敗しました", err)},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestOpenHolidayWorkDialog(t *testing.T) {
+	defer gock.Off()
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := createTestContext(app)
+	Test{errSlackNotAuthorized, ctx.openHolidayWorkDialog("123.456")}.Compare(t)
+
+	ctx.setSlackAccessToken("xoxp-foo")
+	gock.New("https://slack.com").
+		Post("/api/dialog.open").
+		MatchType("url").
+		BodyString("trigger_id=123.456").
+		Reply(200).
+		JSON(map[string]interface{}{"ok": true})
+	Test{nil, ctx.openHolidayWorkDialog("123.456")}.Compare(t)
+	Test{true, gock.IsDone()}.Compare(t)
+
+	gock.New("https://slack.com").
+		Post("/api/dialog.open").
+		Reply(200).
+		JSON(map[string]interface{}{"ok": false, "error": "expired_trigger_id"})
+	Test{"dialog.open failed: expired_trigger_id", ctx.openHolidayWorkDialog("123.456").Error()}.Compare(t)
+}
+
+func TestGetHolidayWorkDialogCallback(t *testing.T) {
+	defer gock.Off()
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := createTestContext(app)
+	setupTimeTableGocks([]timeTableItem{}, &[]bool{true}[0])
+	msg := ctx.getHolidayWorkDialogCallback(context.Background(), &slackDialogSubmission{
+		Team:        slack.Team{ID: "T12345678"},
+		User:        slack.User{ID: "FOO"},
+		ResponseURL: "https://hooks.slack.com/actions/foo",
+	}, "リリース対応")
+	for _, test := range []Test{
+		{"ephemeral", msg.ResponseType},
+		{true, strings.HasPrefix(msg.Text, "休日出勤の理由を記録しました :briefcase: 理由: リリース対応\n")},
+		{"リリース対応", ctx.getHolidayWorkReason("2018-09-01")},
+		{true, gock.IsDone()},
+	} {
+		test.Compare(t)
+	}
+}
@@ -2,28 +2,39 @@ package app
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"golang.org/x/oauth2"
 )
 
 func (ctx *Context) getSalesforceOAuthCallbackURL() string {
-	return "https://" + ctx.Request.Host + "/oauth/salesforce/callback"
+	return ctx.BaseURL + "/oauth/salesforce/callback"
 }
 
 func (ctx *Context) getSalesforceAuthenticateURL(state string) string {
-	return "https://" + ctx.Request.Host + "/oauth/salesforce/authenticate/" + state
+	return ctx.BaseURL + "/oauth/salesforce/authenticate/" + state
 }
 
 func (ctx *Context) getSlackOAuthCallbackURL() string {
-	return "https://" + ctx.Request.Host + "/oauth/slack/callback"
+	return ctx.BaseURL + "/oauth/slack/callback"
+}
+
+func (ctx *Context) getSlackLoginCallbackURL() string {
+	return ctx.BaseURL + "/login/callback"
 }
 
 func (ctx *Context) getSlackAuthenticateURL(teamID, state string) string {
-	return "https://" + ctx.Request.Host + "/oauth/slack/authenticate/" + teamID + "/" + state
+	return ctx.BaseURL + "/oauth/slack/authenticate/" + teamID + "/" + state
 }
 
 func (ctx *Context) setSalesforceAccessToken(token *oauth2.Token) error {
@@ -57,7 +68,7 @@ func (ctx *Context) getSalesforceOAuth2Config() *oauth2.Config {
 		Endpoint: oauth2.Endpoint{
 			// https://developer.salesforce.com/docs/atlas.en-us.api_rest.meta/api_rest/intro_understanding_oauth_endpoints.htm
 			AuthURL:  "https://test.salesforce.com/services/oauth2/authorize", // SandBox
-			TokenURL: "https://test.salesforce.com/services/oauth2/token", // SandBox
+			TokenURL: "https://test.salesforce.com/services/oauth2/token",     // SandBox
 			// AuthURL:  "https://login.salesforce.com/services/oauth2/authorize", // Production
 			// TokenURL: "https://login.salesforce.com/services/oauth2/token", // Production
 		},
@@ -84,24 +95,62 @@ func (ctx *Context) getSlackNotifyChannelForUser() string {
 	return ctx.getVariableInHash(ctx.NotifyChannelStoreKey, ctx.UserID)
 }
 
-func (ctx *Context) getSalesforceAccessToken(code, state string) (*oauth2.Token, error) {
+// getSalesforceAccessToken exchanges the code with the PKCE code verifier,
+// which the vendored oauth2 package does not support sending
+func (ctx *Context) getSalesforceAccessToken(code, verifier string) (*oauth2.Token, error) {
 	config := ctx.getSalesforceOAuth2Config()
-	t, err := config.Exchange(context.TODO(), code)
+	v := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"code_verifier": {verifier},
+		"redirect_uri":  {config.RedirectURL},
+		"client_id":     {config.ClientID},
+		"client_secret": {config.ClientSecret},
+	}
+	req, err := http.NewRequest(http.MethodPost, config.Endpoint.TokenURL, strings.NewReader(v.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res, err := http.DefaultClient.Do(req.WithContext(ctx.Request.Context()))
 	if err != nil {
 		return nil, err
 	}
-	return t, nil
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, fmt.Errorf("oauth2: cannot fetch token: %v\nResponse: %s", res.Status, body)
+	}
+	var token oauth2.Token
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, err
+	}
+	if token.AccessToken == "" {
+		return nil, errors.New("oauth2: server response missing access_token")
+	}
+	return &token, nil
 }
 
-func (ctx *Context) getSalesforceOAuth2Client() *http.Client {
+func newCodeVerifier() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func getCodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func (ctx *Context) getSalesforceOAuth2Client(c context.Context) *http.Client {
 	token := ctx.getSalesforceAccessTokenForUser()
 	if token == nil {
 		return nil
 	}
-	src := ctx.getSalesforceOAuth2Config().TokenSource(context.TODO(), token)
-	ts := oauth2.ReuseTokenSource(token, src)
-	if token, _ := ts.Token(); token != nil {
-		ctx.setSalesforceAccessToken(token)
-	}
-	return oauth2.NewClient(oauth2.NoContext, ts)
+	client := oauth2.NewClient(c, ctx.newSalesforceTokenSource(c, token))
+	client.Timeout = ctx.RequestTimeout
+	return client
 }
@@ -1,6 +1,7 @@
 package app
 
 import (
+	"context"
 	"net/http"
 	"testing"
 	"time"
@@ -37,6 +38,22 @@ func TestGetSlackeAuthenticateURL(t *testing.T) {
 	Test{"https://example.com/oauth/slack/authenticate/foo/bar", ctx.getSlackAuthenticateURL("foo", "bar")}.Compare(t)
 }
 
+func TestURLsIgnoreHostHeader(t *testing.T) {
+	app := createMockApp()
+	app.BaseURL = "http://localhost:8000"
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/test", nil)
+	req.Host = "evil.test"
+	ctx := app.createContext(req)
+	for _, test := range []Test{
+		{"http://localhost:8000/oauth/salesforce/callback", ctx.getSalesforceOAuthCallbackURL()},
+		{"http://localhost:8000/oauth/salesforce/authenticate/foo", ctx.getSalesforceAuthenticateURL("foo")},
+		{"http://localhost:8000/oauth/slack/callback", ctx.getSlackOAuthCallbackURL()},
+		{"http://localhost:8000/oauth/slack/authenticate/foo/bar", ctx.getSlackAuthenticateURL("foo", "bar")},
+	} {
+		test.Compare(t)
+	}
+}
+
 func TestSetAndGetSalesforceAccessToken(t *testing.T) {
 	token := &oauth2.Token{
 		AccessToken:  "foo",
@@ -72,7 +89,7 @@ func TestSetAndGetSalesforceOAuthClient(t *testing.T) {
 	newExpiry := time.Now().Add(2 * time.Hour).Truncate(time.Second)
 	oldExpiry := time.Now().Add(-10 * time.Hour).Truncate(time.Second)
 	resExpiry, _ := time.Parse("2016-01-02T15:04:05Z", "0001-01-01T00:00:00Z")
-	gock.New("https://login.salesforce.com").
+	gock.New("https://test.salesforce.com").
 		Post("/services/oauth2/token").
 		Reply(200).
 		JSON(oauth2.Token{
@@ -106,10 +123,12 @@ func TestSetAndGetSalesforceOAuthClient(t *testing.T) {
 	} {
 		test.Compare(t)
 	}
-	client := ctx.getSalesforceOAuth2Client()
+	client := ctx.getSalesforceOAuth2Client(context.Background())
+	_, err = client.Transport.(*oauth2.Transport).Source.Token()
 	token = ctx.getSalesforceAccessTokenForUser()
 	for _, test := range []Test{
 		{false, client == nil},
+		{nil, err},
 		{newExpiry.String(), token.Expiry.String()},
 		{"bar2", token.RefreshToken},
 		{"foo2", token.AccessToken},
@@ -0,0 +1,398 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/gorilla/mux"
+	"github.com/nlopes/slack"
+)
+
+const (
+	presenceModeAsk  = "ask"
+	presenceModeAuto = "auto"
+	// presenceEventAny matches any event, e.g. to attend on the first event of the day
+	presenceEventAny = "*"
+	// presenceAskInterval suppresses asking the same action repeatedly for bursts of events
+	presenceAskInterval = 30 * time.Minute
+
+	presenceResultPunched = "punched"
+	presenceResultQueued  = "queued"
+	presenceResultAsked   = "asked"
+	presenceResultIgnored = "ignored"
+)
+
+var errInvalidPresenceRule = errors.New("presence rule is invalid")
+
+// presenceRule maps an event received in the time window to an action
+type presenceRule struct {
+	Event  string `json:"event"`
+	Action string `json:"action"`
+	// After and Before are minutes from midnight, and -1 if not limited
+	After  int `json:"after"`
+	Before int `json:"before"`
+}
+
+// defaultPresenceRules attend on the first event of the day in working hours, and leave when VPN is disconnected in the evening
+var defaultPresenceRules = []presenceRule{
+	{Event: presenceEventAny, Action: actionTypeAttend, After: 7 * 60, Before: 19 * 60},
+	{Event: "vpn_disconnect", Action: actionTypeLeave, After: 17 * 60, Before: -1},
+}
+
+// presenceSettings uses the default rules while Rules is null, and none when all of them are removed
+type presenceSettings struct {
+	TokenDigest string         `json:"token_digest,omitempty"`
+	TeamID      string         `json:"team_id,omitempty"`
+	Mode        string         `json:"mode,omitempty"`
+	Rules       []presenceRule `json:"rules"`
+	LastAsked   string         `json:"last_asked,omitempty"`
+	LastAskedAt time.Time      `json:"last_asked_at,omitempty"`
+}
+
+type presenceResult struct {
+	Event   string `json:"event"`
+	Action  string `json:"action,omitempty"`
+	Result  string `json:"result"`
+	Message string `json:"message"`
+}
+
+// normalizePresenceEvent allows events like "VPN Disconnect" and "vpn-disconnect" to match vpn_disconnect
+func normalizePresenceEvent(event string) string {
+	event = strings.ToLower(strings.TrimSpace(event))
+	return strings.NewReplacer(" ", "_", "-", "_").Replace(event)
+}
+
+// isPresenceDisconnectEvent reports whether the event is like vpn_disconnect, which is
+// always confirmed in Slack as the connection can be lost without leaving
+func isPresenceDisconnectEvent(event string) bool {
+	return strings.HasSuffix(event, "disconnect")
+}
+
+func formatClock(minutes int) string {
+	if minutes < 0 {
+		return ""
+	}
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+func parseClock(value string) (int, error) {
+	if value == "" {
+		return -1, nil
+	}
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return -1, errInvalidPresenceRule
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// parsePresenceRule parses the arguments like `vpn_disconnect leave 17:00-`
+func parsePresenceRule(args []string) (presenceRule, error) {
+	rule := presenceRule{After: -1, Before: -1}
+	if len(args) < 2 || len(args) > 3 {
+		return rule, errInvalidPresenceRule
+	}
+	rule.Event = normalizePresenceEvent(args[0])
+	rule.Action = args[1]
+	if _, ok := attendanceActionTexts[rule.Action]; !ok || rule.Event == "" {
+		return rule, errInvalidPresenceRule
+	}
+	if len(args) == 3 {
+		window := strings.SplitN(args[2], "-", 2)
+		if len(window) != 2 {
+			return rule, errInvalidPresenceRule
+		}
+		var err error
+		if rule.After, err = parseClock(window[0]); err != nil {
+			return rule, err
+		}
+		if rule.Before, err = parseClock(window[1]); err != nil {
+			return rule, err
+		}
+	}
+	return rule, nil
+}
+
+func (rule presenceRule) String() string {
+	text := "`" + rule.Event + "` → " + attendanceButtons[rule.Action].Text
+	if rule.After >= 0 || rule.Before >= 0 {
+		text += " (" + formatClock(rule.After) + "-" + formatClock(rule.Before) + ")"
+	}
+	return text
+}
+
+// Matches reports whether the event received at the minutes from midnight matches the rule
+func (rule presenceRule) Matches(event string, minutes int) bool {
+	if rule.Event != presenceEventAny && rule.Event != event {
+		return false
+	}
+	return (rule.After < 0 || minutes >= rule.After) && (rule.Before < 0 || minutes < rule.Before)
+}
+
+func (settings *presenceSettings) getRules() []presenceRule {
+	if settings.Rules == nil {
+		return defaultPresenceRules
+	}
+	return settings.Rules
+}
+
+func (settings *presenceSettings) getMode() string {
+	if settings.Mode == "" {
+		return presenceModeAsk
+	}
+	return settings.Mode
+}
+
+// findAction returns the action of the first rule matching the event, which is allowed in the state
+func (settings *presenceSettings) findAction(event string, now time.Time, state attendanceState) (string, bool) {
+	minutes := now.Hour()*60 + now.Minute()
+	for _, rule := range settings.getRules() {
+		if rule.Matches(event, minutes) && state.Can(rule.Action) {
+			return rule.Action, true
+		}
+	}
+	return "", false
+}
+
+func (ctx *Context) getPresenceTokenStoreKey() string {
+	return ctx.PresenceStoreKey + ":tokens"
+}
+
+func (ctx *Context) getPresenceSettings() *presenceSettings {
+	settings := &presenceSettings{}
+	if data := ctx.getVariableInHash(ctx.PresenceStoreKey, ctx.UserID); data != "" {
+		json.Unmarshal([]byte(data), settings)
+	}
+	return settings
+}
+
+func (ctx *Context) setPresenceSettings(settings *presenceSettings) error {
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	return ctx.setVariableInHash(ctx.PresenceStoreKey, data)
+}
+
+// createPresenceURL issues the secret URL of the user, revoking the previous one
+func (ctx *Context) createPresenceURL(teamID string) (string, error) {
+	settings := ctx.getPresenceSettings()
+	if settings.TokenDigest != "" {
+		ctx.RedisConn.Do("HDEL", ctx.getPresenceTokenStoreKey(), settings.TokenDigest)
+	}
+	token := ctx.randomString(32)
+	settings.TokenDigest = getAPITokenDigest(token)
+	settings.TeamID = teamID
+	if _, err := redis.Bool(ctx.RedisConn.Do("HSET", ctx.getPresenceTokenStoreKey(), settings.TokenDigest, ctx.UserID)); err != nil {
+		return "", err
+	}
+	if err := ctx.setPresenceSettings(settings); err != nil {
+		return "", err
+	}
+	return ctx.BaseURL + "/hooks/presence/" + token, nil
+}
+
+func (ctx *Context) deletePresenceURL() bool {
+	settings := ctx.getPresenceSettings()
+	if settings.TokenDigest == "" {
+		return false
+	}
+	ctx.RedisConn.Do("HDEL", ctx.getPresenceTokenStoreKey(), settings.TokenDigest)
+	settings.TokenDigest = ""
+	ctx.setPresenceSettings(settings)
+	return true
+}
+
+// authenticatePresenceToken sets the owner of the URL to the context, and returns the settings
+func (ctx *Context) authenticatePresenceToken(token string) *presenceSettings {
+	digest := getAPITokenDigest(token)
+	userID := ctx.getVariableInHash(ctx.getPresenceTokenStoreKey(), digest)
+	if userID == "" {
+		return nil
+	}
+	ctx.UserID = userID
+	settings := ctx.getPresenceSettings()
+	if settings.TokenDigest != digest {
+		return nil
+	}
+	return settings
+}
+
+func (ctx *Context) postDirectMessage(text string, attachments []slack.Attachment) {
+	if slackToken := ctx.getSlackAccessTokenForUser(); slackToken != "" {
+		slack.New(slackToken).PostMessage(ctx.UserID, text, slack.PostMessageParameters{
+			AsUser:      true,
+			Attachments: attachments,
+		})
+	}
+}
+
+func (app *App) handlePresenceWebhook(w http.ResponseWriter, r *http.Request) {
+	app.reconnectRedisIfNeeeded()
+	ctx := app.createContext(r)
+	settings := ctx.authenticatePresenceToken(mux.Vars(r)["token"])
+	if settings == nil {
+		writeAPIError(w, http.StatusNotFound, apiError{Code: "not_found", Message: "URL が無効です"})
+		return
+	}
+	event := r.URL.Query().Get("event")
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		var body struct {
+			Event string `json:"event"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeAPIError(w, http.StatusBadRequest, apiError{Code: "invalid_request", Message: err.Error()})
+			return
+		}
+		event = body.Event
+	} else if value := r.PostFormValue("event"); value != "" {
+		event = value
+	}
+	event = normalizePresenceEvent(event)
+	if event == "" {
+		writeAPIError(w, http.StatusBadRequest, apiError{Code: "invalid_event", Message: "event is required"})
+		return
+	}
+	status, res := ctx.handlePresenceEvent(r.Context(), settings, event)
+	writeAPIResponse(w, status, res)
+}
+
+// handlePresenceEvent punches or asks the user to punch, as the rules of the user decide for the event
+func (ctx *Context) handlePresenceEvent(c context.Context, settings *presenceSettings, event string) (int, interface{}) {
+	client := ctx.createTimeTableClient(c)
+	if client.HTTPClient == nil {
+		status, res := ctx.getAPIError("", settings.TeamID, errNotAuthenticated)
+		return status, map[string]apiError{"error": res}
+	}
+	now := ctx.getCurrentTimeForUser()
+	timeTable, err := ctx.getCurrentTimeTable(c, client, now)
+	if err != nil {
+		status, res := ctx.getAPIError("勤務表の取得に失敗しました", settings.TeamID, err)
+		return status, map[string]apiError{"error": res}
+	}
+	result := presenceResult{Event: event, Result: presenceResultIgnored, Message: "該当するルールはありません"}
+	action, ok := settings.findAction(event, now, timeTable.State())
+	if !ok {
+		return http.StatusOK, result
+	}
+	result.Action = action
+	button := attendanceButtons[action]
+	if settings.getMode() == presenceModeAsk || isPresenceDisconnectEvent(event) {
+		if settings.LastAsked == action && now.Sub(settings.LastAskedAt) < presenceAskInterval {
+			result.Message = "確認済です"
+			return http.StatusOK, result
+		}
+		settings.LastAsked = action
+		settings.LastAskedAt = now
+		ctx.setPresenceSettings(settings)
+		ctx.postDirectMessage("`"+event+"` を受信しました。"+strings.TrimSuffix(button.Text, "する")+"しますか？", []slack.Attachment{{
+			CallbackID: callbackIDAttendanceButton,
+			Actions:    []slack.AttachmentAction{button},
+		}})
+		result.Result = presenceResultAsked
+		result.Message = "Slack で確認しています"
+		return http.StatusOK, result
+	}
+	punched, err := ctx.punch(c, client, queuedPunch{TeamID: settings.TeamID, Action: action, Time: now})
+	if punched.Queued != nil {
+		result.Result = presenceResultQueued
+		result.Message = "TeamSpirit に接続できないため打刻を保留しました: " + punched.Queued.Describe(now.Location())
+		ctx.postDirectMessage(result.Message, nil)
+		return http.StatusAccepted, result
+	}
+	if err != nil {
+		status, res := ctx.getAPIError("勤務表の更新に失敗しました", settings.TeamID, err)
+		ctx.postDirectMessage("`"+event+"` を受信しましたが、"+res.Message, nil)
+		return status, map[string]apiError{"error": res}
+	}
+	text := attendanceActionTexts[action] + " (" + formatTime(now) + ")"
+	ctx.postDirectMessage("`"+event+"` を受信したため"+text, nil)
+	ctx.notifyPunch(text)
+	result.Result = presenceResultPunched
+	result.Message = stripEmoji(text)
+	return http.StatusOK, result
+}
+
+func (ctx *Context) getPresenceSlackMessage(teamID string, args []string) *slack.Msg {
+	settings := ctx.getPresenceSettings()
+	command := ""
+	if len(args) > 0 {
+		command = args[0]
+	}
+	switch {
+	case command == "url":
+		url, err := ctx.createPresenceURL(teamID)
+		if err != nil {
+			return &slack.Msg{Text: "URL の発行に失敗しました :warning:"}
+		}
+		return &slack.Msg{
+			Text: "Webhook の URL を発行しました :satellite_antenna: 以前の URL は無効になりました。この URL は再表示できないため、安全な場所に保管してください\n" +
+				"```" + url + "```\n" +
+				"例: `curl -d event=vpn_disconnect " + url + "`",
+		}
+	case command == "off":
+		if !ctx.deletePresenceURL() {
+			return &slack.Msg{Text: "URL は発行されていません"}
+		}
+		return &slack.Msg{Text: "URL を無効化しました :wastebasket:"}
+	case command == "mode" && len(args) > 1 && (args[1] == presenceModeAsk || args[1] == presenceModeAuto):
+		settings.Mode = args[1]
+		ctx.setPresenceSettings(settings)
+		if settings.Mode == presenceModeAuto {
+			return &slack.Msg{Text: "イベントを受信したら自動で打刻します :robot_face: 切断のイベントは Slack で確認します"}
+		}
+		return &slack.Msg{Text: "イベントを受信したら Slack で確認します :speech_balloon:"}
+	case command == "rule" && len(args) > 1 && args[1] == "add":
+		rule, err := parsePresenceRule(args[2:])
+		if err != nil {
+			return &slack.Msg{Text: "`/ts presence rule add イベント attend|rest|unrest|leave [HH:MM-HH:MM]` の形式で指定してください :warning:"}
+		}
+		settings.Rules = append(settings.getRules(), rule)
+		ctx.setPresenceSettings(settings)
+		return &slack.Msg{Text: "ルールを追加しました: " + rule.String()}
+	case command == "rule" && len(args) > 2 && args[1] == "remove":
+		rules := settings.getRules()
+		n, err := strconv.Atoi(args[2])
+		if err != nil || n < 1 || n > len(rules) {
+			return &slack.Msg{Text: "ルール " + args[2] + " が見つかりません :warning:"}
+		}
+		rule := rules[n-1]
+		settings.Rules = append(append([]presenceRule{}, rules[:n-1]...), rules[n:]...)
+		ctx.setPresenceSettings(settings)
+		return &slack.Msg{Text: "ルールを削除しました: " + rule.String()}
+	case command == "rule" && len(args) > 1 && args[1] == "reset":
+		settings.Rules = nil
+		ctx.setPresenceSettings(settings)
+		return &slack.Msg{Text: "ルールを初期設定に戻しました"}
+	}
+	lines := []string{}
+	if settings.TokenDigest == "" {
+		lines = append(lines, "URL: 未発行")
+	} else {
+		lines = append(lines, "URL: 発行済")
+	}
+	if settings.getMode() == presenceModeAuto {
+		lines = append(lines, "動作: 自動で打刻する (切断のイベントは Slack で確認する)")
+	} else {
+		lines = append(lines, "動作: Slack で確認する")
+	}
+	lines = append(lines, "ルール (上から順に、現在の状態で可能な操作に一致したものを使います):")
+	for i, rule := range settings.getRules() {
+		lines = append(lines, strconv.Itoa(i+1)+". "+rule.String())
+	}
+	if len(settings.getRules()) == 0 {
+		lines = append(lines, "なし")
+	}
+	lines = append(lines,
+		"`/ts presence url` で URL を発行、`/ts presence off` で無効化",
+		"`/ts presence mode auto|ask` で自動打刻か確認かを選択",
+		"`/ts presence rule add イベント 操作 [HH:MM-HH:MM]`、`/ts presence rule remove 番号`、`/ts presence rule reset` でルールを変更できます")
+	return &slack.Msg{Text: strings.Join(lines, "\n")}
+}
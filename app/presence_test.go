@@ -0,0 +1,257 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+	null "gopkg.in/guregu/null.v3"
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func TestNormalizePresenceEvent(t *testing.T) {
+	Test{"vpn_disconnect", normalizePresenceEvent(" VPN Disconnect ")}.Compare(t)
+	Test{"door_unlock", normalizePresenceEvent("door-unlock")}.Compare(t)
+}
+
+func TestParsePresenceRule(t *testing.T) {
+	rule, err := parsePresenceRule([]string{"VPN-Disconnect", "leave", "17:00-"})
+	Test{nil, err}.Compare(t)
+	Test{presenceRule{Event: "vpn_disconnect", Action: actionTypeLeave, After: 1020, Before: -1}, rule}.Compare(t)
+	Test{"`vpn_disconnect` → 退勤する (17:00-)", rule.String()}.Compare(t)
+	rule, _ = parsePresenceRule([]string{"door_unlock", "attend"})
+	Test{presenceRule{Event: "door_unlock", Action: actionTypeAttend, After: -1, Before: -1}, rule}.Compare(t)
+	Test{"`door_unlock` → 出勤する", rule.String()}.Compare(t)
+	rule, _ = parsePresenceRule([]string{"lunch", "rest", "-13:30"})
+	Test{"`lunch` → 休憩を開始する (-13:30)", rule.String()}.Compare(t)
+	for _, args := range [][]string{
+		{"door_unlock"},
+		{"door_unlock", "foo"},
+		{"door_unlock", "attend", "9:00"},
+		{"door_unlock", "attend", "25:00-"},
+		{"door_unlock", "attend", "09:00-", "foo"},
+	} {
+		_, err := parsePresenceRule(args)
+		Test{errInvalidPresenceRule, err}.Compare(t)
+	}
+}
+
+func TestFindPresenceAction(t *testing.T) {
+	settings := &presenceSettings{}
+	evening := time.Date(2018, time.September, 1, 18, 0, 0, 0, time.UTC)
+	morning := time.Date(2018, time.September, 1, 9, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		event    string
+		now      time.Time
+		state    attendanceState
+		expected string
+	}{
+		{"door_unlock", morning, attendanceStateNotStarted, actionTypeAttend},
+		{"vpn_disconnect", morning, attendanceStateNotStarted, actionTypeAttend},
+		{"door_unlock", morning, attendanceStateWorking, ""},
+		{"vpn_disconnect", morning, attendanceStateWorking, ""},
+		{"vpn_disconnect", evening, attendanceStateWorking, actionTypeLeave},
+		{"vpn_disconnect", evening, attendanceStateResting, ""},
+		{"vpn_disconnect", evening, attendanceStateLeft, ""},
+	} {
+		action, ok := settings.findAction(test.event, test.now, test.state)
+		Test{test.expected, action}.Compare(t)
+		Test{test.expected != "", ok}.Compare(t)
+	}
+	settings.Rules = []presenceRule{{Event: "lunch", Action: actionTypeRest, After: 11 * 60, Before: 14 * 60}}
+	action, _ := settings.findAction("lunch", time.Date(2018, time.September, 1, 12, 0, 0, 0, time.UTC), attendanceStateWorking)
+	Test{actionTypeRest, action}.Compare(t)
+	_, ok := settings.findAction("lunch", time.Date(2018, time.September, 1, 14, 0, 0, 0, time.UTC), attendanceStateWorking)
+	Test{false, ok}.Compare(t)
+	_, ok = settings.findAction("door_unlock", morning, attendanceStateNotStarted)
+	Test{false, ok}.Compare(t)
+	settings.Rules = nil
+	_, ok = settings.findAction("door_unlock", time.Date(2018, time.September, 1, 22, 0, 0, 0, time.UTC), attendanceStateNotStarted)
+	Test{false, ok}.Compare(t)
+	Test{true, isPresenceDisconnectEvent("vpn_disconnect")}.Compare(t)
+	Test{false, isPresenceDisconnectEvent("vpn_connect")}.Compare(t)
+}
+
+func TestCreatePresenceURL(t *testing.T) {
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := app.createContext(nil)
+	ctx.UserID = "FOO"
+	url, err := ctx.createPresenceURL("T12345678")
+	token := strings.TrimPrefix(url, "https://example.com/hooks/presence/")
+	Test{nil, err}.Compare(t)
+	Test{32, len(token)}.Compare(t)
+
+	other := app.createContext(nil)
+	settings := other.authenticatePresenceToken(token)
+	Test{"FOO", other.UserID}.Compare(t)
+	Test{"T12345678", settings.TeamID}.Compare(t)
+	Test{true, app.createContext(nil).authenticatePresenceToken("foo") == nil}.Compare(t)
+
+	url, _ = ctx.createPresenceURL("T12345678")
+	Test{true, app.createContext(nil).authenticatePresenceToken(token) == nil}.Compare(t)
+	token = strings.TrimPrefix(url, "https://example.com/hooks/presence/")
+	Test{false, app.createContext(nil).authenticatePresenceToken(token) == nil}.Compare(t)
+
+	Test{true, ctx.deletePresenceURL()}.Compare(t)
+	Test{false, ctx.deletePresenceURL()}.Compare(t)
+	Test{true, app.createContext(nil).authenticatePresenceToken(token) == nil}.Compare(t)
+}
+
+func servePresenceEvent(app *App, url, contentType, body string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	req, _ := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	res := httptest.NewRecorder()
+	app.setupRouter().ServeHTTP(res, req)
+	data := map[string]interface{}{}
+	json.Unmarshal(res.Body.Bytes(), &data)
+	return res, data
+}
+
+func TestHandlePresenceWebhook(t *testing.T) {
+	defer gock.Off()
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := app.createContext(nil)
+	ctx.UserID = "FOO"
+	url, _ := ctx.createPresenceURL("T12345678")
+	settings := ctx.getPresenceSettings()
+	settings.Rules = []presenceRule{{Event: presenceEventAny, Action: actionTypeAttend, After: -1, Before: -1}}
+	ctx.setPresenceSettings(settings)
+
+	res, _ := servePresenceEvent(app, "https://example.com/hooks/presence/foo", "application/json", `{"event":"door_unlock"}`)
+	Test{404, res.Code}.Compare(t)
+
+	res, data := servePresenceEvent(app, url, "application/json", `{"event":"door_unlock"}`)
+	Test{403, res.Code}.Compare(t)
+	Test{"teamspirit_auth_required", data["error"].(map[string]interface{})["code"]}.Compare(t)
+
+	ctx.setSalesforceAccessToken(&oauth2.Token{AccessToken: "foo", RefreshToken: "bar", TokenType: "Bearer"})
+	res, data = servePresenceEvent(app, url, "application/json", `{}`)
+	Test{400, res.Code}.Compare(t)
+	Test{"invalid_event", data["error"].(map[string]interface{})["code"]}.Compare(t)
+
+	setupTimeTableGocks(nil, &[]bool{false}[0])
+	res, data = servePresenceEvent(app, url, "application/json", `{"event":"Door Unlock"}`)
+	for _, test := range []Test{
+		{200, res.Code},
+		{true, gock.IsDone()},
+		{"door_unlock", data["event"]},
+		{"attend", data["action"]},
+		{"asked", data["result"]},
+		{"attend", ctx.getPresenceSettings().LastAsked},
+	} {
+		test.Compare(t)
+	}
+
+	setupTimeTableGocks(nil, &[]bool{false}[0])
+	res, data = servePresenceEvent(app, url+"?event=door_unlock", "", "")
+	Test{"ignored", data["result"]}.Compare(t)
+	Test{"確認済です", data["message"]}.Compare(t)
+
+	ctx.getPresenceSlackMessage("T12345678", []string{"mode", "auto"})
+	setupTimeTableGocks(nil, &[]bool{false}[0])
+	setupTimeTableGocks(nil, &[]bool{false}[0])
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Put("/services/apexrest/Dakoku").
+		Reply(200).
+		BodyString(`"OK"`)
+	res, data = servePresenceEvent(app, url, "application/x-www-form-urlencoded", "event=door_unlock")
+	for _, test := range []Test{
+		{200, res.Code},
+		{true, gock.IsDone()},
+		{"attend", data["action"]},
+		{"punched", data["result"]},
+		{true, strings.HasPrefix(data["message"].(string), "出勤しました (")},
+	} {
+		test.Compare(t)
+	}
+
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Get("/services/apexrest/Dakoku").
+		Reply(200).
+		JSON(map[string]interface{}{
+			"timeTable": []map[string]interface{}{{"from": 0, "to": nil, "type": 1}},
+			"isHoliday": false,
+		})
+	res, data = servePresenceEvent(app, url, "application/x-www-form-urlencoded", "event=door_unlock")
+	Test{200, res.Code}.Compare(t)
+	Test{"ignored", data["result"]}.Compare(t)
+	Test{"該当するルールはありません", data["message"]}.Compare(t)
+}
+
+func TestHandlePresenceDisconnectEvent(t *testing.T) {
+	defer gock.Off()
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := app.createContext(nil)
+	ctx.UserID = "FOO"
+	ctx.location = getMockTime().Location()
+	ctx.now = func() time.Time { return time.Date(2018, time.September, 1, 18, 0, 0, 0, ctx.location) }
+	ctx.setSalesforceAccessToken(&oauth2.Token{AccessToken: "foo", RefreshToken: "bar", TokenType: "Bearer"})
+	settings := &presenceSettings{TeamID: "T12345678", Mode: presenceModeAuto}
+	setupTimeTableGocks([]timeTableItem{{null.IntFrom(9 * 60), null.IntFromPtr(nil), timeTableItemTypeAttendance}}, &[]bool{false}[0])
+	status, res := ctx.handlePresenceEvent(context.Background(), settings, "vpn_disconnect")
+	for _, test := range []Test{
+		{200, status},
+		{true, gock.IsDone()},
+		{actionTypeLeave, res.(presenceResult).Action},
+		{presenceResultAsked, res.(presenceResult).Result},
+		{actionTypeLeave, ctx.getPresenceSettings().LastAsked},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestGetPresenceSlackMessage(t *testing.T) {
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := app.createContext(nil)
+	ctx.UserID = "FOO"
+	help := "`/ts presence url` で URL を発行、`/ts presence off` で無効化\n" +
+		"`/ts presence mode auto|ask` で自動打刻か確認かを選択\n" +
+		"`/ts presence rule add イベント 操作 [HH:MM-HH:MM]`、`/ts presence rule remove 番号`、`/ts presence rule reset` でルールを変更できます"
+	Test{"URL: 未発行\n動作: Slack で確認する\nルール (上から順に、現在の状態で可能な操作に一致したものを使います):\n1. `*` → 出勤する (07:00-19:00)\n2. `vpn_disconnect` → 退勤する (17:00-)\n" + help, ctx.getPresenceSlackMessage("T12345678", nil).Text}.Compare(t)
+
+	text := ctx.getPresenceSlackMessage("T12345678", []string{"url"}).Text
+	Test{0, strings.Index(text, "Webhook の URL を発行しました :satellite_antenna:")}.Compare(t)
+	Test{true, strings.Contains(text, "```https://example.com/hooks/presence/")}.Compare(t)
+
+	for _, test := range []Test{
+		{"イベントを受信したら自動で打刻します :robot_face: 切断のイベントは Slack で確認します", ctx.getPresenceSlackMessage("T12345678", []string{"mode", "auto"}).Text},
+		{"ルールを追加しました: `lunch` → 休憩を開始する (11:30-13:00)", ctx.getPresenceSlackMessage("T12345678", []string{"rule", "add", "lunch", "rest", "11:30-13:00"}).Text},
+		{"`/ts presence rule add イベント attend|rest|unrest|leave [HH:MM-HH:MM]` の形式で指定してください :warning:", ctx.getPresenceSlackMessage("T12345678", []string{"rule", "add", "lunch", "sleep"}).Text},
+		{"ルールを削除しました: `*` → 出勤する (07:00-19:00)", ctx.getPresenceSlackMessage("T12345678", []string{"rule", "remove", "1"}).Text},
+		{"ルール 3 が見つかりません :warning:", ctx.getPresenceSlackMessage("T12345678", []string{"rule", "remove", "3"}).Text},
+		{"URL: 発行済\n動作: 自動で打刻する (切断のイベントは Slack で確認する)\nルール (上から順に、現在の状態で可能な操作に一致したものを使います):\n1. `vpn_disconnect` → 退勤する (17:00-)\n2. `lunch` → 休憩を開始する (11:30-13:00)\n" + help, ctx.getPresenceSlackMessage("T12345678", nil).Text},
+		{"ルールを初期設定に戻しました", ctx.getPresenceSlackMessage("T12345678", []string{"rule", "reset"}).Text},
+		{2, len(ctx.getPresenceSettings().getRules())},
+		{"イベントを受信したら Slack で確認します :speech_balloon:", ctx.getPresenceSlackMessage("T12345678", []string{"mode", "ask"}).Text},
+		{"URL を無効化しました :wastebasket:", ctx.getPresenceSlackMessage("T12345678", []string{"off"}).Text},
+		{"URL は発行されていません", ctx.getPresenceSlackMessage("T12345678", []string{"off"}).Text},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestRemoveAllPresenceRules(t *testing.T) {
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := app.createContext(nil)
+	ctx.UserID = "FOO"
+	ctx.getPresenceSlackMessage("T12345678", []string{"rule", "remove", "1"})
+	ctx.getPresenceSlackMessage("T12345678", []string{"rule", "remove", "1"})
+	for _, test := range []Test{
+		{0, len(ctx.getPresenceSettings().getRules())},
+		{true, strings.Contains(ctx.getPresenceSlackMessage("T12345678", nil).Text, "を使います):\nなし\n")},
+		{"ルールを初期設定に戻しました", ctx.getPresenceSlackMessage("T12345678", []string{"rule", "reset"}).Text},
+		{2, len(ctx.getPresenceSettings().getRules())},
+	} {
+		test.Compare(t)
+	}
+}
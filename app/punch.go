@@ -0,0 +1,92 @@
+package app
+
+import (
+	"context"
+	"errors"
+
+	"github.com/nlopes/slack"
+)
+
+var errNotAuthenticated = errors.New("not authenticated with TeamSpirit")
+
+// punchRefusedError is returned when the action is not allowed in the current state
+type punchRefusedError struct {
+	State  attendanceState
+	Action string
+}
+
+func (err *punchRefusedError) Error() string {
+	return "action " + err.Action + " is not allowed while " + err.State.String()
+}
+
+// punchResult is the outcome of an attendance action shared by Slack, the dashboard and the API
+type punchResult struct {
+	// TimeTable is the time table before the action, nil when it could not be fetched
+	TimeTable *timeTable
+	// Queued is set when TeamSpirit was unavailable and the action was queued to be replayed
+	Queued *queuedPunch
+	// Rest is set when the default rest of the team was recorded on leaving
+	Rest *timeTableItem
+	// Warnings are the violations of the compliance rules which did not block the punch
+	Warnings []complianceViolation
+}
+
+// punch applies the action of the punch at its time, and queues it when TeamSpirit is
+// temporarily unavailable
+func (ctx *Context) punch(c context.Context, client *timeTableClient, punch queuedPunch) (*punchResult, error) {
+	result := &punchResult{}
+	if client.HTTPClient == nil {
+		return result, errNotAuthenticated
+	}
+	timeTable, err := ctx.getLatestTimeTable(c, client, punch.Time)
+	if err == nil {
+		result.TimeTable = timeTable
+		if state := timeTable.State(); !state.Can(punch.Action) {
+			return result, &punchRefusedError{state, punch.Action}
+		}
+		rest, withRest := ctx.getRestPolicy(punch.TeamID).getDefaultRest(timeTable, punch.Time)
+		withRest = withRest && punch.Action == actionTypeLeave
+		preview := timeTable.preview(punch.Action, punch.Time)
+		if withRest {
+			preview.Items = append(preview.Items, rest)
+		}
+		blocking := []complianceViolation{}
+		for _, violation := range ctx.getComplianceSettings(punch.TeamID).check(preview, punch.Action, punch.Time) {
+			if violation.Block {
+				blocking = append(blocking, violation)
+			} else {
+				result.Warnings = append(result.Warnings, violation)
+			}
+		}
+		if len(blocking) > 0 {
+			return result, &complianceError{blocking}
+		}
+		if withRest {
+			if _, err = client.ApplyLeaveWithRest(c, timeTable, rest, punch.Time); err == nil {
+				result.Rest = &rest
+			}
+		} else {
+			_, err = client.applyAttendanceAction(c, timeTable, punch.Action, punch.Time)
+			if err == nil && punch.Action == actionTypeAttend && timeTable.HolidayWork != "" {
+				ctx.clearHolidayWorkReason()
+			}
+		}
+	}
+	if err != nil && isTemporaryError(err) {
+		if queued, qerr := ctx.enqueuePunch(punch); qerr == nil {
+			result.Queued = queued
+			return result, nil
+		}
+	}
+	ctx.emitPunchEvent(punch, result.TimeTable, err)
+	return result, err
+}
+
+// notifyPunch posts the text to the channel chosen with `/ts channel`
+func (ctx *Context) notifyPunch(text string) {
+	slackToken := ctx.getSlackAccessTokenForUser()
+	slackChannel := ctx.getSlackNotifyChannelForUser()
+	if slackToken != "" && slackChannel != "" {
+		slack.New(slackToken).PostMessage(slackChannel, text, slack.PostMessageParameters{AsUser: true})
+	}
+}
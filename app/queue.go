@@ -0,0 +1,220 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/nlopes/slack"
+)
+
+const (
+	actionTypeCancelPunch = "cancel-punch"
+	callbackIDPunchQueue  = "punch_queue_button"
+	queuedPunchExpiry     = 24 * time.Hour
+)
+
+type queuedPunch struct {
+	ID          string    `json:"id"`
+	TeamID      string    `json:"team_id,omitempty"`
+	Action      string    `json:"action"`
+	Time        time.Time `json:"time"`
+	ResponseURL string    `json:"response_url,omitempty"`
+	Attempts    int       `json:"attempts"`
+	LastError   string    `json:"last_error,omitempty"`
+}
+
+func (punch *queuedPunch) Describe(loc *time.Location) string {
+	label := punch.Action
+	if button, ok := attendanceButtons[punch.Action]; ok {
+		label = button.Text
+	}
+	t := punch.Time.In(loc)
+	return t.Format("01/02 ") + formatTime(t) + " " + label
+}
+
+func (ctx *Context) getPunchQueueLockKey() string {
+	return ctx.PunchQueueStoreKey + ":lock:" + ctx.UserID
+}
+
+func (ctx *Context) getQueuedPunches() []queuedPunch {
+	punches := []queuedPunch{}
+	data := ctx.getVariableInHash(ctx.PunchQueueStoreKey, ctx.UserID)
+	if data == "" {
+		return punches
+	}
+	json.Unmarshal([]byte(data), &punches)
+	return punches
+}
+
+func (ctx *Context) setQueuedPunches(punches []queuedPunch) error {
+	if len(punches) == 0 {
+		_, err := ctx.RedisConn.Do("HDEL", ctx.PunchQueueStoreKey, ctx.UserID)
+		return err
+	}
+	data, err := json.Marshal(punches)
+	if err != nil {
+		return err
+	}
+	return ctx.setVariableInHash(ctx.PunchQueueStoreKey, data)
+}
+
+func (ctx *Context) enqueuePunch(punch queuedPunch) (*queuedPunch, error) {
+	punch.ID = ctx.randomString(24)
+	if err := ctx.setQueuedPunches(append(ctx.getQueuedPunches(), punch)); err != nil {
+		return nil, err
+	}
+	return &punch, nil
+}
+
+func (ctx *Context) cancelQueuedPunch(id string) bool {
+	punches := ctx.getQueuedPunches()
+	for i, punch := range punches {
+		if punch.ID == id {
+			ctx.setQueuedPunches(append(punches[:i], punches[i+1:]...))
+			return true
+		}
+	}
+	return false
+}
+
+func (ctx *Context) replayQueuedPunch(c context.Context, client *timeTableClient, punch queuedPunch) (bool, error) {
+	timeTable, err := ctx.getLatestTimeTable(c, client, punch.Time)
+	if err != nil {
+		return false, err
+	}
+	return client.ApplyAction(c, timeTable, punch.Action, punch.Time)
+}
+
+// replayQueuedPunches sends queued punches of the user in order, and stops at the first
+// punch which failed temporarily so that the following punches are not applied before it
+func (ctx *Context) replayQueuedPunches(c context.Context) {
+	punches := ctx.getQueuedPunches()
+	if len(punches) == 0 {
+		return
+	}
+	client := ctx.createTimeTableClient(c)
+	if client.HTTPClient == nil {
+		return
+	}
+	done := map[string]bool{}
+	var pending *queuedPunch
+	for _, punch := range punches {
+		ok, err := ctx.replayQueuedPunch(c, client, punch)
+		if err != nil && isTemporaryError(err) && ctx.now().Sub(punch.Time) < queuedPunchExpiry {
+			punch.Attempts++
+			punch.LastError = err.Error()
+			pending = &punch
+			break
+		}
+		done[punch.ID] = true
+		ctx.notifyQueuedPunchResult(punch, ok && err == nil, err)
+		ctx.emitPunchEvent(punch, nil, err)
+	}
+	// Punches may have been queued or cancelled while replaying
+	remaining := []queuedPunch{}
+	for _, punch := range ctx.getQueuedPunches() {
+		if done[punch.ID] {
+			continue
+		}
+		if pending != nil && punch.ID == pending.ID {
+			punch = *pending
+		}
+		remaining = append(remaining, punch)
+	}
+	ctx.setQueuedPunches(remaining)
+}
+
+func (ctx *Context) notifyQueuedPunchResult(punch queuedPunch, ok bool, err error) {
+	description := punch.Describe(ctx.getLocationForUser())
+	text := "保留していた打刻を反映しました: " + description
+	if !ok {
+		text = "保留していた打刻を反映できませんでした :warning: " + description
+		if err != nil {
+			text += "\n" + err.Error()
+		}
+	}
+	if slackToken := ctx.getSlackAccessTokenForUser(); slackToken != "" {
+		api := slack.New(slackToken)
+		api.PostMessage(ctx.UserID, text, slack.PostMessageParameters{AsUser: true})
+		if slackChannel := ctx.getSlackNotifyChannelForUser(); ok && slackChannel != "" {
+			api.PostMessage(slackChannel, text, slack.PostMessageParameters{AsUser: true})
+		}
+		return
+	}
+	if punch.ResponseURL != "" {
+		b, _ := json.Marshal(&slack.Msg{ResponseType: "ephemeral", Text: text})
+		http.Post(punch.ResponseURL, "application/json", bytes.NewBuffer(b))
+	}
+}
+
+func (ctx *Context) getPunchQueueSlackMessage() *slack.Msg {
+	punches := ctx.getQueuedPunches()
+	if len(punches) == 0 {
+		return &slack.Msg{
+			Text: "保留中の打刻はありません",
+		}
+	}
+	loc := ctx.getLocationForUser()
+	attachments := []slack.Attachment{}
+	for _, punch := range punches {
+		text := punch.Describe(loc)
+		if punch.LastError != "" {
+			text += fmt.Sprintf(" (%d 回失敗: %s)", punch.Attempts, punch.LastError)
+		}
+		attachments = append(attachments, slack.Attachment{
+			Text:       text,
+			CallbackID: callbackIDPunchQueue,
+			Actions: []slack.AttachmentAction{
+				slack.AttachmentAction{
+					Name:  actionTypeCancelPunch,
+					Value: punch.ID,
+					Text:  "取り消す",
+					Style: "danger",
+					Type:  "button",
+				},
+			},
+		})
+	}
+	return &slack.Msg{
+		Text:        "TeamSpirit への反映を待っている打刻です",
+		Attachments: attachments,
+	}
+}
+
+// replayPunchQueue replays the punches of the users, each on only one of the instances
+func (app *App) replayPunchQueue() {
+	conn, err := app.getWorkerConn()
+	if err != nil {
+		log.Println("Failed to replay the punch queue: " + err.Error())
+		return
+	}
+	defer conn.Close()
+	userIDs, err := redis.Strings(conn.Do("HKEYS", app.PunchQueueStoreKey))
+	if err != nil {
+		log.Println("Failed to replay the punch queue: " + err.Error())
+		return
+	}
+	for _, userID := range userIDs {
+		ctx := app.createWorkerContext(conn, userID)
+		unlock, ok := ctx.tryLock(ctx.getPunchQueueLockKey(), backgroundTaskTimeout)
+		if !ok {
+			continue
+		}
+		c, cancel := context.WithTimeout(context.Background(), backgroundTaskTimeout)
+		ctx.replayQueuedPunches(c)
+		cancel()
+		unlock()
+	}
+}
+
+func (app *App) runPunchQueueWorker() {
+	for range time.Tick(app.PunchQueueInterval) {
+		app.replayPunchQueue()
+	}
+}
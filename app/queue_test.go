@@ -0,0 +1,152 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nlopes/slack"
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func TestEnqueueAndCancelPunch(t *testing.T) {
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := createTestContext(app)
+	var callCount = 0
+	ctx.randomString = func(len int) string {
+		callCount++
+		return fmt.Sprintf("punch-%d", callCount)
+	}
+	msg := ctx.getPunchQueueSlackMessage()
+	Test{"保留中の打刻はありません", msg.Text}.Compare(t)
+
+	punch, err := ctx.enqueuePunch(queuedPunch{Action: actionTypeAttend, Time: getMockTime()})
+	ctx.enqueuePunch(queuedPunch{Action: actionTypeRest, Time: getMockTime()})
+	msg = ctx.getPunchQueueSlackMessage()
+	for _, test := range []Test{
+		{nil, err},
+		{"punch-1", punch.ID},
+		{2, len(ctx.getQueuedPunches())},
+		{2, len(msg.Attachments)},
+		{"09/01 11:12 Asia/Tokyo 出勤する", msg.Attachments[0].Text},
+		{"punch-1", msg.Attachments[0].Actions[0].Value},
+		{actionTypeCancelPunch, msg.Attachments[0].Actions[0].Name},
+		{true, ctx.cancelQueuedPunch("punch-1")},
+		{false, ctx.cancelQueuedPunch("punch-1")},
+		{1, len(ctx.getQueuedPunches())},
+		{"punch-2", ctx.getQueuedPunches()[0].ID},
+		{true, ctx.cancelQueuedPunch("punch-2")},
+		{"", ctx.getVariableInHash(ctx.PunchQueueStoreKey, "FOO")},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestGetActionCallbackQueuesPunch(t *testing.T) {
+	defer gock.Off()
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := createTestContext(app)
+	ctx.RequestRetries = 0
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Get("/services/apexrest/Dakoku").
+		Reply(503)
+	msg, responseURL, err := ctx.getActionCallback(context.Background(), &slack.AttachmentActionCallback{
+		Actions:     []slack.AttachmentAction{{Name: actionTypeAttend}},
+		ResponseURL: "https://hooks.slack.test/coolhook",
+		User:        slack.User{ID: "FOO"},
+	})
+	punches := ctx.getQueuedPunches()
+	for _, test := range []Test{
+		{nil, err},
+		{"https://hooks.slack.test/coolhook", responseURL},
+		{0, strings.Index(msg.Text, "TeamSpirit に接続できないため打刻を保留しました :inbox_tray: 09/01 11:12 Asia/Tokyo 出勤する")},
+		{1, len(punches)},
+		{actionTypeAttend, punches[0].Action},
+		{"https://hooks.slack.test/coolhook", punches[0].ResponseURL},
+		{true, getMockTime().Equal(punches[0].Time)},
+		{true, gock.IsDone()},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestReplayQueuedPunches(t *testing.T) {
+	defer gock.Off()
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := createTestContext(app)
+	ctx.RequestRetries = 0
+	ctx.enqueuePunch(queuedPunch{Action: actionTypeAttend, Time: getMockTime(), ResponseURL: "https://hooks.slack.test/coolhook"})
+	ctx.enqueuePunch(queuedPunch{Action: actionTypeRest, Time: getMockTime(), ResponseURL: "https://hooks.slack.test/coolhook"})
+
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Get("/services/apexrest/Dakoku").
+		Reply(503)
+	ctx.replayQueuedPunches(context.Background())
+	punches := ctx.getQueuedPunches()
+	for _, test := range []Test{
+		{2, len(punches)},
+		{1, punches[0].Attempts},
+		{errTimeTableUnavailable.Error(), punches[0].LastError},
+		{0, punches[1].Attempts},
+		{true, gock.IsDone()},
+	} {
+		test.Compare(t)
+	}
+
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Get("/services/apexrest/Dakoku").
+		Reply(200).
+		JSON(map[string]interface{}{"timeTable": []map[string]interface{}{}})
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Post("/services/apexrest/Dakoku").
+		JSON(map[string]interface{}{"timeTable": []map[string]interface{}{{"from": 672, "to": nil, "type": 1}}}).
+		Reply(200).
+		BodyString(`"OK"`)
+	gock.New("https://hooks.slack.test").
+		Post("/coolhook").
+		Reply(200)
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Get("/services/apexrest/Dakoku").
+		Reply(200).
+		JSON(map[string]interface{}{"timeTable": []map[string]interface{}{{"from": 600, "to": 1140, "type": 1}}})
+	gock.New("https://hooks.slack.test").
+		Post("/coolhook").
+		Reply(200)
+	ctx.replayQueuedPunches(context.Background())
+	for _, test := range []Test{
+		{0, len(ctx.getQueuedPunches())},
+		{true, gock.IsDone()},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestReplayPunchQueueTakesLock(t *testing.T) {
+	defer gock.Off()
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := createTestContext(app)
+	ctx.enqueuePunch(queuedPunch{Action: actionTypeAttend, Time: getMockTime()})
+
+	// Another instance is replaying the queue of the user
+	unlock, ok := ctx.tryLock(ctx.getPunchQueueLockKey(), time.Minute)
+	Test{true, ok}.Compare(t)
+	app.replayPunchQueue()
+	Test{1, len(ctx.getQueuedPunches())}.Compare(t)
+	unlock()
+
+	// The punch has expired while TeamSpirit is unavailable
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Get("/services/apexrest/Dakoku").
+		Persist().
+		Reply(503)
+	app.replayPunchQueue()
+	Test{0, len(ctx.getQueuedPunches())}.Compare(t)
+	_, ok = ctx.tryLock(ctx.getPunchQueueLockKey(), time.Minute)
+	Test{true, ok}.Compare(t)
+}
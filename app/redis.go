@@ -1,6 +1,7 @@
 package app
 
 import (
+	"log"
 	"os"
 	"time"
 
@@ -10,36 +11,86 @@ import (
 func (app *App) reconnectRedisIfNeeeded() {
 	res, _ := app.RedisConn.Do("PING")
 	if pong, ok := res.([]byte); !ok || string(pong) != "PONG" {
-		err := app.setupRedis()
-		if err != nil {
-			panic(err)
+		if err := app.setupRedis(); err != nil {
+			log.Println("Failed to reconnect to Redis: " + err.Error())
 		}
 	}
 }
 
+// getWorkerConn returns a connection of the pool for a tick of the background worker,
+// which must not share the connection of the HTTP handlers. The caller closes it.
+func (app *App) getWorkerConn() (redis.Conn, error) {
+	conn := app.RedisPool.Get()
+	if err := conn.Err(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// createWorkerContext returns the context of the user on the connection of the worker
+func (app *App) createWorkerContext(conn redis.Conn, userID string) *Context {
+	ctx := app.createContext(nil)
+	ctx.RedisConn = conn
+	ctx.UserID = userID
+	return ctx
+}
+
+// acquireLock sets the key to the value unless it exists, and reports whether the lock was acquired
+func (ctx *Context) acquireLock(key, value string, expiry time.Duration) (bool, error) {
+	res, err := ctx.RedisConn.Do("SET", key, value, "NX", "PX", int64(expiry/time.Millisecond))
+	if err != nil {
+		return false, err
+	}
+	return res != nil, nil
+}
+
+// releaseLock deletes the key unless the lock has expired and been acquired by another
+func (ctx *Context) releaseLock(key, value string) {
+	if current, _ := redis.String(ctx.RedisConn.Do("GET", key)); current == value {
+		ctx.RedisConn.Do("DEL", key)
+	}
+}
+
+// tryLock acquires the lock without waiting, so that only one instance runs the task,
+// and returns the function to release it
+func (ctx *Context) tryLock(key string, expiry time.Duration) (func(), bool) {
+	value := ctx.randomString(32)
+	if ok, err := ctx.acquireLock(key, value, expiry); err != nil || !ok {
+		return nil, false
+	}
+	return func() { ctx.releaseLock(key, value) }, true
+}
+
 func (app *App) setupRedis() error {
+	conn, err := dialRedis()
+	if err != nil {
+		return err
+	}
+	app.RedisConn = conn
+	if app.RedisPool == nil {
+		app.RedisPool = &redis.Pool{
+			Dial:        dialRedis,
+			MaxIdle:     3,
+			IdleTimeout: 4 * time.Minute,
+		}
+	}
+	return nil
+}
+
+func dialRedis() (redis.Conn, error) {
 	connectTimeout := 1 * time.Second
 	readTimeout := 1 * time.Second
 	writeTimeout := 1 * time.Second
 
 	if url := os.Getenv("REDIS_URL"); url != "" {
-		conn, err := redis.DialURL(url,
+		return redis.DialURL(url,
 			redis.DialConnectTimeout(connectTimeout),
 			redis.DialReadTimeout(readTimeout),
 			redis.DialWriteTimeout(writeTimeout))
-		if err != nil {
-			return err
-		}
-		app.RedisConn = conn
-		return nil
 	}
-	conn, err := redis.Dial("tcp", ":6379",
+	return redis.Dial("tcp", ":6379",
 		redis.DialConnectTimeout(connectTimeout),
 		redis.DialReadTimeout(readTimeout),
 		redis.DialWriteTimeout(writeTimeout))
-	if err != nil {
-		return err
-	}
-	app.RedisConn = conn
-	return nil
 }
@@ -0,0 +1,163 @@
+package app
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nlopes/slack"
+	"gopkg.in/guregu/null.v3"
+)
+
+// restPolicy inserts the default rest of the team when a user leaves after working
+// longer than MinWorkMinutes without recording any rest
+type restPolicy struct {
+	Enabled bool `json:"enabled"`
+	// From and To are minutes from midnight
+	From           int `json:"from"`
+	To             int `json:"to"`
+	MinWorkMinutes int `json:"min_work_minutes"`
+}
+
+// defaultRestPolicy follows the Labor Standards Act, which requires rest for working more than 6 hours
+var defaultRestPolicy = restPolicy{From: 12 * 60, To: 13 * 60, MinWorkMinutes: 6 * 60}
+
+var restPolicyMinWorkMinutes = map[string]int{
+	"6h": 6 * 60,
+	"8h": 8 * 60,
+}
+
+func (ctx *Context) getRestPolicy(teamID string) restPolicy {
+	policy := defaultRestPolicy
+	if data := ctx.getVariableInHash(ctx.RestPolicyStoreKey, teamID); data != "" {
+		json.Unmarshal([]byte(data), &policy)
+	}
+	return policy
+}
+
+func (ctx *Context) setRestPolicy(teamID string, policy restPolicy) error {
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+	_, err = ctx.RedisConn.Do("HSET", ctx.RestPolicyStoreKey, teamID, data)
+	return err
+}
+
+// getDefaultRest returns the rest to insert when the user leaves at the time
+func (policy restPolicy) getDefaultRest(tt *timeTable, t time.Time) (timeTableItem, bool) {
+	rest := newRestItem(null.IntFrom(int64(policy.From)), null.IntFrom(int64(policy.To)))
+	if !policy.Enabled || tt.HasRest() || !tt.State().Can(actionTypeLeave) {
+		return rest, false
+	}
+	item := tt.attendanceItem()
+	if item == nil || !item.From.Valid {
+		return rest, false
+	}
+	leave := tt.convertTime(t).Int64
+	work := int(leave - item.From.Int64)
+	if work <= policy.MinWorkMinutes {
+		return rest, false
+	}
+	// A window shorter than the rest required by law for the hours is extended
+	if to := policy.From + getStatutoryRestMinutes(work); to > policy.To {
+		rest.To = null.IntFrom(int64(to))
+	}
+	// The rest must be within the working hours to be accepted by TeamSpirit
+	return rest, item.From.Int64 <= int64(policy.From) && rest.To.Int64 <= leave
+}
+
+// getStatutoryRestMinutes returns the rest required by the Labor Standards Act for the minutes
+// from attending to leaving, which is 60 if the work exceeds 8 hours even after resting 45 minutes
+func getStatutoryRestMinutes(minutes int) int {
+	switch {
+	case minutes-45 > 8*60:
+		return 60
+	case minutes > 6*60:
+		return 45
+	}
+	return 0
+}
+
+func (policy restPolicy) String() string {
+	if !policy.Enabled {
+		return "無効"
+	}
+	text := strconv.Itoa(policy.MinWorkMinutes/60) + " 時間を超えて勤務し、休憩が記録されていない場合に " + formatClock(policy.From) + "-" + formatClock(policy.To) + " の休憩を追加"
+	if policy.To-policy.From < 60 {
+		text += " (法定の休憩時間に満たない場合は延長)"
+	}
+	return text
+}
+
+// getAddedRestText explains the rest recorded on leaving, if any
+func getAddedRestText(rest *timeTableItem) string {
+	if rest == nil {
+		return ""
+	}
+	return "\n休憩が記録されていなかったため、" + formatMinutes(rest.From) + "-" + formatMinutes(rest.To) + " の休憩を追加しました"
+}
+
+// getAttendanceButtons returns the buttons of the actions allowed in the current state.
+// The confirmation of leaving explains the rest to be inserted.
+func (ctx *Context) getAttendanceButtons(teamID string, tt *timeTable, now time.Time) []slack.AttachmentAction {
+	buttons := []slack.AttachmentAction{}
+	for _, action := range tt.State().AllowedActions() {
+		button := attendanceButtons[action]
+		if rest, ok := ctx.getRestPolicy(teamID).getDefaultRest(tt, now); action == actionTypeLeave && ok {
+			confirm := *button.Confirm
+			confirm.Text += "\n休憩が記録されていないため、" + formatMinutes(rest.From) + "-" + formatMinutes(rest.To) + " の休憩を追加します"
+			button.Confirm = &confirm
+		}
+		buttons = append(buttons, button)
+	}
+	return buttons
+}
+
+func (ctx *Context) getRestPolicySlackMessage(state State, args []string) (*slack.Msg, error) {
+	policy := ctx.getRestPolicy(state.TeamID)
+	if len(args) == 0 {
+		return &slack.Msg{
+			Text: "休憩の自動追加: " + policy.String() + "\n" +
+				"`/ts autorest on [HH:MM-HH:MM] [6h|8h]` で有効化、`/ts autorest off` で無効化できます (管理者のみ)",
+		}, nil
+	}
+	switch err := ctx.checkSlackTeamAdmin(); err {
+	case nil:
+	case errSlackNotAuthorized:
+		return ctx.getAuthenticateSlackMessage(state)
+	case errNotSlackTeamAdmin:
+		return &slack.Msg{Text: "休憩の自動追加は Slack ワークスペースの管理者のみ設定できます :no_entry_sign:"}, nil
+	default:
+		return &slack.Msg{Text: "Slack のユーザー情報の取得に失敗しました :warning:"}, nil
+	}
+	switch args[0] {
+	case "on":
+		for _, arg := range args[1:] {
+			if minutes, ok := restPolicyMinWorkMinutes[arg]; ok {
+				policy.MinWorkMinutes = minutes
+				continue
+			}
+			window := strings.SplitN(arg, "-", 2)
+			from, err := parseClock(window[0])
+			if err != nil || len(window) != 2 || from < 0 {
+				return &slack.Msg{Text: "`/ts autorest on [HH:MM-HH:MM] [6h|8h]` の形式で指定してください :warning:"}, nil
+			}
+			to, err := parseClock(window[1])
+			if err != nil || to <= from {
+				return &slack.Msg{Text: "`/ts autorest on [HH:MM-HH:MM] [6h|8h]` の形式で指定してください :warning:"}, nil
+			}
+			policy.From, policy.To = from, to
+		}
+		policy.Enabled = true
+	case "off":
+		policy.Enabled = false
+	default:
+		return &slack.Msg{Text: "`/ts autorest on [HH:MM-HH:MM] [6h|8h]` か `/ts autorest off` を指定してください :warning:"}, nil
+	}
+	if err := ctx.setRestPolicy(state.TeamID, policy); err != nil {
+		return &slack.Msg{Text: "設定の保存に失敗しました :warning:"}, nil
+	}
+	return &slack.Msg{Text: "休憩の自動追加を変更しました: " + policy.String()}, nil
+}
@@ -0,0 +1,168 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nlopes/slack"
+	"golang.org/x/oauth2"
+	null "gopkg.in/guregu/null.v3"
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func TestGetDefaultRest(t *testing.T) {
+	loc := getMockTime().Location()
+	policy := restPolicy{Enabled: true, From: 12 * 60, To: 13 * 60, MinWorkMinutes: 6 * 60}
+	working := &timeTable{Items: []timeTableItem{{null.IntFrom(9 * 60), null.IntFromPtr(nil), timeTableItemTypeAttendance}}}
+	resting := &timeTable{Items: []timeTableItem{
+		{null.IntFrom(9 * 60), null.IntFromPtr(nil), timeTableItemTypeAttendance},
+		{null.IntFrom(12 * 60), null.IntFrom(12*60 + 30), timeTableItemTypeRest},
+	}}
+	afternoon := &timeTable{Items: []timeTableItem{{null.IntFrom(13 * 60), null.IntFromPtr(nil), timeTableItemTypeAttendance}}}
+	for _, test := range []struct {
+		policy   restPolicy
+		tt       *timeTable
+		hour     int
+		expected bool
+	}{
+		{policy, working, 18, true},
+		{policy, working, 15, false},
+		{restPolicy{Enabled: true, From: 12 * 60, To: 13 * 60, MinWorkMinutes: 8 * 60}, working, 17, false},
+		{restPolicy{Enabled: true, From: 12 * 60, To: 13 * 60, MinWorkMinutes: 8 * 60}, working, 18, true},
+		{defaultRestPolicy, working, 18, false},
+		{policy, resting, 18, false},
+		{policy, afternoon, 21, false},
+		{policy, &timeTable{}, 18, false},
+	} {
+		rest, ok := test.policy.getDefaultRest(test.tt, time.Date(2018, time.September, 3, test.hour, 0, 0, 0, loc))
+		Test{test.expected, ok}.Compare(t)
+		Test{newRestItem(null.IntFrom(12*60), null.IntFrom(13*60)), rest}.Compare(t)
+	}
+	short := restPolicy{Enabled: true, From: 12 * 60, To: 12*60 + 30, MinWorkMinutes: 6 * 60}
+	for _, test := range []struct {
+		hour     int
+		expected int64
+		ok       bool
+	}{
+		{15, 12*60 + 30, false},
+		{16, 12*60 + 45, true},
+		{17, 12*60 + 45, true},
+		{18, 13 * 60, true},
+	} {
+		rest, ok := short.getDefaultRest(working, time.Date(2018, time.September, 3, test.hour, 0, 0, 0, loc))
+		Test{test.ok, ok}.Compare(t)
+		Test{newRestItem(null.IntFrom(12*60), null.IntFrom(test.expected)), rest}.Compare(t)
+	}
+}
+
+func TestGetStatutoryRestMinutes(t *testing.T) {
+	Test{0, getStatutoryRestMinutes(6 * 60)}.Compare(t)
+	Test{45, getStatutoryRestMinutes(6*60 + 1)}.Compare(t)
+	Test{45, getStatutoryRestMinutes(8*60 + 45)}.Compare(t)
+	Test{60, getStatutoryRestMinutes(8*60 + 46)}.Compare(t)
+}
+
+func TestGetAttendanceButtons(t *testing.T) {
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := app.createContext(nil)
+	tt := &timeTable{Items: []timeTableItem{{null.IntFrom(9 * 60), null.IntFromPtr(nil), timeTableItemTypeAttendance}}}
+	now := time.Date(2018, time.September, 3, 18, 0, 0, 0, getMockTime().Location())
+	buttons := ctx.getAttendanceButtons("T12345678", tt, now)
+	Test{2, len(buttons)}.Compare(t)
+	Test{attendanceButtons[actionTypeRest], buttons[0]}.DeepEqual(t)
+	Test{attendanceButtons[actionTypeLeave], buttons[1]}.DeepEqual(t)
+
+	ctx.setRestPolicy("T12345678", restPolicy{Enabled: true, From: 12 * 60, To: 13 * 60, MinWorkMinutes: 6 * 60})
+	buttons = ctx.getAttendanceButtons("T12345678", tt, now)
+	Test{"退勤しますか？\n休憩が記録されていないため、12:00-13:00 の休憩を追加します", buttons[1].Confirm.Text}.Compare(t)
+	Test{"退勤しますか？", attendanceButtons[actionTypeLeave].Confirm.Text}.Compare(t)
+}
+
+func TestPunchLeaveWithDefaultRest(t *testing.T) {
+	defer gock.Off()
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := app.createContext(nil)
+	ctx.UserID = "FOO"
+	ctx.setSalesforceAccessToken(&oauth2.Token{AccessToken: "foo", RefreshToken: "bar", TokenType: "Bearer"})
+	ctx.setRestPolicy("T12345678", restPolicy{Enabled: true, From: 12 * 60, To: 13 * 60, MinWorkMinutes: 6 * 60})
+	setupTimeTableGocks([]timeTableItem{
+		{null.IntFrom(9 * 60), null.IntFromPtr(nil), timeTableItemTypeAttendance},
+	}, &[]bool{false}[0])
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Post("/services/apexrest/Dakoku").
+		JSON(map[string]interface{}{
+			"timeTable": []map[string]interface{}{
+				{"from": 540, "to": 1080, "type": 1},
+				{"from": 720, "to": 780, "type": 21},
+			},
+		}).
+		Reply(200).
+		BodyString(`"OK"`)
+	now := time.Date(2018, time.September, 3, 18, 0, 0, 0, getMockTime().Location())
+	ctx.now = func() time.Time { return now }
+	result, err := ctx.punch(context.Background(), ctx.createTimeTableClient(context.Background()), queuedPunch{TeamID: "T12345678", Action: actionTypeLeave, Time: now})
+	for _, test := range []Test{
+		{nil, err},
+		{true, gock.IsDone()},
+		{true, result.Rest != nil},
+		{"\n休憩が記録されていなかったため、12:00-13:00 の休憩を追加しました", getAddedRestText(result.Rest)},
+		{"", getAddedRestText(nil)},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestGetRestPolicySlackMessage(t *testing.T) {
+	defer gock.Off()
+	defer gock.RestoreClient(slack.HTTPClient)
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := app.createContext(nil)
+	ctx.UserID = "FOO"
+	state := State{TeamID: "T12345678", UserID: "FOO"}
+	help := "\n`/ts autorest on [HH:MM-HH:MM] [6h|8h]` で有効化、`/ts autorest off` で無効化できます (管理者のみ)"
+
+	msg, _ := ctx.getRestPolicySlackMessage(state, []string{})
+	Test{"休憩の自動追加: 無効" + help, msg.Text}.Compare(t)
+	msg, _ = ctx.getRestPolicySlackMessage(state, []string{"on"})
+	Test{"Slack で認証を行って、再度 `/ts channel` コマンドを実行してください :bow:", msg.Attachments[0].Text}.Compare(t)
+
+	ctx.setSlackAccessToken("xoxp-foo")
+	client := &http.Client{Transport: &http.Transport{}}
+	gock.InterceptClient(client)
+	slack.SetHTTPClient(client)
+	gock.New("https://slack.com").
+		Post("/api/users.info").
+		Reply(200).
+		JSON(map[string]interface{}{"ok": true, "user": map[string]interface{}{"id": "FOO", "is_admin": false}})
+	msg, _ = ctx.getRestPolicySlackMessage(state, []string{"on"})
+	Test{"休憩の自動追加は Slack ワークスペースの管理者のみ設定できます :no_entry_sign:", msg.Text}.Compare(t)
+
+	gock.New("https://slack.com").
+		Post("/api/users.info").
+		Persist().
+		Reply(200).
+		JSON(map[string]interface{}{"ok": true, "user": map[string]interface{}{"id": "FOO", "is_admin": true}})
+	for _, test := range []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"on"}, "休憩の自動追加を変更しました: 6 時間を超えて勤務し、休憩が記録されていない場合に 12:00-13:00 の休憩を追加"},
+		{[]string{"on", "11:30-12:30", "8h"}, "休憩の自動追加を変更しました: 8 時間を超えて勤務し、休憩が記録されていない場合に 11:30-12:30 の休憩を追加"},
+		{[]string{"on", "12:00-12:30", "8h"}, "休憩の自動追加を変更しました: 8 時間を超えて勤務し、休憩が記録されていない場合に 12:00-12:30 の休憩を追加 (法定の休憩時間に満たない場合は延長)"},
+		{[]string{"on", "11:30-12:30", "8h"}, "休憩の自動追加を変更しました: 8 時間を超えて勤務し、休憩が記録されていない場合に 11:30-12:30 の休憩を追加"},
+		{[]string{"on", "13:00-12:00"}, "`/ts autorest on [HH:MM-HH:MM] [6h|8h]` の形式で指定してください :warning:"},
+		{[]string{"on", "7h"}, "`/ts autorest on [HH:MM-HH:MM] [6h|8h]` の形式で指定してください :warning:"},
+		{[]string{"foo"}, "`/ts autorest on [HH:MM-HH:MM] [6h|8h]` か `/ts autorest off` を指定してください :warning:"},
+		{[]string{}, "休憩の自動追加: 8 時間を超えて勤務し、休憩が記録されていない場合に 11:30-12:30 の休憩を追加" + help},
+		{[]string{"off"}, "休憩の自動追加を変更しました: 無効"},
+	} {
+		msg, _ := ctx.getRestPolicySlackMessage(state, test.args)
+		Test{test.expected, msg.Text}.Compare(t)
+	}
+	Test{restPolicy{From: 11*60 + 30, To: 12*60 + 30, MinWorkMinutes: 8 * 60}, ctx.getRestPolicy("T12345678")}.Compare(t)
+}
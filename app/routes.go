@@ -2,28 +2,48 @@ package app
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"fmt"
 	"net/http"
 	"net/url"
+	"strings"
+	"time"
 
 	"golang.org/x/oauth2"
 
 	"github.com/gorilla/mux"
+	"github.com/gorilla/sessions"
 	"github.com/nlopes/slack"
 )
 
+const (
+	// backgroundTaskTimeout limits work continued after responding to Slack
+	backgroundTaskTimeout = 2 * time.Minute
+	// salesforceSessionName is the cookie binding the Salesforce OAuth flow to the browser
+	salesforceSessionName   = "ts-dakoku-salesforce"
+	salesforceSessionExpiry = 10 * time.Minute
+)
+
 func (app *App) setupRouter() *mux.Router {
 	router := mux.NewRouter()
 	router.HandleFunc("/", app.handleIndex).Methods(http.MethodGet)
 	router.HandleFunc("/favicon.ico", app.handleFavicon).Methods(http.MethodGet)
 	router.HandleFunc("/success", app.handleAuthSuccess).Methods(http.MethodGet)
+	router.HandleFunc("/dashboard", app.handleDashboard).Methods(http.MethodGet)
+	router.HandleFunc("/dashboard/punch", app.handleDashboardPunch).Methods(http.MethodPost)
+	router.HandleFunc("/dashboard/settings", app.handleDashboardSettings).Methods(http.MethodPost)
+	router.HandleFunc("/login", app.handleLogin).Methods(http.MethodGet)
+	router.HandleFunc("/login/callback", app.handleLoginCallback).Methods(http.MethodGet)
+	router.HandleFunc("/logout", app.handleLogout).Methods(http.MethodPost)
 	router.HandleFunc("/oauth/salesforce/callback", app.handleSalesforceOAuthCallback).Methods(http.MethodGet)
 	router.HandleFunc("/oauth/salesforce/authenticate/{state}", app.handleSalesforceAuthenticate).Methods(http.MethodGet)
 	router.HandleFunc("/oauth/slack/callback", app.handleSlackOAuthCallback).Methods(http.MethodGet)
 	router.HandleFunc("/oauth/slack/authenticate/{team}/{state}", app.handleSlackAuthenticate).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/timetable", app.handleAPITimeTable).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/punch", app.handleAPIPunch).Methods(http.MethodPost)
 	router.HandleFunc("/hooks/slash", app.handleSlashCommand).Methods(http.MethodPost)
 	router.HandleFunc("/hooks/interactive", app.handleActionCallback).Methods(http.MethodPost)
+	router.HandleFunc("/hooks/presence/{token}", app.handlePresenceWebhook).Methods(http.MethodPost)
 	return router
 }
 
@@ -39,6 +59,12 @@ func (app *App) handleFavicon(w http.ResponseWriter, r *http.Request) {
 	app.handleAsset("favicon.ico", w, r)
 }
 
+func (app *App) handleAuthError(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusBadRequest)
+	app.handleAsset("error.html", w, r)
+}
+
 func (app *App) handleAsset(filename string, w http.ResponseWriter, r *http.Request) {
 	data, err := Asset("assets/" + filename)
 	if err != nil {
@@ -63,7 +89,7 @@ func (app *App) handleSlackAuthenticate(w http.ResponseWriter, r *http.Request)
 		"client_id":    []string{app.SlackClientID},
 		"redirect_uri": []string{ctx.getSlackOAuthCallbackURL()},
 		"state":        []string{stateKey},
-		"scope":        []string{"chat:write:user"},
+		"scope":        []string{"chat:write:user users:read"},
 		"team":         []string{team},
 	}
 	url := "https://slack.com/oauth/authorize?" + q.Encode()
@@ -82,9 +108,12 @@ func (app *App) handleSlackOAuthCallback(w http.ResponseWriter, r *http.Request)
 		return
 	}
 	state := ctx.getState(stateKey)
+	if state == nil {
+		app.handleAuthError(w, r)
+		return
+	}
 	ctx.UserID = state.UserID
 	ctx.setSlackAccessToken(token)
-	ctx.deleteState(stateKey)
 	go func() {
 		params, _ := ctx.getChannelSelectSlackMessage()
 		params.Text = "認証が完了しました :white_check_mark:"
@@ -104,9 +133,25 @@ func (app *App) handleSalesforceAuthenticate(w http.ResponseWriter, r *http.Requ
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
+	session, _ := app.SessionStore.Get(r, salesforceSessionName)
+	session.Options = &sessions.Options{
+		Path:     "/oauth/salesforce",
+		MaxAge:   int(salesforceSessionExpiry / time.Second),
+		Secure:   app.isSecure(),
+		HttpOnly: true,
+	}
+	verifier := newCodeVerifier()
+	session.Values["state"] = stateKey
+	session.Values["verifier"] = verifier
+	if err := session.Save(r, w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	config := ctx.getSalesforceOAuth2Config()
 	config.Scopes = []string{"refresh_token", "full"}
-	url := config.AuthCodeURL(stateKey, oauth2.AccessTypeOffline)
+	url := config.AuthCodeURL(stateKey, oauth2.AccessTypeOffline,
+		oauth2.SetAuthURLParam("code_challenge", getCodeChallenge(verifier)),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"))
 	http.Redirect(w, r, url, http.StatusSeeOther)
 }
 
@@ -115,14 +160,28 @@ func (app *App) handleSalesforceOAuthCallback(w http.ResponseWriter, r *http.Req
 	code := r.URL.Query().Get("code")
 	stateKey := r.URL.Query().Get("state")
 	ctx := app.createContext(r)
-	token, err := ctx.getSalesforceAccessToken(code, stateKey)
+	state := ctx.getState(stateKey)
+	session, _ := app.SessionStore.Get(r, salesforceSessionName)
+	verifier, _ := session.Values["verifier"].(string)
+	if state == nil || stateKey == "" || session.Values["state"] != stateKey || verifier == "" {
+		app.handleAuthError(w, r)
+		return
+	}
+	token, err := ctx.getSalesforceAccessToken(code, verifier)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	state := ctx.getState(stateKey)
+	session.Options = &sessions.Options{
+		Path:     "/oauth/salesforce",
+		MaxAge:   -1,
+		Secure:   app.isSecure(),
+		HttpOnly: true,
+	}
+	session.Save(r, w)
 	ctx.UserID = state.UserID
 	ctx.setSalesforceAccessToken(token)
+	ctx.setTokenHealth(tokenHealth{TeamID: state.TeamID})
 	http.Redirect(w, r, ctx.getSlackAuthenticateURL(state.TeamID, stateKey), http.StatusFound)
 }
 
@@ -144,7 +203,9 @@ func (app *App) handleSlashCommand(w http.ResponseWriter, r *http.Request) {
 	ctx.UserID = s.UserID
 
 	go func() {
-		params, _ := ctx.getSlackMessage(s)
+		c, cancel := context.WithTimeout(context.Background(), backgroundTaskTimeout)
+		defer cancel()
+		params, _ := ctx.getSlackMessage(c, s)
 		b, _ := json.Marshal(params)
 		http.Post(s.ResponseURL, "application/json", bytes.NewBuffer(b))
 	}()
@@ -183,18 +244,48 @@ func (app *App) handleActionCallback(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(text))
 		return
 	}
-	go func() {
-		params, responseURL, err := ctx.getActionCallback(&data)
-		if err != nil && params == nil && responseURL != "" {
-			http.Post(responseURL, "text/plain", bytes.NewBufferString(err.Error()))
+	if data.CallbackID == callbackIDHolidayWork {
+		// The trigger expires in 3 seconds, so the dialog is opened before responding
+		if err := ctx.openHolidayWorkDialog(data.TriggerID); err != nil {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("`/ts holiday 理由` の形式で休日出勤の理由を入力してください"))
+		}
+		return
+	}
+	if data.CallbackID == callbackIDHolidayWorkDialog {
+		var submission slackDialogSubmission
+		json.Unmarshal([]byte(payload), &submission)
+		reason := strings.TrimSpace(submission.Submission[holidayWorkReasonField])
+		if message := validateHolidayWorkReason(reason); message != "" {
+			writeAPIResponse(w, http.StatusOK, slackDialogErrors{[]slackDialogError{{Name: holidayWorkReasonField, Error: message}}})
 			return
-		} else if err != nil {
-			fmt.Printf("Handle Action Callback Error: %+v\n", err.Error())
 		}
-		slackToken := ctx.getSlackAccessTokenForUser()
-		slackChannel := ctx.getSlackNotifyChannelForUser()
-		if slackToken != "" && slackChannel != "" {
-			slack.New(slackToken).PostMessage(slackChannel, params.Text, slack.PostMessageParameters{AsUser: true})
+		go func() {
+			c, cancel := context.WithTimeout(context.Background(), backgroundTaskTimeout)
+			defer cancel()
+			b, _ := json.Marshal(ctx.getHolidayWorkDialogCallback(c, &submission, reason))
+			http.Post(submission.ResponseURL, "application/json", bytes.NewBuffer(b))
+		}()
+		return
+	}
+	if data.CallbackID == callbackIDPunchQueue {
+		text := "既に反映済か、取り消し済です"
+		if ctx.cancelQueuedPunch(data.Actions[0].Value) {
+			text = "保留中の打刻を取り消しました :wastebasket:"
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(text))
+		return
+	}
+	go func() {
+		c, cancel := context.WithTimeout(context.Background(), backgroundTaskTimeout)
+		defer cancel()
+		params, responseURL, err := ctx.getActionCallback(c, &data)
+		if err != nil && params == nil {
+			if responseURL != "" {
+				http.Post(responseURL, "text/plain", bytes.NewBufferString(err.Error()))
+			}
+			return
 		}
 		b, _ := json.Marshal(params)
 		http.Post(responseURL, "application/json", bytes.NewBuffer(b))
@@ -1,6 +1,7 @@
 package app
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -28,12 +29,21 @@ func TestSetupRouter(t *testing.T) {
 		"/",
 		"/favicon.ico",
 		"/success",
+		"/dashboard",
+		"/dashboard/punch",
+		"/dashboard/settings",
+		"/login",
+		"/login/callback",
+		"/logout",
 		"/oauth/salesforce/callback",
 		"/oauth/salesforce/authenticate/{state}",
 		"/oauth/slack/callback",
 		"/oauth/slack/authenticate/{team}/{state}",
+		"/api/v1/timetable",
+		"/api/v1/punch",
 		"/hooks/slash",
 		"/hooks/interactive",
+		"/hooks/presence/{token}",
 	}, paths}.DeepEqual(t)
 }
 
@@ -103,14 +113,31 @@ func TestHandleSalesforceAuthenticate(t *testing.T) {
 	state, _ := ctx.storeState(State{TeamID: "T123456"})
 	req, _ = http.NewRequest(http.MethodGet, "https://example.com/oauth/salesforce/authenticate/"+state, nil)
 	app.setupRouter().ServeHTTP(res, req)
+	location, _ := url.Parse(res.Header().Get("Location"))
+	query := location.Query()
+	challenge := query.Get("code_challenge")
+	query.Del("code_challenge")
+	location.RawQuery = query.Encode()
+	req.AddCookie(res.Result().Cookies()[0])
+	session, _ := app.SessionStore.Get(req, salesforceSessionName)
 	for _, test := range []Test{
 		{303, res.Code},
-		{"https://login.salesforce.com/services/oauth2/authorize?access_type=offline&client_id=SALESFORCE_CLIENT_ID+is+set%21&redirect_uri=https%3A%2F%2Fexample.com%2Foauth%2Fsalesforce%2Fcallback&response_type=code&scope=refresh_token+full&state=" + state, res.Header().Get("Location")},
+		{"https://test.salesforce.com/services/oauth2/authorize?access_type=offline&client_id=SALESFORCE_CLIENT_ID+is+set%21&code_challenge_method=S256&redirect_uri=https%3A%2F%2Fexample.com%2Foauth%2Fsalesforce%2Fcallback&response_type=code&scope=refresh_token+full&state=" + state, location.String()},
+		{state, session.Values["state"]},
+		{getCodeChallenge(session.Values["verifier"].(string)), challenge},
+		{43, len(challenge)},
 	} {
 		test.Compare(t)
 	}
 }
 
+func startSalesforceAuthentication(app *App, state string) []*http.Cookie {
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/oauth/salesforce/authenticate/"+state, nil)
+	app.setupRouter().ServeHTTP(res, req)
+	return res.Result().Cookies()
+}
+
 func TestHandleSlackAuthenticate(t *testing.T) {
 	app := createMockApp()
 	app.CleanRedis()
@@ -123,7 +150,7 @@ func TestHandleSlackAuthenticate(t *testing.T) {
 	app.setupRouter().ServeHTTP(res, req)
 	for _, test := range []Test{
 		{303, res.Code},
-		{"https://slack.com/oauth/authorize?client_id=ok&redirect_uri=https%3A%2F%2Fexample.com%2Foauth%2Fslack%2Fcallback&scope=chat%3Awrite%3Auser&state=" + state + "&team=T12345678", res.Header().Get("Location")},
+		{"https://slack.com/oauth/authorize?client_id=SLACK_CLIENT_ID+is+set%21&redirect_uri=https%3A%2F%2Fexample.com%2Foauth%2Fslack%2Fcallback&scope=chat%3Awrite%3Auser+users%3Aread&state=" + state + "&team=T12345678", res.Header().Get("Location")},
 	} {
 		test.Compare(t)
 	}
@@ -181,6 +208,9 @@ func TestHandleSalesforceOAuthCallback(t *testing.T) {
 	token := ctx.getSalesforceAccessTokenForUser()
 	Test{true, token == nil}.Compare(t)
 	req, _ = http.NewRequest(http.MethodGet, "https://example.com/oauth/salesforce/callback?state="+state+"&code=fjkfjk", nil)
+	for _, cookie := range startSalesforceAuthentication(app, state) {
+		req.AddCookie(cookie)
+	}
 	app.setupRouter().ServeHTTP(res, req)
 	token = ctx.getSalesforceAccessTokenForUser()
 	for _, test := range []Test{
@@ -210,6 +240,9 @@ func TestHandleSalesforceOAuthCallbackError(t *testing.T) {
 	ctx.UserID = "FOO"
 	state, _ := ctx.storeState(State{TeamID: "T123456"})
 	req, _ = http.NewRequest(http.MethodGet, "https://example.com/oauth/salesforce/callback?state="+state+"&code=fjkfjk", nil)
+	for _, cookie := range startSalesforceAuthentication(app, state) {
+		req.AddCookie(cookie)
+	}
 	app.setupRouter().ServeHTTP(res, req)
 	for _, test := range []Test{
 		{500, res.Code},
@@ -218,6 +251,74 @@ func TestHandleSalesforceOAuthCallbackError(t *testing.T) {
 	}
 }
 
+func TestHandleSalesforceOAuthCallbackWithPKCE(t *testing.T) {
+	defer gock.Off()
+	app := createMockApp()
+	app.CleanRedis()
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/", nil)
+	ctx := app.createContext(req)
+	ctx.UserID = "FOO"
+	state, _ := ctx.storeState(State{TeamID: "T123456", UserID: "FOO"})
+	req, _ = http.NewRequest(http.MethodGet, "https://example.com/oauth/salesforce/callback?state="+state+"&code=fjkfjk", nil)
+	for _, cookie := range startSalesforceAuthentication(app, state) {
+		req.AddCookie(cookie)
+	}
+	session, _ := app.SessionStore.Get(req, salesforceSessionName)
+	gock.New("https://test.salesforce.com").
+		Post("/services/oauth2/token").
+		BodyString("code=fjkfjk&code_verifier=" + session.Values["verifier"].(string) + "&grant_type=authorization_code").
+		Reply(200).
+		JSON(map[string]interface{}{
+			"access_token":  "foo",
+			"refresh_token": "bar",
+			"token_type":    "Bearer",
+		})
+	res := httptest.NewRecorder()
+	app.setupRouter().ServeHTTP(res, req)
+	token := ctx.getSalesforceAccessTokenForUser()
+	for _, test := range []Test{
+		{302, res.Code},
+		{true, gock.IsDone()},
+		{"https://example.com/oauth/slack/authenticate/T123456/" + state, res.Header().Get("Location")},
+		{false, token == nil},
+		{"foo", token.AccessToken},
+		{true, strings.Contains(res.Header().Get("Set-Cookie"), "Max-Age=0")},
+		{true, strings.Contains(res.Header().Get("Set-Cookie"), "Path=/oauth/salesforce;")},
+		{true, strings.Contains(res.Header().Get("Set-Cookie"), "HttpOnly")},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestHandleSalesforceOAuthCallbackInvalidState(t *testing.T) {
+	app := createMockApp()
+	app.CleanRedis()
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/", nil)
+	ctx := app.createContext(req)
+	ctx.UserID = "FOO"
+	state, _ := ctx.storeState(State{TeamID: "T123456", UserID: "FOO"})
+	other, _ := ctx.storeState(State{TeamID: "T123456", UserID: "FOO"})
+	cookies := startSalesforceAuthentication(app, other)
+	for _, test := range []struct {
+		query   string
+		cookies []*http.Cookie
+	}{
+		{"state=unknown&code=fjkfjk", cookies},
+		{"code=fjkfjk", cookies},
+		{"state=" + state + "&code=fjkfjk", nil},
+		{"state=" + state + "&code=fjkfjk", cookies},
+	} {
+		res := httptest.NewRecorder()
+		req, _ = http.NewRequest(http.MethodGet, "https://example.com/oauth/salesforce/callback?"+test.query, nil)
+		for _, cookie := range test.cookies {
+			req.AddCookie(cookie)
+		}
+		app.setupRouter().ServeHTTP(res, req)
+		Test{400, res.Code}.Compare(t)
+		Test{true, strings.Contains(res.Body.String(), "認証エラー")}.Compare(t)
+	}
+}
+
 func TestHandleSlackOAuthCallback(t *testing.T) {
 	defer gock.Off()
 	defer gock.RestoreClient(slack.HTTPClient)
@@ -358,7 +459,7 @@ func TestHandleActionCallback(t *testing.T) {
 		Get("/services/apexrest/Dakoku").
 		Reply(200).
 		JSON(map[string]interface{}{
-			"timeTable": []map[string]interface{}{{"from": 1, "to": 2, "type": 1}},
+			"timeTable": []map[string]interface{}{},
 			"isHoliday": false,
 		})
 
@@ -430,3 +531,54 @@ func TestHandleActionCallback(t *testing.T) {
 		test.Compare(t)
 	}
 }
+
+func postInteractivePayload(app *App, payload interface{}) *httptest.ResponseRecorder {
+	b, _ := json.Marshal(payload)
+	res := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodPost, "https://example.com/hooks/interactive", strings.NewReader(url.Values{"payload": {string(b)}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	app.setupRouter().ServeHTTP(res, req)
+	return res
+}
+
+func TestHandleHolidayWorkCallback(t *testing.T) {
+	defer gock.Off()
+	app := createMockApp()
+	app.CleanRedis()
+	button := map[string]interface{}{
+		"callback_id": callbackIDHolidayWork,
+		"token":       app.SlackVerificationToken,
+		"trigger_id":  "123.456",
+		"user":        map[string]interface{}{"id": "FOO"},
+		"actions":     []map[string]interface{}{{"name": actionTypeHolidayWork}},
+	}
+	res := postInteractivePayload(app, button)
+	Test{200, res.Code}.Compare(t)
+	Test{"`/ts holiday 理由` の形式で休日出勤の理由を入力してください", res.Body.String()}.Compare(t)
+
+	ctx := app.createContext(nil)
+	ctx.UserID = "FOO"
+	ctx.setSlackAccessToken("xoxp-foo")
+	gock.New("https://slack.com").
+		Post("/api/dialog.open").
+		Reply(200).
+		JSON(map[string]interface{}{"ok": true})
+	res = postInteractivePayload(app, button)
+	for _, test := range []Test{
+		{200, res.Code},
+		{"", res.Body.String()},
+		{true, gock.IsDone()},
+	} {
+		test.Compare(t)
+	}
+
+	res = postInteractivePayload(app, map[string]interface{}{
+		"type":        "dialog_submission",
+		"callback_id": callbackIDHolidayWorkDialog,
+		"token":       app.SlackVerificationToken,
+		"user":        map[string]interface{}{"id": "FOO"},
+		"submission":  map[string]string{holidayWorkReasonField: " "},
+	})
+	Test{200, res.Code}.Compare(t)
+	Test{`{"errors":[{"name":"reason","error":"休日出勤の理由を入力してください"}]}`, strings.TrimSpace(res.Body.String())}.Compare(t)
+}
@@ -0,0 +1,320 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/nlopes/slack"
+)
+
+const (
+	scheduleModeAsk   = "ask"
+	scheduleModeAuto  = "auto"
+	maxPunchSchedules = 10
+	// scheduleInterval is how often the schedules of all users are evaluated
+	scheduleInterval = time.Minute
+	// scheduleGracePeriod still runs schedules missed while the server was down for a short time
+	scheduleGracePeriod = 30 * time.Minute
+)
+
+var errInvalidPunchSchedule = errors.New("punch schedule is invalid")
+
+var scheduleWeekdays = []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+
+var scheduleWeekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+var scheduleWeekdayTexts = []string{"日", "月", "火", "水", "木", "金", "土"}
+
+// punchSchedule rests from From to To, which are minutes from midnight, on the weekdays
+type punchSchedule struct {
+	From     int            `json:"from"`
+	To       int            `json:"to"`
+	Weekdays []time.Weekday `json:"weekdays"`
+	Mode     string         `json:"mode,omitempty"`
+	// LastRest and LastUnrest are the dates when the schedule last ran, to run once a day
+	LastRest   string `json:"last_rest,omitempty"`
+	LastUnrest string `json:"last_unrest,omitempty"`
+}
+
+type punchSchedules struct {
+	TeamID  string          `json:"team_id,omitempty"`
+	Entries []punchSchedule `json:"entries"`
+}
+
+// parseScheduleWeekdays parses weekdays, everyday or the comma separated days like mon,wed,fri
+func parseScheduleWeekdays(value string) ([]time.Weekday, error) {
+	switch value {
+	case "weekdays":
+		return scheduleWeekdays, nil
+	case "everyday":
+		return []time.Weekday{time.Sunday, time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday}, nil
+	}
+	weekdays := []time.Weekday{}
+	for _, name := range strings.Split(strings.ToLower(value), ",") {
+		day, ok := scheduleWeekdayNames[name]
+		if !ok {
+			return nil, errInvalidPunchSchedule
+		}
+		weekdays = append(weekdays, day)
+	}
+	return weekdays, nil
+}
+
+// parsePunchSchedule parses the arguments like `12:00-13:00 weekdays auto`
+func parsePunchSchedule(args []string) (punchSchedule, error) {
+	schedule := punchSchedule{Weekdays: scheduleWeekdays, Mode: scheduleModeAsk}
+	if len(args) > 0 && args[0] == actionTypeRest {
+		args = args[1:]
+	}
+	if len(args) < 1 || len(args) > 3 {
+		return schedule, errInvalidPunchSchedule
+	}
+	window := strings.SplitN(args[0], "-", 2)
+	if len(window) != 2 {
+		return schedule, errInvalidPunchSchedule
+	}
+	var err error
+	if schedule.From, err = parseClock(window[0]); err != nil || schedule.From < 0 {
+		return schedule, errInvalidPunchSchedule
+	}
+	if schedule.To, err = parseClock(window[1]); err != nil || schedule.To <= schedule.From {
+		return schedule, errInvalidPunchSchedule
+	}
+	for _, arg := range args[1:] {
+		if arg == scheduleModeAsk || arg == scheduleModeAuto {
+			schedule.Mode = arg
+			continue
+		}
+		if schedule.Weekdays, err = parseScheduleWeekdays(arg); err != nil {
+			return schedule, err
+		}
+	}
+	return schedule, nil
+}
+
+func (schedule punchSchedule) String() string {
+	days := []string{}
+	for _, day := range schedule.Weekdays {
+		days = append(days, scheduleWeekdayTexts[day])
+	}
+	text := "休憩 " + formatClock(schedule.From) + "-" + formatClock(schedule.To) + " (" + strings.Join(days, "・") + ")"
+	if schedule.Mode == scheduleModeAuto {
+		return text + " 自動で打刻する"
+	}
+	return text + " Slack で確認する"
+}
+
+// IsScheduledOn reports whether the schedule runs on the weekday
+func (schedule punchSchedule) IsScheduledOn(day time.Weekday) bool {
+	for _, d := range schedule.Weekdays {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// dueAction returns the action to run at now, and marks it as done for today.
+// The caller saves the schedule once the action has been handled.
+func (schedule *punchSchedule) dueAction(now time.Time) (string, time.Time, bool) {
+	if !schedule.IsScheduledOn(now.Weekday()) {
+		return "", now, false
+	}
+	date := now.Format("2006-01-02")
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	from := midnight.Add(time.Duration(schedule.From) * time.Minute)
+	to := midnight.Add(time.Duration(schedule.To) * time.Minute)
+	switch {
+	case !now.Before(to) && now.Sub(to) < scheduleGracePeriod && schedule.LastUnrest != date:
+		schedule.LastUnrest = date
+		return actionTypeUnrest, to, true
+	case !now.Before(from) && now.Before(to) && now.Sub(from) < scheduleGracePeriod && schedule.LastRest != date:
+		schedule.LastRest = date
+		return actionTypeRest, from, true
+	}
+	return "", now, false
+}
+
+func (ctx *Context) getPunchSchedules() *punchSchedules {
+	schedules := &punchSchedules{}
+	if data := ctx.getVariableInHash(ctx.ScheduleStoreKey, ctx.UserID); data != "" {
+		json.Unmarshal([]byte(data), schedules)
+	}
+	return schedules
+}
+
+func (ctx *Context) setPunchSchedules(schedules *punchSchedules) error {
+	if len(schedules.Entries) == 0 {
+		_, err := ctx.RedisConn.Do("HDEL", ctx.ScheduleStoreKey, ctx.UserID)
+		return err
+	}
+	data, err := json.Marshal(schedules)
+	if err != nil {
+		return err
+	}
+	return ctx.setVariableInHash(ctx.ScheduleStoreKey, data)
+}
+
+// runPunchSchedules applies or asks the actions of the schedules due now. Schedules are
+// skipped on national holidays, days off of the team, holidays in TeamSpirit and while the user is not in the state to take the action,
+// e.g. resting is never started before attending.
+func (ctx *Context) runPunchSchedules(c context.Context) {
+	schedules := ctx.getPunchSchedules()
+	now := ctx.getCurrentTimeForUser()
+	type dueSchedule struct {
+		index    int
+		schedule punchSchedule
+		action   string
+		at       time.Time
+	}
+	due := []dueSchedule{}
+	for i := range schedules.Entries {
+		schedule := schedules.Entries[i]
+		if action, at, ok := schedule.dueAction(now); ok {
+			due = append(due, dueSchedule{i, schedule, action, at})
+		}
+	}
+	if len(due) == 0 {
+		return
+	}
+	// schedules are marked as done only once they are handled, to be retried when TeamSpirit is unreachable
+	markDone := func(due ...dueSchedule) {
+		for _, d := range due {
+			schedules.Entries[d.index] = d.schedule
+		}
+		ctx.setPunchSchedules(schedules)
+	}
+	if _, ok := ctx.getDayOff(schedules.TeamID, now); ok {
+		markDone(due...)
+		return
+	}
+	client := ctx.createTimeTableClient(c)
+	if client.HTTPClient == nil {
+		return
+	}
+	timeTable, err := ctx.getCurrentTimeTable(c, client, now)
+	if err != nil {
+		return
+	}
+	if timeTable.IsHoliday != nil && *timeTable.IsHoliday {
+		markDone(due...)
+		return
+	}
+	state := timeTable.State()
+	for _, d := range due {
+		if !state.Can(d.action) {
+			markDone(d)
+			continue
+		}
+		button := attendanceButtons[d.action]
+		if d.schedule.Mode != scheduleModeAuto {
+			ctx.postDirectMessage(formatTime(d.at)+" になりました。"+strings.TrimSuffix(button.Text, "する")+"しますか？", []slack.Attachment{{
+				CallbackID: callbackIDAttendanceButton,
+				Actions:    []slack.AttachmentAction{button},
+			}})
+			markDone(d)
+			continue
+		}
+		result, err := ctx.punch(c, client, queuedPunch{TeamID: schedules.TeamID, Action: d.action, Time: d.at})
+		if result.Queued != nil {
+			markDone(d)
+			ctx.postDirectMessage("TeamSpirit に接続できないため打刻を保留しました: "+result.Queued.Describe(now.Location()), nil)
+			break
+		}
+		if err != nil {
+			markDone(d)
+			ctx.postDirectMessage(getTimeTableErrorText("スケジュールによる打刻に失敗しました :warning:", err), nil)
+			break
+		}
+		markDone(d)
+		text := attendanceActionTexts[d.action] + " (" + formatTime(d.at) + ")"
+		ctx.postDirectMessage("スケジュールに従って"+text, nil)
+		ctx.notifyPunch(text)
+		state, _ = state.Next(d.action)
+	}
+}
+
+func (ctx *Context) getScheduleSlackMessage(teamID string, args []string) *slack.Msg {
+	schedules := ctx.getPunchSchedules()
+	schedules.TeamID = teamID
+	if len(args) > 0 && args[0] == "add" {
+		schedule, err := parsePunchSchedule(args[1:])
+		if err != nil {
+			return &slack.Msg{Text: "`/ts schedule add HH:MM-HH:MM [weekdays|everyday|mon,wed,fri] [ask|auto]` の形式で指定してください :warning:"}
+		}
+		if len(schedules.Entries) >= maxPunchSchedules {
+			return &slack.Msg{Text: "スケジュールは " + strconv.Itoa(maxPunchSchedules) + " 個まで登録できます :warning:"}
+		}
+		schedules.Entries = append(schedules.Entries, schedule)
+		ctx.setPunchSchedules(schedules)
+		return &slack.Msg{Text: "スケジュールを追加しました: " + schedule.String()}
+	}
+	if len(args) > 1 && args[0] == "remove" {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 || n > len(schedules.Entries) {
+			return &slack.Msg{Text: "スケジュール " + args[1] + " が見つかりません :warning:"}
+		}
+		schedule := schedules.Entries[n-1]
+		schedules.Entries = append(schedules.Entries[:n-1], schedules.Entries[n:]...)
+		ctx.setPunchSchedules(schedules)
+		return &slack.Msg{Text: "スケジュールを削除しました: " + schedule.String()}
+	}
+	lines := []string{"スケジュールはありません"}
+	if len(schedules.Entries) > 0 {
+		lines = []string{"スケジュール (休日と、出勤していない日は実行しません):"}
+	}
+	for i, schedule := range schedules.Entries {
+		lines = append(lines, strconv.Itoa(i+1)+". "+schedule.String())
+	}
+	lines = append(lines, "`/ts schedule add HH:MM-HH:MM [weekdays|everyday|mon,wed,fri] [ask|auto]` で休憩を登録、`/ts schedule remove 番号` で削除できます")
+	return &slack.Msg{Text: strings.Join(lines, "\n")}
+}
+
+func (ctx *Context) getScheduleLockKey() string {
+	return ctx.ScheduleStoreKey + ":lock:" + ctx.UserID
+}
+
+func (app *App) runPunchSchedulesForUsers() {
+	conn, err := app.getWorkerConn()
+	if err != nil {
+		log.Println("Failed to run the punch schedules: " + err.Error())
+		return
+	}
+	defer conn.Close()
+	userIDs, err := redis.Strings(conn.Do("HKEYS", app.ScheduleStoreKey))
+	if err != nil {
+		log.Println("Failed to run the punch schedules: " + err.Error())
+		return
+	}
+	for _, userID := range userIDs {
+		ctx := app.createWorkerContext(conn, userID)
+		unlock, ok := ctx.tryLock(ctx.getScheduleLockKey(), backgroundTaskTimeout)
+		if !ok {
+			continue
+		}
+		c, cancel := context.WithTimeout(context.Background(), backgroundTaskTimeout)
+		ctx.runPunchSchedules(c)
+		cancel()
+		unlock()
+	}
+}
+
+func (app *App) runScheduleWorker() {
+	for range time.Tick(scheduleInterval) {
+		app.runPunchSchedulesForUsers()
+	}
+}
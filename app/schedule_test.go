@@ -0,0 +1,159 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+	null "gopkg.in/guregu/null.v3"
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func TestParsePunchSchedule(t *testing.T) {
+	schedule, err := parsePunchSchedule([]string{"rest", "12:00-13:00"})
+	Test{nil, err}.Compare(t)
+	Test{punchSchedule{From: 720, To: 780, Weekdays: scheduleWeekdays, Mode: scheduleModeAsk}, schedule}.DeepEqual(t)
+	Test{"休憩 12:00-13:00 (月・火・水・木・金) Slack で確認する", schedule.String()}.Compare(t)
+	schedule, _ = parsePunchSchedule([]string{"11:30-12:15", "auto", "Mon,wed,fri"})
+	Test{"休憩 11:30-12:15 (月・水・金) 自動で打刻する", schedule.String()}.Compare(t)
+	schedule, _ = parsePunchSchedule([]string{"15:00-15:10", "everyday"})
+	Test{"休憩 15:00-15:10 (日・月・火・水・木・金・土) Slack で確認する", schedule.String()}.Compare(t)
+	for _, args := range [][]string{
+		{},
+		{"rest"},
+		{"12:00"},
+		{"12:00-"},
+		{"13:00-12:00"},
+		{"12:00-13:00", "holidays"},
+		{"12:00-13:00", "weekdays", "auto", "foo"},
+	} {
+		_, err := parsePunchSchedule(args)
+		Test{errInvalidPunchSchedule, err}.Compare(t)
+	}
+}
+
+func TestPunchScheduleDueAction(t *testing.T) {
+	loc := time.FixedZone("Asia/Tokyo", 9*60*60)
+	schedule := &punchSchedule{From: 720, To: 780, Weekdays: scheduleWeekdays}
+	for _, test := range []struct {
+		now      time.Time
+		action   string
+		at       string
+		expected bool
+	}{
+		{time.Date(2018, time.September, 3, 11, 59, 0, 0, loc), "", "", false},
+		{time.Date(2018, time.September, 3, 12, 0, 0, 0, loc), actionTypeRest, "12:00", true},
+		{time.Date(2018, time.September, 3, 12, 1, 0, 0, loc), "", "", false},
+		{time.Date(2018, time.September, 3, 13, 5, 0, 0, loc), actionTypeUnrest, "13:00", true},
+		{time.Date(2018, time.September, 3, 13, 6, 0, 0, loc), "", "", false},
+		{time.Date(2018, time.September, 4, 12, 40, 0, 0, loc), "", "", false},
+		{time.Date(2018, time.September, 4, 13, 30, 0, 0, loc), "", "", false},
+		{time.Date(2018, time.September, 5, 12, 29, 0, 0, loc), actionTypeRest, "12:00", true},
+		{time.Date(2018, time.September, 8, 12, 0, 0, 0, loc), "", "", false},
+	} {
+		action, at, ok := schedule.dueAction(test.now)
+		Test{test.expected, ok}.Compare(t)
+		Test{test.action, action}.Compare(t)
+		if ok {
+			Test{test.at, at.Format("15:04")}.Compare(t)
+		}
+	}
+	Test{"2018-09-05", schedule.LastRest}.Compare(t)
+	Test{"2018-09-03", schedule.LastUnrest}.Compare(t)
+}
+
+func TestRunPunchSchedules(t *testing.T) {
+	defer gock.Off()
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := app.createContext(nil)
+	ctx.UserID = "FOO"
+	ctx.location = time.FixedZone("Asia/Tokyo", 9*60*60)
+	ctx.now = func() time.Time { return time.Date(2018, time.September, 3, 12, 0, 30, 0, ctx.location) }
+	ctx.setSalesforceAccessToken(&oauth2.Token{AccessToken: "foo", RefreshToken: "bar", TokenType: "Bearer"})
+	ctx.getScheduleSlackMessage("T12345678", []string{"add", "12:00-13:00", "auto"})
+
+	working := []timeTableItem{{null.IntFrom(9 * 60), null.IntFromPtr(nil), timeTableItemTypeAttendance}}
+	setupTimeTableGocks(nil, &[]bool{true}[0])
+	ctx.runPunchSchedules(context.Background())
+	Test{true, gock.IsDone()}.Compare(t)
+	Test{"2018-09-03", ctx.getPunchSchedules().Entries[0].LastRest}.Compare(t)
+
+	ctx = app.createContext(nil)
+	ctx.UserID = "FOO"
+	ctx.location = time.FixedZone("Asia/Tokyo", 9*60*60)
+	ctx.now = func() time.Time { return time.Date(2018, time.September, 4, 12, 0, 30, 0, ctx.location) }
+	setupTimeTableGocks(nil, &[]bool{false}[0])
+	ctx.runPunchSchedules(context.Background())
+	Test{true, gock.IsDone()}.Compare(t)
+
+	ctx = app.createContext(nil)
+	ctx.UserID = "FOO"
+	ctx.location = time.FixedZone("Asia/Tokyo", 9*60*60)
+	ctx.now = func() time.Time { return time.Date(2018, time.September, 5, 12, 0, 30, 0, ctx.location) }
+	setupTimeTableGocks(working, &[]bool{false}[0])
+	setupTimeTableGocks(working, &[]bool{false}[0])
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Post("/services/apexrest/Dakoku").
+		Reply(200).
+		BodyString(`"OK"`)
+	ctx.runPunchSchedules(context.Background())
+	Test{true, gock.IsDone()}.Compare(t)
+
+	ctx.runPunchSchedules(context.Background())
+	Test{true, gock.IsDone()}.Compare(t)
+}
+
+func TestGetScheduleSlackMessage(t *testing.T) {
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := app.createContext(nil)
+	ctx.UserID = "FOO"
+	help := "`/ts schedule add HH:MM-HH:MM [weekdays|everyday|mon,wed,fri] [ask|auto]` で休憩を登録、`/ts schedule remove 番号` で削除できます"
+	for _, test := range []Test{
+		{"スケジュールはありません\n" + help, ctx.getScheduleSlackMessage("T12345678", nil).Text},
+		{"スケジュールを追加しました: 休憩 12:00-13:00 (月・火・水・木・金) 自動で打刻する", ctx.getScheduleSlackMessage("T12345678", []string{"add", "rest", "12:00-13:00", "auto"}).Text},
+		{"スケジュールを追加しました: 休憩 15:00-15:15 (水) Slack で確認する", ctx.getScheduleSlackMessage("T12345678", []string{"add", "15:00-15:15", "wed"}).Text},
+		{"`/ts schedule add HH:MM-HH:MM [weekdays|everyday|mon,wed,fri] [ask|auto]` の形式で指定してください :warning:", ctx.getScheduleSlackMessage("T12345678", []string{"add", "lunch"}).Text},
+		{"スケジュール (休日と、出勤していない日は実行しません):\n1. 休憩 12:00-13:00 (月・火・水・木・金) 自動で打刻する\n2. 休憩 15:00-15:15 (水) Slack で確認する\n" + help, ctx.getScheduleSlackMessage("T12345678", nil).Text},
+		{"T12345678", ctx.getPunchSchedules().TeamID},
+		{"スケジュール 3 が見つかりません :warning:", ctx.getScheduleSlackMessage("T12345678", []string{"remove", "3"}).Text},
+		{"スケジュールを削除しました: 休憩 12:00-13:00 (月・火・水・木・金) 自動で打刻する", ctx.getScheduleSlackMessage("T12345678", []string{"remove", "1"}).Text},
+		{"スケジュールを削除しました: 休憩 15:00-15:15 (水) Slack で確認する", ctx.getScheduleSlackMessage("T12345678", []string{"remove", "1"}).Text},
+		{"", ctx.getVariableInHash(ctx.ScheduleStoreKey, "FOO")},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestRunPunchSchedulesRetriesUnreachable(t *testing.T) {
+	defer gock.Off()
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := app.createContext(nil)
+	ctx.UserID = "FOO"
+	ctx.location = time.FixedZone("Asia/Tokyo", 9*60*60)
+	ctx.now = func() time.Time { return time.Date(2018, time.September, 3, 12, 0, 30, 0, ctx.location) }
+	ctx.setSalesforceAccessToken(&oauth2.Token{AccessToken: "foo", RefreshToken: "bar", TokenType: "Bearer"})
+	ctx.getScheduleSlackMessage("T12345678", []string{"add", "12:00-13:00", "auto"})
+
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Get("/services/apexrest/Dakoku").
+		Reply(503)
+	ctx.runPunchSchedules(context.Background())
+	Test{true, gock.IsDone()}.Compare(t)
+	Test{"", ctx.getPunchSchedules().Entries[0].LastRest}.Compare(t)
+
+	ctx.now = func() time.Time { return time.Date(2018, time.September, 3, 12, 1, 30, 0, ctx.location) }
+	working := []timeTableItem{{null.IntFrom(9 * 60), null.IntFromPtr(nil), timeTableItemTypeAttendance}}
+	setupTimeTableGocks(working, &[]bool{false}[0])
+	setupTimeTableGocks(working, &[]bool{false}[0])
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Post("/services/apexrest/Dakoku").
+		Reply(200).
+		BodyString(`"OK"`)
+	ctx.runPunchSchedules(context.Background())
+	Test{true, gock.IsDone()}.Compare(t)
+	Test{"2018-09-03", ctx.getPunchSchedules().Entries[0].LastRest}.Compare(t)
+}
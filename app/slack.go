@@ -1,10 +1,11 @@
 package app
 
 import (
+	"context"
+	"strings"
 	"time"
 
 	"github.com/nlopes/slack"
-	
 )
 
 const (
@@ -18,65 +19,156 @@ const (
 	callbackIDAttendanceButton = "attendance_button"
 )
 
-func (ctx *Context) getActionCallback(data *slack.AttachmentActionCallback) (*slack.Msg, string, error) {
+var attendanceActionTexts = map[string]string{
+	actionTypeAttend: "出勤しました :office:",
+	actionTypeRest:   "休憩を開始しました :coffee:",
+	actionTypeUnrest: "休憩を終了しました :computer:",
+	actionTypeLeave:  "退勤しました :house:",
+}
+
+var attendanceButtons = map[string]slack.AttachmentAction{
+	actionTypeAttend: {
+		Name:  actionTypeAttend,
+		Value: actionTypeAttend,
+		Text:  "出勤する",
+		Style: "primary",
+		Type:  "button",
+	},
+	actionTypeRest: {
+		Name:  actionTypeRest,
+		Value: actionTypeRest,
+		Text:  "休憩を開始する",
+		Style: "default",
+		Type:  "button",
+	},
+	actionTypeUnrest: {
+		Name:  actionTypeUnrest,
+		Value: actionTypeUnrest,
+		Text:  "休憩を終了する",
+		Style: "default",
+		Type:  "button",
+	},
+	actionTypeLeave: {
+		Name:  actionTypeLeave,
+		Value: actionTypeLeave,
+		Text:  "退勤する",
+		Style: "danger",
+		Type:  "button",
+		Confirm: &slack.ConfirmationField{
+			Text:        "退勤しますか？",
+			OkText:      "はい",
+			DismissText: "いいえ",
+		},
+	},
+}
+
+func (ctx *Context) getActionCallback(c context.Context, data *slack.AttachmentActionCallback) (*slack.Msg, string, error) {
 	ctx.UserID = data.User.ID
-	client := ctx.createTimeTableClient()
-	timeTable, err := client.GetTimeTable()
+	client := ctx.createTimeTableClient(c)
+	now := ctx.getActionTime(data)
+	action := data.Actions[0].Name
+	loginState := State{
+		TeamID:      data.Team.ID,
+		UserID:      ctx.UserID,
+		ResponseURL: data.ResponseURL,
+	}
+	result, err := ctx.punch(c, client, queuedPunch{
+		TeamID:      data.Team.ID,
+		Action:      action,
+		Time:        now,
+		ResponseURL: data.ResponseURL,
+	})
+	if err == errNotAuthenticated || isAuthError(err) {
+		msg, err := ctx.getLoginSlackMessage(loginState)
+		return msg, data.ResponseURL, err
+	}
+	if result.Queued != nil {
+		return ctx.getQueuedPunchSlackMessage(result.Queued, now), data.ResponseURL, nil
+	}
+	if refused, ok := err.(*punchRefusedError); ok {
+		return ctx.getRefusalSlackMessage(refused.State, action), data.ResponseURL, nil
+	}
+	if blocked, ok := err.(*complianceError); ok {
+		return &slack.Msg{
+			ResponseType:    "ephemeral",
+			ReplaceOriginal: false,
+			Text:            blocked.Text(),
+		}, data.ResponseURL, nil
+	}
+	if err != nil && result.TimeTable == nil {
+		return &slack.Msg{
+			ResponseType: "ephemeral",
+			Text:         getTimeTableErrorText("勤務表の取得に失敗しました :warning:", err),
+		}, data.ResponseURL, nil
+	}
 	if err != nil {
-		state := State{
-			TeamID:      data.Team.ID,
-			UserID:      ctx.UserID,
-			ResponseURL: data.ResponseURL,
-		}
-		err, msg := ctx.getLoginSlackMessage(state)
-		return err, data.ResponseURL, msg
-	}
-
-	text := ""
-	now := time.Now()
-	attendance := -1
-	switch data.Actions[0].Name {
-	case actionTypeLeave:
-		{
-			attendance = 0
-			text = "退勤しました :house:"
-		}
-	case actionTypeRest:
-		{
-			timeTable.Rest(now)
-			text = "休憩を開始しました :coffee:"
-		}
-	case actionTypeUnrest:
-		{
-			timeTable.Unrest(now)
-			text = "休憩を終了しました :computer:"
-		}
-	case actionTypeAttend:
-		{
-			attendance = 1
-			text = "出勤しました :office:"
-		}
+		return &slack.Msg{
+			ResponseType:    "ephemeral",
+			ReplaceOriginal: false,
+			Text:            getTimeTableErrorText("勤務表の更新に失敗しました :warning:", err),
+		}, data.ResponseURL, nil
 	}
 
-	params := &slack.Msg{
+	text := attendanceActionTexts[action] + " (" + formatTime(now) + ")" + getAddedRestText(result.Rest)
+	ctx.notifyPunch(text)
+	return &slack.Msg{
 		ResponseType:    "in_channel",
 		ReplaceOriginal: true,
-		Text:            text,
-	}
+		Text:            text + getComplianceWarningText(result.Warnings),
+	}, data.ResponseURL, nil
+}
 
-	var ok bool
-	if attendance != -1 {
-		ok, err = client.SetAttendance(attendance == 1)
-	} else {
-		ok, err = client.UpdateTimeTable(timeTable)
+// getTimeTableErrorText appends the reason of the error to the text
+func getTimeTableErrorText(text string, err error) string {
+	reason := ""
+	switch err.(type) {
+	case *timeTableValidationError:
+		reason = err.Error()
+	case *complianceError:
+		reason = err.(*complianceError).Text()
+	case *timeTableNotFoundError:
+		reason = "TeamSpirit に打刻用の Apex クラスが見つかりません。管理者に連絡してください :construction:"
+	case *timeTableBusinessError:
+		reason = "TeamSpirit が打刻を受け付けませんでした"
+	case *timeTableRateLimitError:
+		reason = "TeamSpirit の API 呼び出し回数の上限に達しました。しばらくしてから再度お試しください :hourglass:"
+	case *timeTableNetworkError:
+		reason = "TeamSpirit に接続できませんでした"
+	}
+	if err == errTimeTableConflict {
+		reason = "勤務表が他で更新されたため反映できませんでした。再度お試しください"
 	}
-	if !ok || err != nil {
-		params.ResponseType = "ephemeral"
-		params.ReplaceOriginal = false
-		params.Text = "勤務表の更新に失敗しました :warning:"
+	if err == errHolidayWorkNotApplied {
+		reason = "TeamSpirit で休日出勤の申請を行ってから、再度打刻してください :memo:"
+	}
+	if err == errTimeTableDateUnsupported {
+		reason = "TeamSpirit の打刻用の Apex クラスが古いため、前日の勤務を更新できません。管理者に連絡してください :construction:"
+	}
+	if reason == "" {
+		return text
+	}
+	return text + "\n" + reason
+}
+
+func (ctx *Context) getQueuedPunchSlackMessage(punch *queuedPunch, now time.Time) *slack.Msg {
+	return &slack.Msg{
+		ResponseType: "ephemeral",
+		Text:         "TeamSpirit に接続できないため打刻を保留しました :inbox_tray: " + punch.Describe(now.Location()) + "\n復旧後に自動で反映します。`/ts queue` で確認・取り消しができます",
 	}
+}
 
-	return params, data.ResponseURL, nil
+// getActionTime returns when the user clicked the button, rather than when the callback is processed
+func (ctx *Context) getActionTime(data *slack.AttachmentActionCallback) time.Time {
+	loc := ctx.getLocationForUser()
+	if t, ok := parseSlackTimestamp(data.ActionTs); ok {
+		return t.In(loc)
+	}
+	if ctx.Request != nil {
+		if t, ok := parseSlackTimestamp(ctx.Request.Header.Get("X-Slack-Request-Timestamp")); ok {
+			return t.In(loc)
+		}
+	}
+	return ctx.now().In(loc)
 }
 
 func (ctx *Context) getLoginSlackMessage(state State) (*slack.Msg, error) {
@@ -156,100 +248,96 @@ func (ctx *Context) getChannelSelectSlackMessage() (*slack.Msg, error) {
 	}, nil
 }
 
-func (ctx *Context) getSlackMessage(command slack.SlashCommand) (*slack.Msg, error) {
+func (ctx *Context) getSlackMessage(c context.Context, command slack.SlashCommand) (*slack.Msg, error) {
 	text := command.Text
 	state := State{
 		TeamID:      command.TeamID,
 		UserID:      command.UserID,
 		ResponseURL: command.ResponseURL,
 	}
-	client := ctx.createTimeTableClient()
+	args := strings.Fields(text)
+	if len(args) > 0 {
+		switch args[0] {
+		case "tz":
+			return ctx.getTimeZoneSlackMessage(args[1:])
+		case "schedule":
+			return ctx.getScheduleSlackMessage(command.TeamID, args[1:]), nil
+		case "presence":
+			return ctx.getPresenceSlackMessage(command.TeamID, args[1:]), nil
+		case "calendar":
+			return ctx.getCalendarSlackMessage(c, state, args[1:])
+		case "compliance":
+			return ctx.getComplianceSlackMessage(state, args[1:])
+		case "autorest":
+			return ctx.getRestPolicySlackMessage(state, args[1:])
+		case "webhook":
+			return ctx.getWebhookSlackMessage(state, args[1:])
+		case "token":
+			return ctx.getAPITokenSlackMessage(command.TeamID, args[1:]), nil
+		case "queue":
+			return ctx.getPunchQueueSlackMessage(), nil
+		case "holiday":
+			if len(args) > 1 && args[1] == "manager" {
+				return ctx.getHolidayWorkManagerSlackMessage(args[2:]), nil
+			}
+		}
+	}
+	if text == "refresh" {
+		ctx.clearTimeTableCache()
+	}
+	client := ctx.createTimeTableClient(c)
 	if client.HTTPClient == nil || text == "login" {
 		return ctx.getLoginSlackMessage(state)
 	}
-	timeTable, err := client.GetTimeTable()
-	if err != nil {
+	timeTable, err := ctx.getCurrentTimeTable(c, client, ctx.getCurrentTimeForUser())
+	if err != nil && isAuthError(err) {
 		return ctx.getLoginSlackMessage(state)
 	}
+	if err != nil {
+		return &slack.Msg{
+			Text: getTimeTableErrorText("勤務表の取得に失敗しました :warning:", err),
+		}, nil
+	}
 	if text == "channel" {
 		if ctx.getSlackAccessTokenForUser() == "" {
 			return ctx.getAuthenticateSlackMessage(state)
 		}
 		return ctx.getChannelSelectSlackMessage()
 	}
-	if timeTable.IsLeaving() {
-		return &slack.Msg{
-			Text: "既に退勤済です。打刻修正は <https://" + ctx.TeamSpiritHost + "|TeamSpirit> で行なってください。",
-		}, nil
-	}
-	if timeTable.IsHoliday != nil && *timeTable.IsHoliday == true {
-		return &slack.Msg{
-			Text: "本日は休日です :sunny:",
-		}, nil
+	if len(args) > 0 && args[0] == "holiday" {
+		return ctx.getHolidayWorkSlackMessage(command.TeamID, timeTable, strings.TrimSpace(strings.TrimPrefix(text, "holiday"))), nil
 	}
-	if timeTable.IsResting() {
+	switch state := timeTable.State(); state {
+	case attendanceStateLeft:
 		return &slack.Msg{
-			Attachments: []slack.Attachment{
-				slack.Attachment{
-					CallbackID: callbackIDAttendanceButton,
-					Actions: []slack.AttachmentAction{
-						slack.AttachmentAction{
-							Name:  actionTypeUnrest,
-							Value: actionTypeUnrest,
-							Text:  "休憩を終了する",
-							Style: "default",
-							Type:  "button",
-						},
-					},
-				},
-			},
-		}, nil
-	}
-	if timeTable.IsAttending() {
-		return &slack.Msg{
-			Attachments: []slack.Attachment{
-				slack.Attachment{
-					CallbackID: callbackIDAttendanceButton,
-					Actions: []slack.AttachmentAction{
-						slack.AttachmentAction{
-							Name:  actionTypeRest,
-							Value: actionTypeRest,
-							Text:  "休憩を開始する",
-							Style: "default",
-							Type:  "button",
-						},
-						slack.AttachmentAction{
-							Name:  actionTypeLeave,
-							Value: actionTypeLeave,
-							Text:  "退勤する",
-							Style: "danger",
-							Type:  "button",
-							Confirm: &slack.ConfirmationField{
-								Text:        "退勤しますか？",
-								OkText:      "はい",
-								DismissText: "いいえ",
-							},
-						},
-					},
-				},
-			},
+			Text: "既に退勤済です。打刻修正は <https://" + ctx.TeamSpiritHost + "|TeamSpirit> で行なってください。",
 		}, nil
+	case attendanceStateHoliday:
+		return ctx.getHolidaySlackMessage(), nil
+	default:
+		return ctx.getAttendanceSlackMessage(ctx.getAttendanceButtons(command.TeamID, timeTable, ctx.getCurrentTimeForUser())), nil
 	}
+}
+
+func (ctx *Context) getAttendanceSlackMessage(actions []slack.AttachmentAction) *slack.Msg {
 	return &slack.Msg{
 		Attachments: []slack.Attachment{
 			slack.Attachment{
 				CallbackID: callbackIDAttendanceButton,
-				Actions: []slack.AttachmentAction{
-					slack.AttachmentAction{
-						Name:  actionTypeAttend,
-						Value: actionTypeAttend,
-						Text:  "出勤する",
-						Style: "primary",
-						Type:  "button",
-					},
-				},
+				Actions:    actions,
 			},
 		},
-	}, nil
+	}
+}
 
+func (ctx *Context) getRefusalSlackMessage(state attendanceState, action string) *slack.Msg {
+	text := "現在は" + state.String() + "のため、その操作はできません :no_entry_sign:"
+	if button, ok := attendanceButtons[action]; ok {
+		text = "現在は" + state.String() + "のため「" + button.Text + "」はできません :no_entry_sign:"
+	}
+	return &slack.Msg{
+		ResponseType:    "ephemeral",
+		ReplaceOriginal: false,
+		Text:            text,
+	}
 }
@@ -2,6 +2,7 @@ package app
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/url"
@@ -40,6 +41,13 @@ func createActionCallbackRequest(callbackID, actionType, token string) *http.Req
 }
 
 func setupActionCallbackGocks(actionType string, responseText string) {
+	items := []map[string]interface{}{{"from": 1, "to": nil, "type": 1}}
+	switch actionType {
+	case actionTypeAttend:
+		items = []map[string]interface{}{}
+	case actionTypeUnrest:
+		items = append(items, map[string]interface{}{"from": 1, "to": nil, "type": 21})
+	}
 	if actionType == actionTypeAttend || actionType == actionTypeLeave {
 		gock.New("https://teamspirit-1234.cloudforce.test").
 			Put("/services/apexrest/Dakoku").
@@ -56,7 +64,7 @@ func setupActionCallbackGocks(actionType string, responseText string) {
 		Get("/services/apexrest/Dakoku").
 		Reply(200).
 		JSON(map[string]interface{}{
-			"timeTable": []map[string]interface{}{{"from": 1, "to": 2, "type": 1}},
+			"timeTable": items,
 			"isHoliday": false,
 		})
 }
@@ -68,6 +76,8 @@ func testGetActionCallbackWithActionType(t *testing.T, actionType string, succes
 	req, _ := http.NewRequest(http.MethodPost, "https://example.com/hooks/interactive", strings.NewReader(""))
 	ctx := app.createContext(req)
 	ctx.UserID = "FOO"
+	ctx.now = getMockTime
+	ctx.location = getMockTime().Location()
 	ctx.setSalesforceAccessToken(&oauth2.Token{
 		AccessToken:  "foo",
 		RefreshToken: "bar",
@@ -79,9 +89,9 @@ func testGetActionCallbackWithActionType(t *testing.T, actionType string, succes
 		Reply(200).
 		JSON([]map[string]interface{}{{"message": "Session expired or invalid", "errorCode": "INVALID_SESSION_ID"}})
 
-	gock.InterceptClient(ctx.createTimeTableClient().HTTPClient)
+	gock.InterceptClient(ctx.createTimeTableClient(context.Background()).HTTPClient)
 
-	msg, responseURL, err := ctx.getActionCallback(&slack.AttachmentActionCallback{
+	msg, responseURL, err := ctx.getActionCallback(context.Background(), &slack.AttachmentActionCallback{
 		Actions:     []slack.AttachmentAction{{Name: actionType}},
 		Token:       app.SlackVerificationToken,
 		ResponseURL: "https://hooks.slack.test/coolhook",
@@ -101,7 +111,7 @@ func testGetActionCallbackWithActionType(t *testing.T, actionType string, succes
 	}
 
 	setupActionCallbackGocks(actionType, `"OK"`)
-	msg, responseURL, err = ctx.getActionCallback(&slack.AttachmentActionCallback{
+	msg, responseURL, err = ctx.getActionCallback(context.Background(), &slack.AttachmentActionCallback{
 		Actions:     []slack.AttachmentAction{{Name: actionType}},
 		Token:       app.SlackVerificationToken,
 		ResponseURL: "https://hooks.slack.test/coolhook",
@@ -113,7 +123,7 @@ func testGetActionCallbackWithActionType(t *testing.T, actionType string, succes
 	for _, test := range []Test{
 		{true, err == nil},
 		{"https://hooks.slack.test/coolhook", responseURL},
-		{successMessage, msg.Text},
+		{successMessage + " (11:12 Asia/Tokyo)", msg.Text},
 		{"in_channel", msg.ResponseType},
 		{true, msg.ReplaceOriginal},
 		{true, gock.IsDone()},
@@ -123,7 +133,7 @@ func testGetActionCallbackWithActionType(t *testing.T, actionType string, succes
 
 	setupActionCallbackGocks(actionType, "NG")
 
-	msg, responseURL, err = ctx.getActionCallback(&slack.AttachmentActionCallback{
+	msg, responseURL, err = ctx.getActionCallback(context.Background(), &slack.AttachmentActionCallback{
 		Actions:     []slack.AttachmentAction{{Name: actionType}},
 		Token:       app.SlackVerificationToken,
 		ResponseURL: "https://hooks.slack.test/coolhook",
@@ -135,7 +145,7 @@ func testGetActionCallbackWithActionType(t *testing.T, actionType string, succes
 	for _, test := range []Test{
 		{true, err == nil},
 		{"https://hooks.slack.test/coolhook", responseURL},
-		{"勤務表の更新に失敗しました :warning:", msg.Text},
+		{"勤務表の更新に失敗しました :warning:\nTeamSpirit が打刻を受け付けませんでした", msg.Text},
 		{"ephemeral", msg.ResponseType},
 		{false, msg.ReplaceOriginal},
 		{true, gock.IsDone()},
@@ -151,6 +161,167 @@ func TestGetActionCallback(t *testing.T) {
 	testGetActionCallbackWithActionType(t, actionTypeUnrest, "休憩を終了しました :computer:")
 }
 
+func TestGetActionCallbackWithInvalidTimeTable(t *testing.T) {
+	defer gock.Off()
+	app := createMockApp()
+	app.CleanRedis()
+	req, _ := http.NewRequest(http.MethodPost, "https://example.com/hooks/interactive", strings.NewReader(""))
+	ctx := app.createContext(req)
+	ctx.UserID = "FOO"
+	ctx.now = getMockTime
+	ctx.location = getMockTime().Location()
+	ctx.setSalesforceAccessToken(&oauth2.Token{
+		AccessToken:  "foo",
+		RefreshToken: "bar",
+		TokenType:    "Bearer",
+	})
+	gock.InterceptClient(ctx.createTimeTableClient(context.Background()).HTTPClient)
+	setupTimeTableGocks([]timeTableItem{
+		{null.IntFrom(12 * 60), null.IntFromPtr(nil), timeTableItemTypeAttendance},
+	}, &[]bool{false}[0])
+	msg, _, err := ctx.getActionCallback(context.Background(), &slack.AttachmentActionCallback{
+		Actions:     []slack.AttachmentAction{{Name: actionTypeRest}},
+		Token:       app.SlackVerificationToken,
+		ResponseURL: "https://hooks.slack.test/coolhook",
+		User: slack.User{
+			ID: "FOO",
+		},
+	})
+	for _, test := range []Test{
+		{true, err == nil},
+		{"勤務表の更新に失敗しました :warning:\n休憩時間が勤務時間外です", msg.Text},
+		{"ephemeral", msg.ResponseType},
+		{true, gock.IsDone()},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestGetActionTime(t *testing.T) {
+	app := createMockApp()
+	req, _ := http.NewRequest(http.MethodPost, "https://example.com/hooks/interactive", nil)
+	ctx := app.createContext(req)
+	ctx.now = getMockTime
+	ctx.location = getMockTime().Location()
+	Test{"2018-09-01 11:12:22", ctx.getActionTime(&slack.AttachmentActionCallback{}).Format("2006-01-02 15:04:05")}.Compare(t)
+	req.Header.Set("X-Slack-Request-Timestamp", "1535767200")
+	Test{"2018-09-01 11:00:00", ctx.getActionTime(&slack.AttachmentActionCallback{}).Format("2006-01-02 15:04:05")}.Compare(t)
+	Test{"2018-09-01 10:58:30", ctx.getActionTime(&slack.AttachmentActionCallback{ActionTs: "1535767110.164398"}).Format("2006-01-02 15:04:05")}.Compare(t)
+}
+
+func TestGetActionCallbackRecordsActionTime(t *testing.T) {
+	defer gock.Off()
+	app := createMockApp()
+	app.CleanRedis()
+	req, _ := http.NewRequest(http.MethodPost, "https://example.com/hooks/interactive", strings.NewReader(""))
+	ctx := app.createContext(req)
+	ctx.UserID = "FOO"
+	ctx.now = getMockTime
+	ctx.location = getMockTime().Location()
+	ctx.setSalesforceAccessToken(&oauth2.Token{AccessToken: "foo", RefreshToken: "bar", TokenType: "Bearer"})
+	gock.InterceptClient(ctx.createTimeTableClient(context.Background()).HTTPClient)
+	setupTimeTableGocks([]timeTableItem{
+		{null.IntFrom(9 * 60), null.IntFromPtr(nil), timeTableItemTypeAttendance},
+	}, &[]bool{false}[0])
+	// The button was clicked at 10:58 although the callback is processed at 11:12
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Put("/services/apexrest/Dakoku").
+		JSON(map[string]interface{}{"attendance": false, "minute": 10*60 + 58}).
+		Reply(200).
+		BodyString(`"OK"`)
+	msg, _, err := ctx.getActionCallback(context.Background(), &slack.AttachmentActionCallback{
+		Actions:     []slack.AttachmentAction{{Name: actionTypeLeave}},
+		ActionTs:    "1535767110.164398",
+		Token:       app.SlackVerificationToken,
+		ResponseURL: "https://hooks.slack.test/coolhook",
+		User:        slack.User{ID: "FOO"},
+	})
+	for _, test := range []Test{
+		{true, err == nil},
+		{"退勤しました :house: (10:58 Asia/Tokyo)", msg.Text},
+		{true, gock.IsDone()},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestGetActionCallbackNotifiesOnlyPunches(t *testing.T) {
+	defer gock.Off()
+	defer gock.RestoreClient(slack.HTTPClient)
+	app := createMockApp()
+	app.CleanRedis()
+	req, _ := http.NewRequest(http.MethodPost, "https://example.com/hooks/interactive", strings.NewReader(""))
+	ctx := app.createContext(req)
+	ctx.UserID = "FOO"
+	ctx.now = getMockTime
+	ctx.location = getMockTime().Location()
+	ctx.setSalesforceAccessToken(&oauth2.Token{AccessToken: "foo", RefreshToken: "bar", TokenType: "Bearer"})
+	ctx.setSlackAccessToken("xoxp-foo")
+	ctx.setVariableInHash(ctx.NotifyChannelStoreKey, "C12345678")
+	client := &http.Client{Transport: &http.Transport{}}
+	gock.InterceptClient(client)
+	slack.SetHTTPClient(client)
+	gock.New("https://slack.com").
+		Post("/api/chat.postMessage").
+		MatchType("url").
+		BodyString("channel=C12345678").
+		Reply(200).
+		JSON(map[string]interface{}{"ok": true, "channel": "C12345678", "ts": "1535767920.000100"})
+	callback := &slack.AttachmentActionCallback{
+		Actions:     []slack.AttachmentAction{{Name: actionTypeUnrest}},
+		ResponseURL: "https://hooks.slack.test/coolhook",
+		User:        slack.User{ID: "FOO"},
+	}
+
+	setupTimeTableGocks([]timeTableItem{}, &[]bool{false}[0])
+	msg, _, _ := ctx.getActionCallback(context.Background(), callback)
+	Test{"ephemeral", msg.ResponseType}.Compare(t)
+	Test{false, gock.IsDone()}.Compare(t)
+
+	setupActionCallbackGocks(actionTypeAttend, `"OK"`)
+	callback.Actions[0].Name = actionTypeAttend
+	msg, _, _ = ctx.getActionCallback(context.Background(), callback)
+	Test{"in_channel", msg.ResponseType}.Compare(t)
+	Test{true, gock.IsDone()}.Compare(t)
+}
+
+func TestGetActionCallbackWithDisallowedAction(t *testing.T) {
+	defer gock.Off()
+	app := createMockApp()
+	app.CleanRedis()
+	req, _ := http.NewRequest(http.MethodPost, "https://example.com/hooks/interactive", strings.NewReader(""))
+	ctx := app.createContext(req)
+	ctx.UserID = "FOO"
+	ctx.setSalesforceAccessToken(&oauth2.Token{
+		AccessToken:  "foo",
+		RefreshToken: "bar",
+		TokenType:    "Bearer",
+	})
+	gock.InterceptClient(ctx.createTimeTableClient(context.Background()).HTTPClient)
+	setupTimeTableGocks([]timeTableItem{
+		{null.IntFrom(600), null.IntFromPtr(nil), timeTableItemTypeAttendance},
+		{null.IntFrom(720), null.IntFromPtr(nil), timeTableItemTypeRest},
+	}, &[]bool{false}[0])
+	msg, responseURL, err := ctx.getActionCallback(context.Background(), &slack.AttachmentActionCallback{
+		Actions:     []slack.AttachmentAction{{Name: actionTypeLeave}},
+		Token:       app.SlackVerificationToken,
+		ResponseURL: "https://hooks.slack.test/coolhook",
+		User: slack.User{
+			ID: "FOO",
+		},
+	})
+	for _, test := range []Test{
+		{true, err == nil},
+		{"https://hooks.slack.test/coolhook", responseURL},
+		{"現在は休憩中のため「退勤する」はできません :no_entry_sign:", msg.Text},
+		{"ephemeral", msg.ResponseType},
+		{false, msg.ReplaceOriginal},
+		{true, gock.IsDone()},
+	} {
+		test.Compare(t)
+	}
+}
+
 func setupTimeTableGocks(items []timeTableItem, isHoliday *bool) {
 	gock.New("https://teamspirit-1234.cloudforce.test").
 		Get("/services/apexrest/Dakoku").
@@ -167,7 +338,7 @@ func TestGetSlackMessage(t *testing.T) {
 	req, _ := http.NewRequest(http.MethodPost, "https://example.com/hooks/slash", bytes.NewBufferString(""))
 	ctx := app.createContext(req)
 	ctx.UserID = "BAZ"
-	msg, err := ctx.getSlackMessage(slack.SlashCommand{TeamID: "T12345678"})
+	msg, err := ctx.getSlackMessage(context.Background(), slack.SlashCommand{TeamID: "T12345678"})
 	for _, test := range []Test{
 		{true, err == nil},
 		{"TeamSpirit で認証を行って、再度 `/ts` コマンドを実行してください :bow:", msg.Attachments[0].Text},
@@ -180,12 +351,30 @@ func TestGetSlackMessage(t *testing.T) {
 		RefreshToken: "bar",
 		TokenType:    "Bearer",
 	})
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Get("/services/apexrest/Dakoku").
+		Reply(401).
+		JSON([]map[string]interface{}{{"message": "Session expired or invalid", "errorCode": "INVALID_SESSION_ID"}})
 	ctx.TimeTableClient = nil
-	msg, err = ctx.getSlackMessage(slack.SlashCommand{TeamID: "T12345678"})
+	msg, err = ctx.getSlackMessage(context.Background(), slack.SlashCommand{TeamID: "T12345678"})
 	for _, test := range []Test{
 		{true, err == nil},
 		{"TeamSpirit で認証を行って、再度 `/ts` コマンドを実行してください :bow:", msg.Attachments[0].Text},
 		{0, strings.Index(msg.Attachments[0].Actions[0].URL, "https://example.com/oauth/salesforce/authenticate/")},
+		{true, gock.IsDone()},
+	} {
+		test.Compare(t)
+	}
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Get("/services/apexrest/Dakoku").
+		Reply(404).
+		JSON([]map[string]interface{}{{"message": "Could not find a match for URL", "errorCode": "NOT_FOUND"}})
+	ctx.TimeTableClient = nil
+	msg, err = ctx.getSlackMessage(context.Background(), slack.SlashCommand{TeamID: "T12345678"})
+	for _, test := range []Test{
+		{true, err == nil},
+		{"勤務表の取得に失敗しました :warning:\nTeamSpirit に打刻用の Apex クラスが見つかりません。管理者に連絡してください :construction:", msg.Text},
+		{true, gock.IsDone()},
 	} {
 		test.Compare(t)
 	}
@@ -193,7 +382,7 @@ func TestGetSlackMessage(t *testing.T) {
 		{null.IntFrom(10 * 60), null.IntFrom(19 * 60), 1},
 	}, nil)
 	ctx.TimeTableClient = nil
-	msg, err = ctx.getSlackMessage(slack.SlashCommand{TeamID: "T12345678", Text: "channel"})
+	msg, err = ctx.getSlackMessage(context.Background(), slack.SlashCommand{TeamID: "T12345678", Text: "channel"})
 	for _, test := range []Test{
 		{true, err == nil},
 		{"Slack で認証を行って、再度 `/ts channel` コマンドを実行してください :bow:", msg.Attachments[0].Text},
@@ -206,7 +395,7 @@ func TestGetSlackMessage(t *testing.T) {
 	}, nil)
 	ctx.TimeTableClient = nil
 	ctx.setSlackAccessToken("foo")
-	msg, err = ctx.getSlackMessage(slack.SlashCommand{TeamID: "T12345678", Text: "channel"})
+	msg, err = ctx.getSlackMessage(context.Background(), slack.SlashCommand{TeamID: "T12345678", Text: "channel"})
 	for _, test := range []Test{
 		{true, err == nil},
 		{"打刻時に通知するチャネルを選択して下さい", msg.Attachments[0].Text},
@@ -217,7 +406,7 @@ func TestGetSlackMessage(t *testing.T) {
 		{null.IntFrom(10 * 60), null.IntFrom(19 * 60), 1},
 	}, nil)
 	ctx.TimeTableClient = nil
-	msg, err = ctx.getSlackMessage(slack.SlashCommand{TeamID: "T12345678"})
+	msg, err = ctx.getSlackMessage(context.Background(), slack.SlashCommand{TeamID: "T12345678"})
 	for _, test := range []Test{
 		{true, err == nil},
 		{"既に退勤済です。打刻修正は <https://teamspirit-1234.cloudforce.test|TeamSpirit> で行なってください。", msg.Text},
@@ -230,7 +419,7 @@ func TestGetSlackMessage(t *testing.T) {
 		{null.IntFrom(10 * 60), null.IntFromPtr(nil), 21},
 	}, &[]bool{false}[0])
 	ctx.TimeTableClient = nil
-	msg, err = ctx.getSlackMessage(slack.SlashCommand{TeamID: "T12345678"})
+	msg, err = ctx.getSlackMessage(context.Background(), slack.SlashCommand{TeamID: "T12345678"})
 	for _, test := range []Test{
 		{true, err == nil},
 		{"休憩を終了する", msg.Attachments[0].Actions[0].Text},
@@ -244,7 +433,7 @@ func TestGetSlackMessage(t *testing.T) {
 		{null.IntFrom(10 * 60), null.IntFromPtr(nil), 21},
 	}, &[]bool{false}[0])
 	ctx.TimeTableClient = nil
-	msg, err = ctx.getSlackMessage(slack.SlashCommand{TeamID: "T12345678"})
+	msg, err = ctx.getSlackMessage(context.Background(), slack.SlashCommand{TeamID: "T12345678"})
 	for _, test := range []Test{
 		{true, err == nil},
 		{"休憩を終了する", msg.Attachments[0].Actions[0].Text},
@@ -258,7 +447,7 @@ func TestGetSlackMessage(t *testing.T) {
 		{null.IntFrom(10 * 60), null.IntFrom(11 * 60), 21},
 	}, &[]bool{false}[0])
 	ctx.TimeTableClient = nil
-	msg, err = ctx.getSlackMessage(slack.SlashCommand{TeamID: "T12345678"})
+	msg, err = ctx.getSlackMessage(context.Background(), slack.SlashCommand{TeamID: "T12345678"})
 	for _, test := range []Test{
 		{true, err == nil},
 		{"休憩を開始する", msg.Attachments[0].Actions[0].Text},
@@ -274,7 +463,7 @@ func TestGetSlackMessage(t *testing.T) {
 		{null.IntFrom(10 * 60), null.IntFrom(11 * 60), 21},
 	}, &[]bool{false}[0])
 	ctx.TimeTableClient = nil
-	msg, err = ctx.getSlackMessage(slack.SlashCommand{TeamID: "T12345678"})
+	msg, err = ctx.getSlackMessage(context.Background(), slack.SlashCommand{TeamID: "T12345678"})
 	for _, test := range []Test{
 		{true, err == nil},
 		{"出勤する", msg.Attachments[0].Actions[0].Text},
@@ -285,10 +474,13 @@ func TestGetSlackMessage(t *testing.T) {
 	}
 	setupTimeTableGocks([]timeTableItem{}, &[]bool{true}[0])
 	ctx.TimeTableClient = nil
-	msg, err = ctx.getSlackMessage(slack.SlashCommand{TeamID: "T12345678"})
+	msg, err = ctx.getSlackMessage(context.Background(), slack.SlashCommand{TeamID: "T12345678"})
 	for _, test := range []Test{
 		{true, err == nil},
 		{"本日は休日です :sunny:", msg.Text},
+		{"休日出勤する場合は理由を入力し、<https://teamspirit-1234.cloudforce.test|TeamSpirit> で休日出勤を申請すると打刻できます", msg.Attachments[0].Text},
+		{callbackIDHolidayWork, msg.Attachments[0].CallbackID},
+		{actionTypeHolidayWork, msg.Attachments[0].Actions[0].Name},
 		{true, gock.IsDone()},
 	} {
 		test.Compare(t)
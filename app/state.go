@@ -1,11 +1,18 @@
 package app
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
-
-	"github.com/garyburd/redigo/redis"
+	"errors"
+	"strings"
+	"time"
 )
 
+// stateExpiry is long enough for re-authentication prompts sent the day before
+const stateExpiry = 24 * time.Hour
+
 // State state for authentication
 type State struct {
 	UserID      string `json:"u,omitempty"`
@@ -13,37 +20,62 @@ type State struct {
 	ResponseURL string `json:"r,omitempty"`
 }
 
-func (ctx *Context) getState(state string) *State {
-	res, err := ctx.RedisConn.Do("HGET", ctx.StateStoreKey, state)
+type signedState struct {
+	State
+	Nonce     string `json:"n"`
+	ExpiresAt int64  `json:"e"`
+}
+
+var (
+	errInvalidState = errors.New("state is invalid")
+	errExpiredState = errors.New("state has expired")
+)
+
+// getState returns the state carried by the token, or nil when it is forged or expired
+func (ctx *Context) getState(token string) *State {
+	state, err := ctx.verifyState(token)
 	if err != nil {
 		return nil
 	}
-	if data, ok := res.([]byte); ok {
-		var res State
-		json.Unmarshal(data, &res)
-		return &res
-	}
-	return nil
+	return state
 }
 
+// storeState returns the token carrying the state, signed with the secret of the app
 func (ctx *Context) storeState(state State) (string, error) {
 	state.UserID = ctx.UserID
-	stateKey := ctx.generateState()
-	jsonData, _ := json.Marshal(state)
-	_, err := redis.Bool(ctx.RedisConn.Do("HSET", ctx.StateStoreKey, stateKey, string(jsonData)))
-	return stateKey, err
+	data, err := json.Marshal(signedState{
+		State:     state,
+		Nonce:     ctx.randomString(12),
+		ExpiresAt: ctx.now().Add(stateExpiry).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + ctx.signState(payload), nil
 }
 
-func (ctx *Context) deleteState(state string) error {
-	_, err := ctx.RedisConn.Do("HDEL", ctx.StateStoreKey, state)
-	return err
+func (ctx *Context) verifyState(token string) (*State, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 || !hmac.Equal([]byte(parts[1]), []byte(ctx.signState(parts[0]))) {
+		return nil, errInvalidState
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errInvalidState
+	}
+	var state signedState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, errInvalidState
+	}
+	if ctx.now().Unix() >= state.ExpiresAt {
+		return nil, errExpiredState
+	}
+	return &state.State, nil
 }
 
-func (ctx *Context) generateState() string {
-	state := ctx.randomString(24)
-	exists, _ := redis.Bool(ctx.RedisConn.Do("HEXISTS", ctx.StateStoreKey, state))
-	if exists {
-		return ctx.generateState()
-	}
-	return state
+func (ctx *Context) signState(payload string) string {
+	mac := hmac.New(sha256.New, ctx.Secret)
+	mac.Write([]byte("state:" + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
 }
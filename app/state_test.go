@@ -1,34 +1,46 @@
 package app
 
 import (
-	"fmt"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestState(t *testing.T) {
 	app := createMockApp()
-	app.CleanRedis()
 	ctx := app.createContext(nil)
 	ctx.UserID = "FOO"
-	var callCount = 0
-	ctx.randomString = func(len int) string {
-		callCount++
-		return fmt.Sprintf("random-%d-%d", len, callCount)
-	}
-	ctx.RedisConn.Do("HSET", ctx.StateStoreKey, "random-24-1", "BAR")
-	state, err := ctx.storeState(State{TeamID: "T123456", UserID: "FOO", ResponseURL: "http://foo.com/bar"})
+	ctx.now = getMockTime
+	state, err := ctx.storeState(State{TeamID: "T123456", UserID: "BAR", ResponseURL: "http://foo.com/bar"})
+	other, _ := ctx.storeState(State{TeamID: "T123456", UserID: "BAR", ResponseURL: "http://foo.com/bar"})
 	for _, test := range []Test{
 		{true, err == nil},
-		{"random-24-2", state},
+		{false, state == other},
 		{"FOO", ctx.getState(state).UserID},
 		{"T123456", ctx.getState(state).TeamID},
 		{"http://foo.com/bar", ctx.getState(state).ResponseURL},
 	} {
 		test.Compare(t)
 	}
-	err = ctx.deleteState(state)
+
+	parts := strings.Split(state, ".")
+	forged, _ := ctx.storeState(State{TeamID: "T999999"})
+	ctx.Secret = []byte("another secret")
+	_, err = ctx.verifyState(state)
 	for _, test := range []Test{
-		{true, err == nil},
+		{errInvalidState, err},
+		{true, ctx.getState(parts[0]) == nil},
+		{true, ctx.getState(strings.Split(forged, ".")[0]+"."+parts[1]) == nil},
+		{true, ctx.getState("") == nil},
+	} {
+		test.Compare(t)
+	}
+
+	ctx.Secret = app.Secret
+	ctx.now = func() time.Time { return getMockTime().Add(stateExpiry) }
+	_, err = ctx.verifyState(state)
+	for _, test := range []Test{
+		{errExpiredState, err},
 		{true, ctx.getState(state) == nil},
 	} {
 		test.Compare(t)
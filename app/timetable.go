@@ -2,11 +2,14 @@ package app
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"fmt"
 	"io"
 	"io/ioutil"
+	"math/rand"
 	"net/http"
+	"net/url"
+	"sort"
 	"time"
 
 	"gopkg.in/guregu/null.v3"
@@ -15,12 +18,38 @@ import (
 type timeTable struct {
 	Items     []timeTableItem `json:"timeTable"`
 	IsHoliday *bool           `json:"isHoliday,omitempty"`
+	// LastModifiedDate is sent back on update to detect modifications made in the meantime
+	LastModifiedDate string `json:"lastModifiedDate,omitempty"`
+	// TargetDate is the workday returned by TeamSpirit, which is missing if the Apex class ignores the date parameter
+	TargetDate string `json:"targetDate,omitempty"`
+	// Date is set when the time table was fetched for a specific workday
+	Date time.Time `json:"-"`
+	// HolidayWork is the reason of working on the holiday, sent as the comment of attending
+	HolidayWork string `json:"-"`
 }
 
+// timeTableUpdate is the body of the update, which must have only the parameters of the Apex method
+type timeTableUpdate struct {
+	Items            []timeTableItem `json:"timeTable"`
+	LastModifiedDate string          `json:"lastModifiedDate,omitempty"`
+}
+
+type timeTableItemType int
+
+const (
+	timeTableItemTypeAttendance timeTableItemType = 1
+	timeTableItemTypeRest       timeTableItemType = 21
+	timeTableItemTypeRestOther  timeTableItemType = 22
+)
+
 type timeTableItem struct {
-	From null.Int `json:"from,omitempty"`
-	To   null.Int `json:"to,omitempty"`
-	Type int      `json:"type"`
+	From null.Int          `json:"from,omitempty"`
+	To   null.Int          `json:"to,omitempty"`
+	Type timeTableItemType `json:"type"`
+}
+
+type timeTableValidationError struct {
+	Message string
 }
 
 type timeTableError struct {
@@ -28,15 +57,22 @@ type timeTableError struct {
 	Code    string `json:"errorCode"`
 }
 
+const timeTableUpdateRetries = 3
+
 type timeTableClient struct {
-	HTTPClient *http.Client
-	Endpoint   string
+	HTTPClient    *http.Client
+	Endpoint      string
+	Timeout       time.Duration
+	Retries       int
+	RetryInterval time.Duration
+	// OnUpdate is called after TeamSpirit accepted an update
+	OnUpdate func()
 }
 
 func parseTimeTable(body []byte) (*timeTable, error) {
 	var errors []timeTableError
 	if err := json.Unmarshal(body, &errors); err == nil && len(errors) > 0 && errors[0].Code != "" {
-		return nil, fmt.Errorf("Error: %+v (%+v)", errors[0].Message, errors[0].Code)
+		return nil, errors[0].toError()
 	}
 	var timeTable timeTable
 	if err := json.Unmarshal(body, &timeTable); err != nil {
@@ -45,17 +81,45 @@ func parseTimeTable(body []byte) (*timeTable, error) {
 	return &timeTable, nil
 }
 
+func (err *timeTableValidationError) Error() string {
+	return err.Message
+}
+
+func newAttendanceItem(from, to null.Int) timeTableItem {
+	return timeTableItem{From: from, To: to, Type: timeTableItemTypeAttendance}
+}
+
+func newRestItem(from, to null.Int) timeTableItem {
+	return timeTableItem{From: from, To: to, Type: timeTableItemTypeRest}
+}
+
 func convertTime(time time.Time) null.Int {
 	hour, min, _ := time.Clock()
 	return null.IntFrom(int64(hour*60 + min))
 }
 
+// convertTime returns minutes from the beginning of the workday,
+// which exceeds 1440 for punches after midnight
+func (tt *timeTable) convertTime(t time.Time) null.Int {
+	if tt.Date.IsZero() {
+		return convertTime(t)
+	}
+	year, month, day := tt.Date.Date()
+	start := time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+	return null.IntFrom(int64(t.Sub(start) / time.Minute))
+}
+
+// IsContinuation returns true if the time table is for a workday before the given time
+func (tt *timeTable) IsContinuation(t time.Time) bool {
+	return !tt.Date.IsZero() && tt.Date.Format("2006-01-02") != t.Format("2006-01-02")
+}
+
 func (item *timeTableItem) IsAttendance() bool {
-	return item.Type == 1
+	return item.Type == timeTableItemTypeAttendance
 }
 
 func (item *timeTableItem) IsRest() bool {
-	return item.Type == 21 || item.Type == 22
+	return item.Type == timeTableItemTypeRest || item.Type == timeTableItemTypeRestOther
 }
 
 func (tt *timeTable) IsAttending() bool {
@@ -89,23 +153,17 @@ func (tt *timeTable) Attend(time time.Time) bool {
 	items := tt.Items
 	for i, item := range items {
 		if item.IsAttendance() {
-			items[i].From = convertTime(time)
+			items[i].From = tt.convertTime(time)
 			tt.Items = items
 			return true
 		}
 	}
-	tt.Items = append(tt.Items, timeTableItem{
-		From: convertTime(time),
-		Type: 1,
-	})
+	tt.Items = append(tt.Items, newAttendanceItem(tt.convertTime(time), null.Int{}))
 	return true
 }
 
 func (tt *timeTable) Rest(time time.Time) bool {
-	tt.Items = append(tt.Items, timeTableItem{
-		From: convertTime(time),
-		Type: 21,
-	})
+	tt.Items = append(tt.Items, newRestItem(tt.convertTime(time), null.Int{}))
 	return true
 }
 
@@ -113,93 +171,320 @@ func (tt *timeTable) Unrest(time time.Time) bool {
 	items := tt.Items
 	for i, item := range items {
 		if item.IsRest() && !item.To.Valid {
-			items[i].To = convertTime(time)
+			items[i].To = tt.convertTime(time)
 			tt.Items = items
 			return true
 		}
 	}
-	tt.Items = append(tt.Items, timeTableItem{
-		To:   convertTime(time),
-		Type: 21,
-	})
-	return true
-
+	return false
 }
 
 func (tt *timeTable) Leave(time time.Time) bool {
 	items := tt.Items
 	for i, item := range items {
-		if item.Type == 1 {
-			items[i].To = convertTime(time)
+		if item.IsAttendance() {
+			items[i].To = tt.convertTime(time)
 			tt.Items = items
 			return true
 		}
 	}
-	tt.Items = append(tt.Items, timeTableItem{
-		To:   convertTime(time),
-		Type: 1,
-	})
+	tt.Items = append(tt.Items, newAttendanceItem(null.Int{}, tt.convertTime(time)))
 	return true
 }
 
-func (ctx *Context) createTimeTableClient() *timeTableClient {
+// HasRest reports whether any rest is recorded
+func (tt *timeTable) HasRest() bool {
+	for _, item := range tt.Items {
+		if item.IsRest() {
+			return true
+		}
+	}
+	return false
+}
+
+func (tt *timeTable) attendanceItem() *timeTableItem {
+	for i, item := range tt.Items {
+		if item.IsAttendance() {
+			return &tt.Items[i]
+		}
+	}
+	return nil
+}
+
+// Validate checks that the time table is consistent before it is sent to TeamSpirit
+func (tt *timeTable) Validate() error {
+	for _, item := range tt.Items {
+		if !item.From.Valid && (item.To.Valid || item.IsRest()) {
+			if item.IsAttendance() {
+				return &timeTableValidationError{"出勤時刻が記録されていません"}
+			}
+			return &timeTableValidationError{"休憩の開始時刻が記録されていません"}
+		}
+		if item.From.Valid && item.To.Valid && item.To.Int64 < item.From.Int64 {
+			return &timeTableValidationError{"終了時刻が開始時刻より前になっています"}
+		}
+	}
+	rests := []timeTableItem{}
+	for _, item := range tt.Items {
+		if item.IsRest() {
+			rests = append(rests, item)
+		}
+	}
+	sort.Slice(rests, func(i, j int) bool {
+		return rests[i].From.Int64 < rests[j].From.Int64
+	})
+	for i := 1; i < len(rests); i++ {
+		prev := rests[i-1]
+		if !prev.To.Valid || prev.To.Int64 > rests[i].From.Int64 {
+			return &timeTableValidationError{"休憩時間が重複しています"}
+		}
+	}
+	if attendance := tt.attendanceItem(); attendance != nil && attendance.From.Valid {
+		for _, rest := range rests {
+			if rest.From.Int64 < attendance.From.Int64 ||
+				attendance.To.Valid && (!rest.To.Valid || rest.To.Int64 > attendance.To.Int64) {
+				return &timeTableValidationError{"休憩時間が勤務時間外です"}
+			}
+		}
+	}
+	return nil
+}
+
+func (ctx *Context) createTimeTableClient(c context.Context) *timeTableClient {
 	if ctx.TimeTableClient != nil {
 		return ctx.TimeTableClient
 	}
 	ctx.TimeTableClient = &timeTableClient{
-		HTTPClient: ctx.getSalesforceOAuth2Client(),
-		Endpoint:   "https://" + ctx.TeamSpiritHost + "/services/apexrest/Dakoku", // https://{host_sub_domain}.cloudforce.com/services/apexrest/Dakoku
+		HTTPClient:    ctx.getSalesforceOAuth2Client(c),
+		Endpoint:      "https://" + ctx.TeamSpiritHost + "/services/apexrest/Dakoku", // https://{host_sub_domain}.cloudforce.com/services/apexrest/Dakoku
+		Timeout:       ctx.RequestTimeout,
+		Retries:       ctx.RequestRetries,
+		RetryInterval: 500 * time.Millisecond,
+		OnUpdate: func() {
+			ctx.clearTimeTableCache()
+		},
 	}
 	return ctx.TimeTableClient
 }
 
-func (client *timeTableClient) doRequest(method string, data io.Reader) ([]byte, error) {
-	req, err := http.NewRequest(method, client.Endpoint, data)
+// doRequest sends the request, retrying GET requests with jittered backoff on server errors
+func (client *timeTableClient) doRequest(ctx context.Context, method string, date time.Time, data []byte) ([]byte, error) {
+	retries := 0
+	if method == http.MethodGet {
+		retries = client.Retries
+	}
+	for attempt := 0; ; attempt++ {
+		body, err := client.doRequestOnce(ctx, method, date, data)
+		if netErr, ok := err.(*timeTableNetworkError); !ok || netErr.Err != errTimeTableUnavailable || attempt >= retries {
+			return body, err
+		}
+		backoff := client.RetryInterval << uint(attempt)
+		if backoff > 0 {
+			backoff += time.Duration(rand.Int63n(int64(backoff)))
+		}
+		select {
+		case <-ctx.Done():
+			return nil, &timeTableNetworkError{ctx.Err()}
+		case <-time.After(backoff):
+		}
+	}
+}
+
+func (client *timeTableClient) doRequestOnce(ctx context.Context, method string, date time.Time, data []byte) ([]byte, error) {
+	if client.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, client.Timeout)
+		defer cancel()
+	}
+	var reader io.Reader
+	if data != nil {
+		reader = bytes.NewReader(data)
+	}
+	endpoint := client.Endpoint
+	if !date.IsZero() {
+		endpoint += "?" + url.Values{"date": []string{date.Format("2006-01-02")}}.Encode()
+	}
+	req, err := http.NewRequest(method, endpoint, reader)
 	if err != nil {
 		return nil, err
 	}
+	req = req.WithContext(ctx)
 	if data != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
 	res, err := client.HTTPClient.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, newTimeTableRequestError(err)
 	}
+	defer res.Body.Close()
 	body, err := ioutil.ReadAll(res.Body)
-	return body, err
+	if err != nil {
+		return nil, &timeTableNetworkError{err}
+	}
+	return body, newTimeTableResponseError(res, body)
 }
 
-func (client *timeTableClient) GetTimeTable() (*timeTable, error) {
-	body, err := client.doRequest(http.MethodGet, nil)
+func (client *timeTableClient) GetTimeTable(ctx context.Context) (*timeTable, error) {
+	return client.GetTimeTableOn(ctx, time.Time{})
+}
+
+// GetTimeTableOn fetches the time table of the workday, or today if date is zero
+func (client *timeTableClient) GetTimeTableOn(ctx context.Context, date time.Time) (*timeTable, error) {
+	body, err := client.doRequest(ctx, http.MethodGet, date, nil)
+	if err != nil {
+		return nil, err
+	}
+	timeTable, err := parseTimeTable(body)
 	if err != nil {
 		return nil, err
 	}
-	return parseTimeTable(body)
+	if !date.IsZero() && timeTable.TargetDate != date.Format("2006-01-02") {
+		return nil, errTimeTableDateUnsupported
+	}
+	timeTable.Date = date
+	return timeTable, nil
+}
+
+// getCurrentTimeTable returns the previous workday's time table while it is still open
+// before the day boundary hour, and today's time table otherwise. The previous workday
+// is skipped if the Apex class deployed to TeamSpirit does not support the date parameter.
+func (ctx *Context) getCurrentTimeTable(c context.Context, client *timeTableClient, now time.Time) (*timeTable, error) {
+	return ctx.findCurrentTimeTable(now, func(date time.Time) (*timeTable, error) {
+		return ctx.getTimeTableOn(c, client, date)
+	})
+}
+
+// getLatestTimeTable is getCurrentTimeTable without the cache, so that updates do not
+// overwrite the modifications made in TeamSpirit in the meantime
+func (ctx *Context) getLatestTimeTable(c context.Context, client *timeTableClient, now time.Time) (*timeTable, error) {
+	return ctx.findCurrentTimeTable(now, func(date time.Time) (*timeTable, error) {
+		return ctx.fetchTimeTableOn(c, client, date)
+	})
+}
+
+func (ctx *Context) findCurrentTimeTable(now time.Time, get func(date time.Time) (*timeTable, error)) (*timeTable, error) {
+	if now.Hour() < ctx.DayBoundaryHour {
+		previous, err := get(now.AddDate(0, 0, -1))
+		if err != nil && err != errTimeTableDateUnsupported {
+			return nil, err
+		}
+		if err == nil {
+			if state := previous.State(); state == attendanceStateWorking || state == attendanceStateResting {
+				return previous, nil
+			}
+		}
+	}
+	return get(now)
 }
 
-func (client *timeTableClient) UpdateTimeTable(timeTable *timeTable) (bool, error) {
-	timeTable.IsHoliday = nil
-	b, err := json.Marshal(timeTable)
+func (client *timeTableClient) UpdateTimeTable(ctx context.Context, timeTable *timeTable) (bool, error) {
+	if err := timeTable.Validate(); err != nil {
+		return false, err
+	}
+	// Updating another workday would overwrite today if the date parameter is ignored
+	if !timeTable.Date.IsZero() && timeTable.TargetDate != timeTable.Date.Format("2006-01-02") {
+		return false, errTimeTableDateUnsupported
+	}
+	b, err := json.Marshal(timeTableUpdate{timeTable.Items, timeTable.LastModifiedDate})
 	if err != nil {
 		return false, err
 	}
-	body, err := client.doRequest(http.MethodPost, bytes.NewBuffer(b))
-	fmt.Printf("%v %v %v\n", string(body), err, string(body) == `"OK"`)
+	body, err := client.doRequest(ctx, http.MethodPost, timeTable.Date, b)
 	if err != nil {
 		return false, err
 	}
-	return string(body) == `"OK"`, nil
+	if string(body) != `"OK"` {
+		return false, &timeTableBusinessError{string(body)}
+	}
+	client.updated()
+	return true, nil
+}
+
+// ApplyAction applies the action to the time table and sends it to TeamSpirit.
+// When the time table was modified in the meantime, it is fetched again and
+// the action is re-applied up to timeTableUpdateRetries times.
+func (client *timeTableClient) ApplyAction(ctx context.Context, tt *timeTable, action string, t time.Time) (bool, error) {
+	return client.applyWithRetries(ctx, tt, func(tt *timeTable) error {
+		return tt.Apply(action, t)
+	})
+}
+
+// ApplyLeaveWithRest leaves at the time and records the rest in the same update,
+// unless a rest has been recorded in the meantime
+func (client *timeTableClient) ApplyLeaveWithRest(ctx context.Context, tt *timeTable, rest timeTableItem, t time.Time) (bool, error) {
+	return client.applyWithRetries(ctx, tt, func(tt *timeTable) error {
+		if err := tt.Apply(actionTypeLeave, t); err != nil {
+			return err
+		}
+		if !tt.HasRest() {
+			tt.Items = append(tt.Items, rest)
+		}
+		return nil
+	})
+}
+
+func (client *timeTableClient) applyWithRetries(ctx context.Context, tt *timeTable, apply func(tt *timeTable) error) (bool, error) {
+	for retry := 0; ; retry++ {
+		if err := apply(tt); err != nil {
+			return false, err
+		}
+		ok, err := client.UpdateTimeTable(ctx, tt)
+		if err != errTimeTableConflict || retry >= timeTableUpdateRetries {
+			return ok, err
+		}
+		latest, err := client.GetTimeTableOn(ctx, tt.Date)
+		if err != nil {
+			return false, err
+		}
+		tt = latest
+	}
+}
+
+// applyAttendanceAction sends the action to TeamSpirit. Starting and finishing today's work
+// use the attendance API, and other workdays are updated through the time table, e.g.
+// leaving after midnight updates the previous workday.
+func (client *timeTableClient) applyAttendanceAction(ctx context.Context, timeTable *timeTable, action string, t time.Time) (bool, error) {
+	if timeTable.Date.IsZero() {
+		switch action {
+		case actionTypeAttend:
+			return client.SetAttendance(ctx, true, t, timeTable.HolidayWork)
+		case actionTypeLeave:
+			return client.SetAttendance(ctx, false, t, "")
+		}
+	}
+	return client.ApplyAction(ctx, timeTable, action, t)
 }
 
-func (client *timeTableClient) SetAttendance(attendance bool) (bool, error) {
-	data := map[string]bool{"attendance": attendance}
+// SetAttendance attends or leaves today at the time, or now if the time is zero.
+// The comment is recorded with the punch in TeamSpirit.
+func (client *timeTableClient) SetAttendance(ctx context.Context, attendance bool, t time.Time, comment string) (bool, error) {
+	data := map[string]interface{}{"attendance": attendance}
+	if !t.IsZero() {
+		data["minute"] = convertTime(t).Int64
+	}
+	if comment != "" {
+		data["comment"] = comment
+	}
 	b, err := json.Marshal(data)
 	if err != nil {
 		return false, err
 	}
-	body, err := client.doRequest(http.MethodPut, bytes.NewBuffer(b))
+	body, err := client.doRequest(ctx, http.MethodPut, time.Time{}, b)
 	if err != nil {
 		return false, err
 	}
-	return string(body) == `"OK"`, nil
+	if string(body) == `"HOLIDAY"` {
+		return false, errHolidayWorkNotApplied
+	}
+	if string(body) != `"OK"` {
+		return false, &timeTableBusinessError{string(body)}
+	}
+	client.updated()
+	return true, nil
+}
+
+func (client *timeTableClient) updated() {
+	if client.OnUpdate != nil {
+		client.OnUpdate()
+	}
 }
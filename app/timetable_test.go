@@ -1,12 +1,17 @@
 package app
 
 import (
+	"context"
 	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"testing"
 	"time"
 
+	"golang.org/x/oauth2"
 	null "gopkg.in/guregu/null.v3"
+	gock "gopkg.in/h2non/gock.v1"
 )
 
 type Test struct {
@@ -48,10 +53,10 @@ func TestParseTimeTable(t *testing.T) {
 		{2, len(timeTable.Items)},
 		{int64(600), timeTable.Items[0].From.ValueOrZero()},
 		{false, timeTable.Items[0].To.Valid},
-		{1, timeTable.Items[0].Type},
+		{timeTableItemTypeAttendance, timeTable.Items[0].Type},
 		{int64(780), timeTable.Items[1].From.ValueOrZero()},
 		{int64(840), timeTable.Items[1].To.ValueOrZero()},
-		{21, timeTable.Items[1].Type},
+		{timeTableItemTypeRest, timeTable.Items[1].Type},
 	} {
 		test.Compare(t)
 	}
@@ -119,7 +124,7 @@ func TestAttend(t *testing.T) {
 		{res, true},
 		{int64(672), tt.Items[2].From.ValueOrZero()},
 		{false, tt.Items[2].To.Valid},
-		{1, tt.Items[2].Type},
+		{timeTableItemTypeAttendance, tt.Items[2].Type},
 	} {
 		test.Compare(t)
 	}
@@ -139,7 +144,7 @@ func TestAttend2(t *testing.T) {
 		{res, true},
 		{int64(672), tt.Items[0].From.ValueOrZero()},
 		{int64(1140), tt.Items[0].To.ValueOrZero()},
-		{1, tt.Items[0].Type},
+		{timeTableItemTypeAttendance, tt.Items[0].Type},
 	} {
 		test.Compare(t)
 	}
@@ -158,7 +163,7 @@ func TestRest(t *testing.T) {
 		{res, true},
 		{int64(672), tt.Items[2].From.ValueOrZero()},
 		{false, tt.Items[2].To.Valid},
-		{21, tt.Items[2].Type},
+		{timeTableItemTypeRest, tt.Items[2].Type},
 	} {
 		test.Compare(t)
 	}
@@ -177,7 +182,24 @@ func TestUnrest(t *testing.T) {
 		{res, true},
 		{true, tt.Items[1].To.Valid},
 		{int64(672), tt.Items[1].To.ValueOrZero()},
-		{21, tt.Items[1].Type},
+		{timeTableItemTypeRest, tt.Items[1].Type},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestUnrestWithoutRest(t *testing.T) {
+	tt := timeTable{
+		Items: []timeTableItem{
+			{From: null.IntFrom(600), Type: timeTableItemTypeAttendance},
+			{From: null.IntFrom(620), To: null.IntFrom(630), Type: timeTableItemTypeRest},
+		},
+	}
+	res := tt.Unrest(getMockTime())
+	for _, test := range []Test{
+		{false, res},
+		{2, len(tt.Items)},
+		{int64(630), tt.Items[1].To.ValueOrZero()},
 	} {
 		test.Compare(t)
 	}
@@ -197,7 +219,7 @@ func TestLeave(t *testing.T) {
 		{true, tt.Items[2].To.Valid},
 		{int64(672), tt.Items[2].To.ValueOrZero()},
 		{false, tt.Items[2].From.Valid},
-		{1, tt.Items[2].Type},
+		{timeTableItemTypeAttendance, tt.Items[2].Type},
 	} {
 		test.Compare(t)
 	}
@@ -218,7 +240,7 @@ func TestLeave2(t *testing.T) {
 		{true, tt.Items[2].To.Valid},
 		{int64(672), tt.Items[2].To.ValueOrZero()},
 		{int64(600), tt.Items[2].From.ValueOrZero()},
-		{1, tt.Items[2].Type},
+		{timeTableItemTypeAttendance, tt.Items[2].Type},
 	} {
 		test.Compare(t)
 	}
@@ -228,3 +250,396 @@ func TestConvertTime(t *testing.T) {
 	result := convertTime(getMockTime())
 	Test{int64(672), result.ValueOrZero()}.Compare(t)
 }
+
+func TestNewTimeTableItems(t *testing.T) {
+	attendance := newAttendanceItem(null.IntFrom(600), null.Int{})
+	rest := newRestItem(null.IntFrom(720), null.IntFrom(780))
+	for _, test := range []Test{
+		{timeTableItemTypeAttendance, attendance.Type},
+		{true, attendance.IsAttendance()},
+		{int64(600), attendance.From.ValueOrZero()},
+		{false, attendance.To.Valid},
+		{timeTableItemTypeRest, rest.Type},
+		{true, rest.IsRest()},
+		{int64(780), rest.To.ValueOrZero()},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestValidateTimeTable(t *testing.T) {
+	for _, test := range []struct {
+		items    []timeTableItem
+		expected string
+	}{
+		{[]timeTableItem{}, ""},
+		{[]timeTableItem{
+			newAttendanceItem(null.IntFrom(600), null.Int{}),
+			newRestItem(null.IntFrom(720), null.IntFrom(780)),
+			newRestItem(null.IntFrom(900), null.Int{}),
+		}, ""},
+		{[]timeTableItem{
+			newAttendanceItem(null.IntFrom(600), null.IntFrom(1140)),
+			newRestItem(null.IntFrom(720), null.IntFrom(780)),
+		}, ""},
+		{[]timeTableItem{
+			newAttendanceItem(null.Int{}, null.IntFrom(1140)),
+		}, "出勤時刻が記録されていません"},
+		{[]timeTableItem{
+			newAttendanceItem(null.IntFrom(600), null.Int{}),
+			newRestItem(null.Int{}, null.IntFrom(780)),
+		}, "休憩の開始時刻が記録されていません"},
+		{[]timeTableItem{
+			newAttendanceItem(null.IntFrom(600), null.Int{}),
+			newRestItem(null.IntFrom(780), null.IntFrom(720)),
+		}, "終了時刻が開始時刻より前になっています"},
+		{[]timeTableItem{
+			newAttendanceItem(null.IntFrom(600), null.Int{}),
+			newRestItem(null.IntFrom(720), null.IntFrom(780)),
+			newRestItem(null.IntFrom(750), null.IntFrom(800)),
+		}, "休憩時間が重複しています"},
+		{[]timeTableItem{
+			newAttendanceItem(null.IntFrom(600), null.Int{}),
+			newRestItem(null.IntFrom(720), null.Int{}),
+			newRestItem(null.IntFrom(750), null.Int{}),
+		}, "休憩時間が重複しています"},
+		{[]timeTableItem{
+			newAttendanceItem(null.IntFrom(600), null.Int{}),
+			newRestItem(null.IntFrom(540), null.IntFrom(580)),
+		}, "休憩時間が勤務時間外です"},
+		{[]timeTableItem{
+			newAttendanceItem(null.IntFrom(600), null.IntFrom(1140)),
+			newRestItem(null.IntFrom(1100), null.IntFrom(1200)),
+		}, "休憩時間が勤務時間外です"},
+	} {
+		tt := timeTable{Items: test.items}
+		err := tt.Validate()
+		if test.expected == "" {
+			Test{nil, err}.Compare(t)
+		} else {
+			Test{true, err != nil}.Compare(t)
+			if err != nil {
+				Test{test.expected, err.Error()}.Compare(t)
+			}
+		}
+	}
+}
+
+func TestUpdateTimeTableWithInvalidTimeTable(t *testing.T) {
+	client := &timeTableClient{
+		HTTPClient: http.DefaultClient,
+		Endpoint:   "https://teamspirit-1234.cloudforce.test/services/apexrest/Dakoku",
+	}
+	ok, err := client.UpdateTimeTable(context.Background(), &timeTable{
+		Items: []timeTableItem{newRestItem(null.Int{}, null.IntFrom(780))},
+	})
+	_, isValidationErr := err.(*timeTableValidationError)
+	for _, test := range []Test{
+		{false, ok},
+		{true, isValidationErr},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestConvertTimeAfterMidnight(t *testing.T) {
+	tt := timeTable{
+		Items: []timeTableItem{
+			newAttendanceItem(null.IntFrom(600), null.Int{}),
+		},
+		Date: getMockTime().AddDate(0, 0, -1),
+	}
+	now := getMockTime().Add(-10*time.Hour - 42*time.Minute) // 2018-09-01 00:30
+	res := tt.Leave(now)
+	for _, test := range []Test{
+		{true, res},
+		{int64(1470), tt.Items[0].To.ValueOrZero()},
+		{int64(30), convertTime(now).ValueOrZero()},
+		{true, tt.IsContinuation(now)},
+		{false, tt.IsContinuation(now.AddDate(0, 0, -1))},
+		{false, (&timeTable{}).IsContinuation(now)},
+		{nil, tt.Validate()},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestGetCurrentTimeTable(t *testing.T) {
+	defer gock.Off()
+	app := createMockApp()
+	ctx := app.createContext(nil)
+	ctx.DayBoundaryHour = 5
+	ctx.now = getMockTime
+	client := &timeTableClient{
+		HTTPClient: &http.Client{},
+		Endpoint:   "https://teamspirit-1234.cloudforce.test/services/apexrest/Dakoku",
+	}
+	gock.InterceptClient(client.HTTPClient)
+	now := getMockTime().Add(-10*time.Hour - 42*time.Minute) // 2018-09-01 00:30
+
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Get("/services/apexrest/Dakoku").
+		MatchParam("date", "2018-08-31").
+		Reply(200).
+		JSON(map[string]interface{}{
+			"timeTable":  []map[string]interface{}{{"from": 600, "to": nil, "type": 1}},
+			"isHoliday":  false,
+			"targetDate": "2018-08-31",
+		})
+	tt, err := ctx.getCurrentTimeTable(context.Background(), client, now)
+	for _, test := range []Test{
+		{nil, err},
+		{"2018-08-31", tt.Date.Format("2006-01-02")},
+		{true, tt.IsContinuation(now)},
+		{true, gock.IsDone()},
+	} {
+		test.Compare(t)
+	}
+
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Get("/services/apexrest/Dakoku").
+		MatchParam("date", "2018-08-31").
+		Reply(200).
+		JSON(map[string]interface{}{
+			"timeTable":  []map[string]interface{}{{"from": 600, "to": 1140, "type": 1}},
+			"isHoliday":  false,
+			"targetDate": "2018-08-31",
+		})
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Get("/services/apexrest/Dakoku").
+		Reply(200).
+		JSON(map[string]interface{}{
+			"timeTable": []map[string]interface{}{},
+			"isHoliday": false,
+		})
+	tt, err = ctx.getCurrentTimeTable(context.Background(), client, now)
+	for _, test := range []Test{
+		{nil, err},
+		{true, tt.Date.IsZero()},
+		{attendanceStateNotStarted, tt.State()},
+		{true, gock.IsDone()},
+	} {
+		test.Compare(t)
+	}
+
+	// The Apex class ignoring the date parameter returns today, which must not be continued
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Get("/services/apexrest/Dakoku").
+		MatchParam("date", "2018-08-31").
+		Reply(200).
+		JSON(map[string]interface{}{
+			"timeTable": []map[string]interface{}{{"from": 600, "to": nil, "type": 1}},
+			"isHoliday": false,
+		})
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Get("/services/apexrest/Dakoku").
+		Reply(200).
+		JSON(map[string]interface{}{
+			"timeTable": []map[string]interface{}{{"from": 600, "to": nil, "type": 1}},
+			"isHoliday": false,
+		})
+	tt, err = ctx.getCurrentTimeTable(context.Background(), client, now)
+	for _, test := range []Test{
+		{nil, err},
+		{true, tt.Date.IsZero()},
+		{false, tt.IsContinuation(now)},
+		{true, gock.IsDone()},
+	} {
+		test.Compare(t)
+	}
+
+	ok, err := client.UpdateTimeTable(context.Background(), &timeTable{
+		Items: []timeTableItem{newAttendanceItem(null.IntFrom(600), null.IntFrom(1470))},
+		Date:  now.AddDate(0, 0, -1),
+	})
+	Test{false, ok}.Compare(t)
+	Test{errTimeTableDateUnsupported, err}.Compare(t)
+}
+
+func TestPunchSendsLastModifiedDate(t *testing.T) {
+	defer gock.Off()
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := app.createContext(nil)
+	ctx.UserID = "FOO"
+	ctx.now = getMockTime
+	ctx.setSalesforceAccessToken(&oauth2.Token{AccessToken: "foo", RefreshToken: "bar", TokenType: "Bearer"})
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Get("/services/apexrest/Dakoku").
+		Reply(200).
+		JSON(map[string]interface{}{
+			"timeTable":        []map[string]interface{}{{"from": 600, "to": nil, "type": 1}},
+			"isHoliday":        false,
+			"lastModifiedDate": "2018-09-01T01:00:00.000Z",
+		})
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Post("/services/apexrest/Dakoku").
+		JSON(map[string]interface{}{
+			"timeTable":        []map[string]interface{}{{"from": 600, "to": nil, "type": 1}, {"from": 672, "to": nil, "type": 21}},
+			"lastModifiedDate": "2018-09-01T01:00:00.000Z",
+		}).
+		Reply(200).
+		BodyString(`"OK"`)
+	_, err := ctx.punch(context.Background(), ctx.createTimeTableClient(context.Background()), queuedPunch{Action: actionTypeRest, Time: getMockTime()})
+	Test{nil, err}.Compare(t)
+	Test{true, gock.IsDone()}.Compare(t)
+}
+
+func TestApplyActionWithConflict(t *testing.T) {
+	defer gock.Off()
+	client := &timeTableClient{
+		HTTPClient: &http.Client{},
+		Endpoint:   "https://teamspirit-1234.cloudforce.test/services/apexrest/Dakoku",
+	}
+	gock.InterceptClient(client.HTTPClient)
+	tt, _ := parseTimeTable([]byte(`{"timeTable":[{"from":600,"to":null,"type":1}],"lastModifiedDate":"2018-09-01T01:00:00.000Z"}`))
+
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Post("/services/apexrest/Dakoku").
+		JSON(map[string]interface{}{
+			"timeTable":        []map[string]interface{}{{"from": 600, "to": nil, "type": 1}, {"from": 672, "to": nil, "type": 21}},
+			"lastModifiedDate": "2018-09-01T01:00:00.000Z",
+		}).
+		Reply(409).
+		BodyString(`"CONFLICT"`)
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Get("/services/apexrest/Dakoku").
+		Reply(200).
+		JSON(map[string]interface{}{
+			"timeTable":        []map[string]interface{}{{"from": 540, "to": nil, "type": 1}},
+			"lastModifiedDate": "2018-09-01T02:00:00.000Z",
+		})
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Post("/services/apexrest/Dakoku").
+		JSON(map[string]interface{}{
+			"timeTable":        []map[string]interface{}{{"from": 540, "to": nil, "type": 1}, {"from": 672, "to": nil, "type": 21}},
+			"lastModifiedDate": "2018-09-01T02:00:00.000Z",
+		}).
+		Reply(200).
+		BodyString(`"OK"`)
+	ok, err := client.ApplyAction(context.Background(), tt, actionTypeRest, getMockTime())
+	for _, test := range []Test{
+		{true, ok},
+		{nil, err},
+		{true, gock.IsDone()},
+	} {
+		test.Compare(t)
+	}
+
+	tt, _ = parseTimeTable([]byte(`{"timeTable":[{"from":600,"to":null,"type":1}]}`))
+	for i := 0; i <= timeTableUpdateRetries; i++ {
+		gock.New("https://teamspirit-1234.cloudforce.test").
+			Post("/services/apexrest/Dakoku").
+			Reply(409).
+			BodyString(`"CONFLICT"`)
+		if i < timeTableUpdateRetries {
+			gock.New("https://teamspirit-1234.cloudforce.test").
+				Get("/services/apexrest/Dakoku").
+				Reply(200).
+				JSON(map[string]interface{}{
+					"timeTable": []map[string]interface{}{{"from": 600, "to": nil, "type": 1}},
+				})
+		}
+	}
+	ok, err = client.ApplyAction(context.Background(), tt, actionTypeRest, getMockTime())
+	for _, test := range []Test{
+		{false, ok},
+		{errTimeTableConflict, err},
+		{true, gock.IsDone()},
+	} {
+		test.Compare(t)
+	}
+
+	tt, _ = parseTimeTable([]byte(`{"timeTable":[{"from":600,"to":null,"type":1}]}`))
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Post("/services/apexrest/Dakoku").
+		Reply(409).
+		BodyString(`"CONFLICT"`)
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Get("/services/apexrest/Dakoku").
+		Reply(200).
+		JSON(map[string]interface{}{
+			"timeTable": []map[string]interface{}{{"from": 600, "to": 1140, "type": 1}},
+		})
+	ok, err = client.ApplyAction(context.Background(), tt, actionTypeRest, getMockTime())
+	_, isValidationErr := err.(*timeTableValidationError)
+	for _, test := range []Test{
+		{false, ok},
+		{true, isValidationErr},
+		{true, gock.IsDone()},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestDoRequestRetries(t *testing.T) {
+	defer gock.Off()
+	client := &timeTableClient{
+		HTTPClient:    &http.Client{},
+		Endpoint:      "https://teamspirit-1234.cloudforce.test/services/apexrest/Dakoku",
+		Retries:       2,
+		RetryInterval: time.Millisecond,
+	}
+	gock.InterceptClient(client.HTTPClient)
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Get("/services/apexrest/Dakoku").
+		Times(2).
+		Reply(502)
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Get("/services/apexrest/Dakoku").
+		Reply(200).
+		JSON(map[string]interface{}{"timeTable": []map[string]interface{}{}})
+	tt, err := client.GetTimeTable(context.Background())
+	for _, test := range []Test{
+		{nil, err},
+		{0, len(tt.Items)},
+		{true, gock.IsDone()},
+	} {
+		test.Compare(t)
+	}
+
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Get("/services/apexrest/Dakoku").
+		Times(3).
+		Reply(503)
+	_, err = client.GetTimeTable(context.Background())
+	for _, test := range []Test{
+		{true, isTemporaryError(err)},
+		{true, gock.IsDone()},
+	} {
+		test.Compare(t)
+	}
+
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Put("/services/apexrest/Dakoku").
+		Reply(503)
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Put("/services/apexrest/Dakoku").
+		Reply(200).
+		BodyString(`"OK"`)
+	ok, err := client.SetAttendance(context.Background(), true, time.Time{}, "")
+	for _, test := range []Test{
+		{false, ok},
+		{true, isTemporaryError(err)},
+		{false, gock.IsDone()},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestDoRequestTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer server.Close()
+	client := &timeTableClient{
+		HTTPClient: &http.Client{},
+		Endpoint:   server.URL,
+		Timeout:    10 * time.Millisecond,
+	}
+	_, err := client.GetTimeTable(context.Background())
+	Test{true, isTemporaryError(err)}.Compare(t)
+}
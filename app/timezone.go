@@ -0,0 +1,96 @@
+package app
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/nlopes/slack"
+)
+
+// slackTimeZoneExpiry is how long the time zone of the Slack profile is reused before asking Slack again
+const slackTimeZoneExpiry = 24 * time.Hour
+
+type slackTimeZone struct {
+	Name      string    `json:"name"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+func (ctx *Context) getSlackTimeZoneStoreKey() string {
+	return ctx.TimeZoneStoreKey + ":slack"
+}
+
+func (ctx *Context) setTimeZoneForUser(name string) error {
+	if name != "" {
+		if _, err := time.LoadLocation(name); err != nil {
+			return err
+		}
+	}
+	return ctx.setVariableInHash(ctx.TimeZoneStoreKey, name)
+}
+
+func (ctx *Context) getTimeZoneForUser() string {
+	if name := ctx.getVariableInHash(ctx.TimeZoneStoreKey, ctx.UserID); name != "" {
+		return name
+	}
+	var cached slackTimeZone
+	if data := ctx.getVariableInHash(ctx.getSlackTimeZoneStoreKey(), ctx.UserID); data != "" {
+		if err := json.Unmarshal([]byte(data), &cached); err == nil && ctx.now().Sub(cached.FetchedAt) < slackTimeZoneExpiry {
+			return cached.Name
+		}
+	}
+	token := ctx.getSlackAccessTokenForUser()
+	if token == "" {
+		return ""
+	}
+	user, err := slack.New(token).GetUserInfo(ctx.UserID)
+	if err != nil {
+		return ""
+	}
+	if data, err := json.Marshal(slackTimeZone{Name: user.TZ, FetchedAt: ctx.now()}); err == nil {
+		ctx.setVariableInHash(ctx.getSlackTimeZoneStoreKey(), data)
+	}
+	return user.TZ
+}
+
+// getLocationForUser returns the configured or Slack profile time zone of the user,
+// falling back to the server's local time zone
+func (ctx *Context) getLocationForUser() *time.Location {
+	if ctx.location != nil {
+		return ctx.location
+	}
+	ctx.location = time.Local
+	if name := ctx.getTimeZoneForUser(); name != "" {
+		if loc, err := time.LoadLocation(name); err == nil {
+			ctx.location = loc
+		}
+	}
+	return ctx.location
+}
+
+func (ctx *Context) getCurrentTimeForUser() time.Time {
+	return ctx.now().In(ctx.getLocationForUser())
+}
+
+func formatTime(t time.Time) string {
+	return t.Format("15:04 MST")
+}
+
+func (ctx *Context) getTimeZoneSlackMessage(args []string) (*slack.Msg, error) {
+	if len(args) > 0 {
+		name := strings.TrimSpace(args[0])
+		if name == "reset" {
+			name = ""
+		}
+		if err := ctx.setTimeZoneForUser(name); err != nil {
+			return &slack.Msg{
+				Text: "タイムゾーン `" + name + "` が見つかりません :warning:",
+			}, nil
+		}
+		ctx.location = nil
+	}
+	now := ctx.getCurrentTimeForUser()
+	return &slack.Msg{
+		Text: "タイムゾーンは " + now.Location().String() + " です (現在時刻 " + formatTime(now) + ")",
+	}, nil
+}
@@ -0,0 +1,126 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nlopes/slack"
+	"golang.org/x/oauth2"
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func TestGetLocationForUser(t *testing.T) {
+	defer gock.Off()
+	defer gock.RestoreClient(slack.HTTPClient)
+	app := createMockApp()
+	app.CleanRedis()
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/test", nil)
+	ctx := app.createContext(req)
+	ctx.UserID = "FOO"
+	Test{time.Local, ctx.getLocationForUser()}.Compare(t)
+
+	gock.New("https://slack.com").
+		Post("/api/users.info").
+		Reply(200).
+		JSON(map[string]interface{}{
+			"ok":   true,
+			"user": map[string]interface{}{"id": "FOO", "tz": "America/Los_Angeles"},
+		})
+	client := &http.Client{Transport: &http.Transport{}}
+	gock.InterceptClient(client)
+	slack.SetHTTPClient(client)
+	ctx = app.createContext(req)
+	ctx.UserID = "FOO"
+	ctx.setSlackAccessToken("foo")
+	for _, test := range []Test{
+		{"America/Los_Angeles", ctx.getLocationForUser().String()},
+		{true, gock.IsDone()},
+	} {
+		test.Compare(t)
+	}
+
+	// The time zone of the profile is cached, and fetched again after it expired
+	ctx = app.createContext(req)
+	ctx.UserID = "FOO"
+	Test{"America/Los_Angeles", ctx.getLocationForUser().String()}.Compare(t)
+	ctx = app.createContext(req)
+	ctx.UserID = "FOO"
+	ctx.now = func() time.Time { return time.Now().Add(slackTimeZoneExpiry) }
+	Test{time.Local, ctx.getLocationForUser()}.Compare(t)
+
+	ctx = app.createContext(req)
+	ctx.UserID = "FOO"
+	for _, test := range []Test{
+		{true, ctx.setTimeZoneForUser("Hoge/Fuga") != nil},
+		{nil, ctx.setTimeZoneForUser("Europe/London")},
+		{"Europe/London", ctx.getLocationForUser().String()},
+		{"Europe/London", ctx.getCurrentTimeForUser().Location().String()},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestPunchInUserTimeZone(t *testing.T) {
+	defer gock.Off()
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := app.createContext(nil)
+	ctx.UserID = "FOO"
+	ctx.now = getMockTime
+	ctx.location, _ = time.LoadLocation("America/Los_Angeles")
+	ctx.setSalesforceAccessToken(&oauth2.Token{AccessToken: "foo", RefreshToken: "bar", TokenType: "Bearer"})
+	setupTimeTableGocks([]timeTableItem{}, &[]bool{false}[0])
+	// 2018-09-01 11:12 in Tokyo is 2018-08-31 19:12 in Los Angeles
+	gock.New("https://teamspirit-1234.cloudforce.test").
+		Put("/services/apexrest/Dakoku").
+		JSON(map[string]interface{}{"attendance": true, "minute": 19*60 + 12}).
+		Reply(200).
+		BodyString(`"OK"`)
+	now := ctx.getCurrentTimeForUser()
+	_, err := ctx.punch(context.Background(), ctx.createTimeTableClient(context.Background()), queuedPunch{Action: actionTypeAttend, Time: now})
+	for _, test := range []Test{
+		{nil, err},
+		{"19:12 PDT", formatTime(now)},
+		{true, gock.IsDone()},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestGetTimeZoneSlackMessage(t *testing.T) {
+	app := createMockApp()
+	app.CleanRedis()
+	req, _ := http.NewRequest(http.MethodPost, "https://example.com/hooks/slash", nil)
+	ctx := app.createContext(req)
+	ctx.UserID = "FOO"
+	msg, err := ctx.getSlackMessage(context.Background(), slack.SlashCommand{TeamID: "T12345678", Text: "tz Asia/Tokyo"})
+	for _, test := range []Test{
+		{nil, err},
+		{0, strings.Index(msg.Text, "タイムゾーンは Asia/Tokyo です (現在時刻 ")},
+		{"Asia/Tokyo", ctx.getVariableInHash(ctx.TimeZoneStoreKey, "FOO")},
+	} {
+		test.Compare(t)
+	}
+	msg, err = ctx.getTimeZoneSlackMessage([]string{"Hoge/Fuga"})
+	for _, test := range []Test{
+		{nil, err},
+		{"タイムゾーン `Hoge/Fuga` が見つかりません :warning:", msg.Text},
+		{"Asia/Tokyo", ctx.getVariableInHash(ctx.TimeZoneStoreKey, "FOO")},
+	} {
+		test.Compare(t)
+	}
+	msg, err = ctx.getTimeZoneSlackMessage([]string{"reset"})
+	for _, test := range []Test{
+		{nil, err},
+		{"", ctx.getVariableInHash(ctx.TimeZoneStoreKey, "FOO")},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestFormatTime(t *testing.T) {
+	Test{"11:12 Asia/Tokyo", formatTime(getMockTime())}.Compare(t)
+}
@@ -0,0 +1,97 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	tokenRefreshLockExpiry   = 30 * time.Second
+	tokenRefreshLockTimeout  = 10 * time.Second
+	tokenRefreshLockInterval = 100 * time.Millisecond
+)
+
+var errTokenRefreshLockTimeout = errors.New("timed out waiting for the token refresh lock")
+
+// salesforceTokenSource refreshes the token of the user and stores it only when it has changed.
+// Refreshes are serialized across instances with a lock in Redis, so a rotated refresh token
+// is never used twice.
+type salesforceTokenSource struct {
+	ctx   *Context
+	c     context.Context
+	token *oauth2.Token
+}
+
+func (ctx *Context) newSalesforceTokenSource(c context.Context, token *oauth2.Token) *salesforceTokenSource {
+	return &salesforceTokenSource{ctx: ctx, c: c, token: token}
+}
+
+func (s *salesforceTokenSource) Token() (*oauth2.Token, error) {
+	if s.token.Valid() {
+		return s.token, nil
+	}
+	return s.refresh()
+}
+
+// refresh obtains a new token even if the current one has not expired yet
+func (s *salesforceTokenSource) refresh() (*oauth2.Token, error) {
+	unlock, err := s.ctx.lockTokenRefresh(s.c)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	// Another request may have refreshed the token while we were waiting for the lock
+	if stored := s.ctx.getSalesforceAccessTokenForUser(); stored != nil && stored.Valid() && !isSameToken(stored, s.token) {
+		s.token = stored
+		return stored, nil
+	}
+	expired := &oauth2.Token{RefreshToken: s.token.RefreshToken}
+	token, err := s.ctx.getSalesforceOAuth2Config().TokenSource(s.c, expired).Token()
+	if err != nil {
+		return nil, err
+	}
+	if !isSameToken(token, s.token) {
+		if err := s.ctx.setSalesforceAccessToken(token); err != nil {
+			return nil, err
+		}
+	}
+	s.token = token
+	return token, nil
+}
+
+func isSameToken(a, b *oauth2.Token) bool {
+	return a.AccessToken == b.AccessToken &&
+		a.RefreshToken == b.RefreshToken &&
+		a.TokenType == b.TokenType &&
+		a.Expiry.Equal(b.Expiry)
+}
+
+func (ctx *Context) getTokenRefreshLockKey() string {
+	return ctx.SalesforceTokenStoreKey + ":lock:" + ctx.UserID
+}
+
+// lockTokenRefresh waits until the refresh lock of the user is acquired and returns the function to release it
+func (ctx *Context) lockTokenRefresh(c context.Context) (func(), error) {
+	key := ctx.getTokenRefreshLockKey()
+	value := ctx.randomString(32)
+	timeout := time.After(tokenRefreshLockTimeout)
+	for {
+		ok, err := ctx.acquireLock(key, value, tokenRefreshLockExpiry)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return func() { ctx.releaseLock(key, value) }, nil
+		}
+		select {
+		case <-c.Done():
+			return nil, c.Err()
+		case <-timeout:
+			return nil, errTokenRefreshLockTimeout
+		case <-time.After(tokenRefreshLockInterval):
+		}
+	}
+}
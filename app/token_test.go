@@ -0,0 +1,114 @@
+package app
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func TestSalesforceTokenSourceValidToken(t *testing.T) {
+	app := createMockApp()
+	app.CleanRedis()
+	token := &oauth2.Token{
+		AccessToken:  "foo",
+		RefreshToken: "bar",
+		TokenType:    "Bearer",
+		Expiry:       time.Now().Add(time.Hour).Truncate(time.Second),
+	}
+	ctx := createTestContext(app)
+	ctx.setSalesforceAccessToken(token)
+	ctx.setVariableInHash(ctx.SalesforceTokenStoreKey, "untouched")
+	res, err := ctx.newSalesforceTokenSource(context.Background(), token).Token()
+	for _, test := range []Test{
+		{nil, err},
+		{"foo", res.AccessToken},
+		{"untouched", ctx.getVariableInHash(ctx.SalesforceTokenStoreKey, "FOO")},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestSalesforceTokenSourceRefresh(t *testing.T) {
+	defer gock.Off()
+	app := createMockApp()
+	app.CleanRedis()
+	token := &oauth2.Token{
+		AccessToken:  "foo",
+		RefreshToken: "bar",
+		TokenType:    "Bearer",
+		Expiry:       time.Now().Add(-time.Hour).Truncate(time.Second),
+	}
+	ctx := createTestContext(app)
+	ctx.setSalesforceAccessToken(token)
+	gock.New("https://test.salesforce.com").
+		Post("/services/oauth2/token").
+		Reply(200).
+		JSON(map[string]interface{}{
+			"access_token":  "foo2",
+			"refresh_token": "bar2",
+			"token_type":    "Bearer",
+		})
+	res, err := ctx.newSalesforceTokenSource(context.Background(), token).Token()
+	stored := ctx.getSalesforceAccessTokenForUser()
+	lock, _ := ctx.RedisConn.Do("GET", ctx.getTokenRefreshLockKey())
+	for _, test := range []Test{
+		{nil, err},
+		{true, gock.IsDone()},
+		{"foo2", res.AccessToken},
+		{"foo2", stored.AccessToken},
+		{"bar2", stored.RefreshToken},
+		{true, stored.Valid()},
+		{nil, lock},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestSalesforceTokenSourceRefreshedByOthers(t *testing.T) {
+	defer gock.Off()
+	app := createMockApp()
+	app.CleanRedis()
+	token := &oauth2.Token{
+		AccessToken:  "foo",
+		RefreshToken: "bar",
+		TokenType:    "Bearer",
+		Expiry:       time.Now().Add(-time.Hour).Truncate(time.Second),
+	}
+	ctx := createTestContext(app)
+	ctx.setSalesforceAccessToken(&oauth2.Token{
+		AccessToken:  "foo2",
+		RefreshToken: "bar2",
+		TokenType:    "Bearer",
+		Expiry:       time.Now().Add(time.Hour).Truncate(time.Second),
+	})
+	ctx.RedisConn.Do("SET", ctx.getTokenRefreshLockKey(), "others", "PX", 200)
+	res, err := ctx.newSalesforceTokenSource(context.Background(), token).Token()
+	for _, test := range []Test{
+		{nil, err},
+		{"foo2", res.AccessToken},
+		{"bar2", res.RefreshToken},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestLockTokenRefresh(t *testing.T) {
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := createTestContext(app)
+	ctx.setSalesforceAccessToken(&oauth2.Token{AccessToken: "foo"})
+	ctx.RedisConn.Do("DEL", ctx.getTokenRefreshLockKey())
+	unlock, err := ctx.lockTokenRefresh(context.Background())
+	Test{nil, err}.Compare(t)
+	c, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, err = ctx.lockTokenRefresh(c)
+	Test{context.DeadlineExceeded, err}.Compare(t)
+	unlock()
+	unlock, err = ctx.lockTokenRefresh(context.Background())
+	Test{nil, err}.Compare(t)
+	unlock()
+}
@@ -2,12 +2,36 @@ package app
 
 import (
 	"crypto/rand"
-	"encoding/binary"
 	"strconv"
+	"time"
 )
 
-func randomString(len int) string {
-	var n uint64
-	binary.Read(rand.Reader, binary.LittleEndian, &n)
-	return strconv.FormatUint(n, len)
+const randomStringLetters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// randomString returns n letters chosen uniformly with crypto/rand
+func randomString(n int) string {
+	// Bytes above the largest multiple of the number of letters are discarded to avoid bias
+	max := byte(256 - 256%len(randomStringLetters))
+	res := make([]byte, 0, n)
+	buf := make([]byte, n)
+	for len(res) < n {
+		if _, err := rand.Read(buf); err != nil {
+			panic(err)
+		}
+		for _, b := range buf {
+			if b < max && len(res) < n {
+				res = append(res, randomStringLetters[int(b)%len(randomStringLetters)])
+			}
+		}
+	}
+	return string(res)
+}
+
+// parseSlackTimestamp parses timestamps like "1458170917.164398" sent by Slack
+func parseSlackTimestamp(ts string) (time.Time, bool) {
+	sec, err := strconv.ParseFloat(ts, 64)
+	if err != nil || sec <= 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(0, int64(sec*float64(time.Second))), true
 }
@@ -0,0 +1,17 @@
+package app
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestRandomString(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		s := randomString(24)
+		Test{true, regexp.MustCompile(`^[a-zA-Z0-9]{24}$`).MatchString(s)}.Compare(t)
+		Test{false, seen[s]}.Compare(t)
+		seen[s] = true
+	}
+	Test{64, len(randomString(64))}.Compare(t)
+}
@@ -0,0 +1,343 @@
+package app
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/nlopes/slack"
+)
+
+const (
+	webhookEventFailed = "failed"
+	// webhookRetries is the number of retries after the first delivery failed
+	webhookRetries     = 3
+	maxWebhooksPerTeam = 5
+	// webhookDeliveryLogSize is the number of deliveries kept per team
+	webhookDeliveryLogSize = 20
+)
+
+// webhookRetryInterval is doubled on each retry
+var webhookRetryInterval = 5 * time.Second
+
+var (
+	errTooManyWebhooks    = errors.New("too many webhooks")
+	errInvalidWebhookURL  = errors.New("webhook URL must be http or https")
+	errNotSlackTeamAdmin  = errors.New("only admins of the Slack team can manage webhooks")
+	errSlackNotAuthorized = errors.New("Slack is not authorized")
+)
+
+// webhook is an outbound endpoint registered by an admin of the team, notified of punches of the members
+type webhook struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// webhookEvent is the JSON body delivered to the webhooks
+type webhookEvent struct {
+	ID        string    `json:"id"`
+	Event     string    `json:"event"`
+	UserID    string    `json:"user_id"`
+	TeamID    string    `json:"team_id"`
+	Action    string    `json:"action"`
+	Minute    int64     `json:"minute"`
+	Timestamp time.Time `json:"timestamp"`
+	Error     string    `json:"error,omitempty"`
+}
+
+type webhookDelivery struct {
+	EventID     string    `json:"event_id"`
+	WebhookID   string    `json:"webhook_id"`
+	Event       string    `json:"event"`
+	UserID      string    `json:"user_id"`
+	StatusCode  int       `json:"status_code,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	Attempts    int       `json:"attempts"`
+	DeliveredAt time.Time `json:"delivered_at"`
+}
+
+// signWebhookPayload returns the signature sent in X-TsDakoku-Signature, computed like Slack's request signing
+func signWebhookPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v1:" + timestamp + ":"))
+	mac.Write(body)
+	return "v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (ctx *Context) getWebhookDeliveryStoreKey(teamID string) string {
+	return ctx.WebhookStoreKey + ":deliveries:" + teamID
+}
+
+func (ctx *Context) getWebhooks(teamID string) []webhook {
+	webhooks := []webhook{}
+	data := ctx.getVariableInHash(ctx.WebhookStoreKey, teamID)
+	if data == "" {
+		return webhooks
+	}
+	json.Unmarshal([]byte(data), &webhooks)
+	return webhooks
+}
+
+func (ctx *Context) setWebhooks(teamID string, webhooks []webhook) error {
+	if len(webhooks) == 0 {
+		_, err := ctx.RedisConn.Do("HDEL", ctx.WebhookStoreKey, teamID)
+		return err
+	}
+	data, err := json.Marshal(webhooks)
+	if err != nil {
+		return err
+	}
+	_, err = redis.Bool(ctx.RedisConn.Do("HSET", ctx.WebhookStoreKey, teamID, data))
+	return err
+}
+
+func (ctx *Context) addWebhook(teamID, rawURL string) (*webhook, error) {
+	if u, err := url.Parse(rawURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errInvalidWebhookURL
+	}
+	webhooks := ctx.getWebhooks(teamID)
+	if len(webhooks) >= maxWebhooksPerTeam {
+		return nil, errTooManyWebhooks
+	}
+	hook := webhook{
+		ID:        ctx.randomString(8),
+		URL:       rawURL,
+		Secret:    ctx.randomString(32),
+		CreatedBy: ctx.UserID,
+		CreatedAt: ctx.now(),
+	}
+	if err := ctx.setWebhooks(teamID, append(webhooks, hook)); err != nil {
+		return nil, err
+	}
+	return &hook, nil
+}
+
+func (ctx *Context) removeWebhook(teamID, id string) bool {
+	webhooks := ctx.getWebhooks(teamID)
+	for i, hook := range webhooks {
+		if hook.ID == id {
+			ctx.setWebhooks(teamID, append(webhooks[:i], webhooks[i+1:]...))
+			return true
+		}
+	}
+	return false
+}
+
+func (ctx *Context) getWebhookDeliveries(teamID string) []webhookDelivery {
+	deliveries := []webhookDelivery{}
+	values, err := redis.Strings(ctx.RedisConn.Do("LRANGE", ctx.getWebhookDeliveryStoreKey(teamID), 0, webhookDeliveryLogSize-1))
+	if err != nil {
+		return deliveries
+	}
+	for _, value := range values {
+		var delivery webhookDelivery
+		if err := json.Unmarshal([]byte(value), &delivery); err == nil {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	return deliveries
+}
+
+// logWebhookDelivery records the delivery with its own connection, as it outlives the request
+func (ctx *Context) logWebhookDelivery(teamID string, delivery webhookDelivery) {
+	data, err := json.Marshal(delivery)
+	if err != nil {
+		return
+	}
+	conn := ctx.RedisPool.Get()
+	defer conn.Close()
+	key := ctx.getWebhookDeliveryStoreKey(teamID)
+	conn.Do("LPUSH", key, data)
+	conn.Do("LTRIM", key, 0, webhookDeliveryLogSize-1)
+}
+
+// emitPunchEvent delivers the result of the punch to the webhooks of the team in the background
+func (ctx *Context) emitPunchEvent(punch queuedPunch, tt *timeTable, err error) {
+	if punch.TeamID == "" {
+		return
+	}
+	webhooks := ctx.getWebhooks(punch.TeamID)
+	if len(webhooks) == 0 {
+		return
+	}
+	minute := convertTime(punch.Time)
+	if tt != nil {
+		minute = tt.convertTime(punch.Time)
+	}
+	event := webhookEvent{
+		ID:        ctx.randomString(24),
+		Event:     punch.Action,
+		UserID:    ctx.UserID,
+		TeamID:    punch.TeamID,
+		Action:    punch.Action,
+		Minute:    minute.Int64,
+		Timestamp: punch.Time,
+	}
+	if err != nil {
+		event.Event = webhookEventFailed
+		event.Error = err.Error()
+	}
+	for _, hook := range webhooks {
+		ctx.webhookDeliveries.Add(1)
+		go func(hook webhook) {
+			defer ctx.webhookDeliveries.Done()
+			ctx.deliverWebhook(hook, event)
+		}(hook)
+	}
+}
+
+// deliverWebhook posts the event, retrying with backoff while the endpoint is unavailable
+func (ctx *Context) deliverWebhook(hook webhook, event webhookEvent) webhookDelivery {
+	delivery := webhookDelivery{
+		EventID:   event.ID,
+		WebhookID: hook.ID,
+		Event:     event.Event,
+		UserID:    event.UserID,
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+	client := ctx.newExternalHTTPClient()
+	interval := webhookRetryInterval
+	for {
+		delivery.Attempts++
+		var retry bool
+		delivery.StatusCode, retry, err = ctx.postWebhook(client, hook, body)
+		delivery.Error = ""
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+		if !retry || delivery.Attempts > webhookRetries {
+			break
+		}
+		time.Sleep(interval)
+		interval *= 2
+	}
+	delivery.DeliveredAt = ctx.now()
+	ctx.logWebhookDelivery(event.TeamID, delivery)
+	return delivery
+}
+
+// postWebhook returns the status code, and whether the request should be retried
+func (ctx *Context) postWebhook(client *http.Client, hook webhook, body []byte) (int, bool, error) {
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewBuffer(body))
+	if err != nil {
+		return 0, false, err
+	}
+	timestamp := strconv.FormatInt(ctx.now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ts-dakoku")
+	req.Header.Set("X-TsDakoku-Request-Timestamp", timestamp)
+	req.Header.Set("X-TsDakoku-Signature", signWebhookPayload(hook.Secret, timestamp, body))
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, !errors.Is(err, errInternalAddress), err
+	}
+	res.Body.Close()
+	if res.StatusCode >= http.StatusMultipleChoices {
+		retry := res.StatusCode >= http.StatusInternalServerError || res.StatusCode == http.StatusTooManyRequests
+		return res.StatusCode, retry, fmt.Errorf("responded with status %d", res.StatusCode)
+	}
+	return res.StatusCode, false, nil
+}
+
+// parseSlackURL returns the URL of the link formatted by Slack, like <https://example.com|example.com>
+func parseSlackURL(text string) string {
+	text = strings.TrimSuffix(strings.TrimPrefix(text, "<"), ">")
+	if i := strings.Index(text, "|"); i >= 0 {
+		text = text[:i]
+	}
+	return text
+}
+
+// checkSlackTeamAdmin returns nil if the user is an admin or an owner of the Slack team
+func (ctx *Context) checkSlackTeamAdmin() error {
+	token := ctx.getSlackAccessTokenForUser()
+	if token == "" {
+		return errSlackNotAuthorized
+	}
+	user, err := slack.New(token).GetUserInfo(ctx.UserID)
+	if err != nil {
+		return err
+	}
+	if !user.IsAdmin && !user.IsOwner {
+		return errNotSlackTeamAdmin
+	}
+	return nil
+}
+
+func (ctx *Context) getWebhookSlackMessage(state State, args []string) (*slack.Msg, error) {
+	switch err := ctx.checkSlackTeamAdmin(); err {
+	case nil:
+	case errSlackNotAuthorized:
+		return ctx.getAuthenticateSlackMessage(state)
+	case errNotSlackTeamAdmin:
+		return &slack.Msg{Text: "Webhook は Slack ワークスペースの管理者のみ設定できます :no_entry_sign:"}, nil
+	default:
+		return &slack.Msg{Text: "Slack のユーザー情報の取得に失敗しました :warning:"}, nil
+	}
+	teamID := state.TeamID
+	if len(args) > 1 && args[0] == "add" {
+		hook, err := ctx.addWebhook(teamID, parseSlackURL(args[1]))
+		switch err {
+		case nil:
+			return &slack.Msg{
+				Text: "Webhook `" + hook.ID + "` を登録しました :link: 署名用のシークレットは以下です\n```" + hook.Secret + "```\n" +
+					"`X-TsDakoku-Signature` ヘッダは `v1:{X-TsDakoku-Request-Timestamp}:{body}` の HMAC-SHA256 です",
+			}, nil
+		case errInvalidWebhookURL:
+			return &slack.Msg{Text: "URL `" + args[1] + "` は http または https で指定してください :warning:"}, nil
+		case errTooManyWebhooks:
+			return &slack.Msg{Text: "Webhook は " + strconv.Itoa(maxWebhooksPerTeam) + " 個まで登録できます :warning:"}, nil
+		}
+		return &slack.Msg{Text: "Webhook の登録に失敗しました :warning:"}, nil
+	}
+	if len(args) > 1 && args[0] == "remove" {
+		if !ctx.removeWebhook(teamID, args[1]) {
+			return &slack.Msg{Text: "Webhook `" + args[1] + "` が見つかりません :warning:"}, nil
+		}
+		return &slack.Msg{Text: "Webhook `" + args[1] + "` を削除しました :wastebasket:"}, nil
+	}
+	loc := ctx.getLocationForUser()
+	if len(args) > 0 && args[0] == "log" {
+		lines := []string{}
+		for _, delivery := range ctx.getWebhookDeliveries(teamID) {
+			result := ":white_check_mark:"
+			if delivery.Error != "" {
+				result = ":x: " + delivery.Error
+			}
+			lines = append(lines, fmt.Sprintf("• %s `%s` %s <@%s> (%d 回) %s",
+				delivery.DeliveredAt.In(loc).Format("01/02 15:04"), delivery.WebhookID, delivery.Event, delivery.UserID, delivery.Attempts, result))
+		}
+		if len(lines) == 0 {
+			return &slack.Msg{Text: "Webhook の送信履歴はありません"}, nil
+		}
+		return &slack.Msg{Text: "Webhook の送信履歴:\n" + strings.Join(lines, "\n")}, nil
+	}
+	lines := []string{}
+	for _, hook := range ctx.getWebhooks(teamID) {
+		lines = append(lines, "• `"+hook.ID+"` "+hook.URL+" ("+hook.CreatedAt.In(loc).Format("2006/01/02")+" <@"+hook.CreatedBy+"> 登録)")
+	}
+	text := "Webhook は登録されていません"
+	if len(lines) > 0 {
+		text = "Webhook:\n" + strings.Join(lines, "\n")
+	}
+	return &slack.Msg{
+		Text: text + "\n`/ts webhook add URL` で登録、`/ts webhook remove ID` で削除、`/ts webhook log` で送信履歴を確認できます",
+	}, nil
+}
@@ -0,0 +1,235 @@
+package app
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nlopes/slack"
+	gock "gopkg.in/h2non/gock.v1"
+)
+
+func TestSignWebhookPayload(t *testing.T) {
+	Test{"v1=03e759939a13f915b9a05b4e782207f2e4361c70906abc9c8781dbd1a37c02b7", signWebhookPayload("secret", "1535767942", []byte(`{"id":"foo"}`))}.Compare(t)
+}
+
+func TestParseSlackURL(t *testing.T) {
+	Test{"https://example.com/hook", parseSlackURL("<https://example.com/hook>")}.Compare(t)
+	Test{"https://example.com/hook", parseSlackURL("<https://example.com/hook|example.com/hook>")}.Compare(t)
+	Test{"https://example.com/hook", parseSlackURL("https://example.com/hook")}.Compare(t)
+}
+
+func TestAddAndRemoveWebhook(t *testing.T) {
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := createTestContext(app)
+	_, err := ctx.addWebhook("T12345678", "ftp://example.com/hook")
+	Test{errInvalidWebhookURL, err}.Compare(t)
+	hook, err := ctx.addWebhook("T12345678", "https://example.com/hook")
+	webhooks := ctx.getWebhooks("T12345678")
+	for _, test := range []Test{
+		{nil, err},
+		{1, len(webhooks)},
+		{hook.ID, webhooks[0].ID},
+		{"https://example.com/hook", webhooks[0].URL},
+		{32, len(webhooks[0].Secret)},
+		{"FOO", webhooks[0].CreatedBy},
+		{0, len(ctx.getWebhooks("T87654321"))},
+	} {
+		test.Compare(t)
+	}
+	Test{false, ctx.removeWebhook("T12345678", "foo")}.Compare(t)
+	Test{true, ctx.removeWebhook("T12345678", hook.ID)}.Compare(t)
+	Test{0, len(ctx.getWebhooks("T12345678"))}.Compare(t)
+
+	for i := 0; i < maxWebhooksPerTeam; i++ {
+		ctx.addWebhook("T12345678", "https://example.com/hook")
+	}
+	_, err = ctx.addWebhook("T12345678", "https://example.com/hook")
+	Test{errTooManyWebhooks, err}.Compare(t)
+}
+
+func TestDeliverWebhook(t *testing.T) {
+	defer func(transport http.RoundTripper) { externalTransport = transport }(externalTransport)
+	externalTransport = nil
+	defer func(interval time.Duration) { webhookRetryInterval = interval }(webhookRetryInterval)
+	webhookRetryInterval = time.Millisecond
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := createTestContext(app)
+
+	requests := []*http.Request{}
+	bodies := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests = append(requests, r)
+		bodies = append(bodies, string(body))
+		switch r.URL.Path {
+		case "/flaky":
+			if len(requests) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		case "/gone":
+			w.WriteHeader(http.StatusGone)
+		}
+	}))
+	defer server.Close()
+
+	hook := webhook{ID: "hook1", URL: server.URL + "/flaky", Secret: "secret"}
+	event := webhookEvent{
+		ID:        "event1",
+		Event:     actionTypeAttend,
+		UserID:    "FOO",
+		TeamID:    "T12345678",
+		Action:    actionTypeAttend,
+		Minute:    672,
+		Timestamp: getMockTime(),
+	}
+	delivery := ctx.deliverWebhook(hook, event)
+	for _, test := range []Test{
+		{2, delivery.Attempts},
+		{200, delivery.StatusCode},
+		{"", delivery.Error},
+		{2, len(requests)},
+		{`{"id":"event1","event":"attend","user_id":"FOO","team_id":"T12345678","action":"attend","minute":672,"timestamp":"2018-09-01T11:12:22+09:00"}`, bodies[1]},
+		{"application/json", requests[1].Header.Get("Content-Type")},
+		{"1535767942", requests[1].Header.Get("X-TsDakoku-Request-Timestamp")},
+		{signWebhookPayload("secret", "1535767942", []byte(bodies[1])), requests[1].Header.Get("X-TsDakoku-Signature")},
+	} {
+		test.Compare(t)
+	}
+
+	hook.URL = server.URL + "/gone"
+	delivery = ctx.deliverWebhook(hook, event)
+	Test{1, delivery.Attempts}.Compare(t)
+	Test{"responded with status 410", delivery.Error}.Compare(t)
+
+	hook.URL = "http://127.0.0.1:1/closed"
+	delivery = ctx.deliverWebhook(hook, event)
+	Test{webhookRetries + 1, delivery.Attempts}.Compare(t)
+
+	deliveries := ctx.getWebhookDeliveries("T12345678")
+	for _, test := range []Test{
+		{3, len(deliveries)},
+		{webhookRetries + 1, deliveries[0].Attempts},
+		{410, deliveries[1].StatusCode},
+		{"event1", deliveries[2].EventID},
+		{"hook1", deliveries[2].WebhookID},
+		{true, getMockTime().Equal(deliveries[2].DeliveredAt)},
+	} {
+		test.Compare(t)
+	}
+}
+
+func TestEmitPunchEvent(t *testing.T) {
+	defer func(transport http.RoundTripper) { externalTransport = transport }(externalTransport)
+	externalTransport = nil
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := createTestContext(app)
+	events := make(chan webhookEvent, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event webhookEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		events <- event
+	}))
+	defer server.Close()
+	ctx.addWebhook("T12345678", server.URL)
+
+	ctx.emitPunchEvent(queuedPunch{Action: actionTypeLeave, Time: getMockTime()}, nil, nil)
+	ctx.emitPunchEvent(queuedPunch{TeamID: "T12345678", Action: actionTypeLeave, Time: getMockTime().Add(14 * time.Hour)}, &timeTable{Date: getMockTime()}, nil)
+	select {
+	case event := <-events:
+		for _, test := range []Test{
+			{actionTypeLeave, event.Event},
+			{actionTypeLeave, event.Action},
+			{"FOO", event.UserID},
+			{"T12345678", event.TeamID},
+			{int64(1512), event.Minute},
+			{"", event.Error},
+		} {
+			test.Compare(t)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not delivered")
+	}
+
+	ctx.emitPunchEvent(queuedPunch{TeamID: "T12345678", Action: actionTypeRest, Time: getMockTime()}, nil, &timeTableBusinessError{"NG"})
+	select {
+	case event := <-events:
+		for _, test := range []Test{
+			{webhookEventFailed, event.Event},
+			{actionTypeRest, event.Action},
+			{int64(672), event.Minute},
+			{"TeamSpirit responded NG", event.Error},
+		} {
+			test.Compare(t)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not delivered")
+	}
+
+	app.webhookDeliveries.Wait()
+	deliveries := ctx.getWebhookDeliveries("T12345678")
+	Test{2, len(deliveries)}.Compare(t)
+	Test{webhookEventFailed, deliveries[0].Event}.Compare(t)
+}
+
+func TestGetWebhookSlackMessage(t *testing.T) {
+	defer gock.Off()
+	defer gock.RestoreClient(slack.HTTPClient)
+	app := createMockApp()
+	app.CleanRedis()
+	ctx := createTestContext(app)
+	state := State{TeamID: "T12345678", UserID: "FOO"}
+
+	msg, _ := ctx.getWebhookSlackMessage(state, []string{})
+	Test{"Slack で認証を行って、再度 `/ts channel` コマンドを実行してください :bow:", msg.Attachments[0].Text}.Compare(t)
+
+	ctx.setSlackAccessToken("xoxp-foo")
+	client := &http.Client{Transport: &http.Transport{}}
+	gock.InterceptClient(client)
+	slack.SetHTTPClient(client)
+	gock.New("https://slack.com").
+		Post("/api/users.info").
+		Reply(200).
+		JSON(map[string]interface{}{"ok": true, "user": map[string]interface{}{"id": "FOO", "is_admin": false}})
+	msg, _ = ctx.getWebhookSlackMessage(state, []string{"add", "<https://example.com/hook>"})
+	Test{"Webhook は Slack ワークスペースの管理者のみ設定できます :no_entry_sign:", msg.Text}.Compare(t)
+	Test{0, len(ctx.getWebhooks("T12345678"))}.Compare(t)
+
+	gock.New("https://slack.com").
+		Post("/api/users.info").
+		Persist().
+		Reply(200).
+		JSON(map[string]interface{}{"ok": true, "user": map[string]interface{}{"id": "FOO", "is_admin": true}})
+	msg, _ = ctx.getWebhookSlackMessage(state, []string{"add", "<https://example.com/hook>"})
+	webhooks := ctx.getWebhooks("T12345678")
+	for _, test := range []Test{
+		{1, len(webhooks)},
+		{"https://example.com/hook", webhooks[0].URL},
+		{0, strings.Index(msg.Text, "Webhook `"+webhooks[0].ID+"` を登録しました :link: 署名用のシークレットは以下です\n```"+webhooks[0].Secret+"```")},
+	} {
+		test.Compare(t)
+	}
+	msg, _ = ctx.getWebhookSlackMessage(state, []string{"add", "example.com"})
+	Test{"URL `example.com` は http または https で指定してください :warning:", msg.Text}.Compare(t)
+	msg, _ = ctx.getWebhookSlackMessage(state, nil)
+	Test{"Webhook:\n• `" + webhooks[0].ID + "` https://example.com/hook (2018/09/01 <@FOO> 登録)\n`/ts webhook add URL` で登録、`/ts webhook remove ID` で削除、`/ts webhook log` で送信履歴を確認できます", msg.Text}.Compare(t)
+
+	msg, _ = ctx.getWebhookSlackMessage(state, []string{"log"})
+	Test{"Webhook の送信履歴はありません", msg.Text}.Compare(t)
+	ctx.logWebhookDelivery("T12345678", webhookDelivery{WebhookID: webhooks[0].ID, Event: "attend", UserID: "BAR", Attempts: 1, StatusCode: 200, DeliveredAt: getMockTime()})
+	ctx.logWebhookDelivery("T12345678", webhookDelivery{WebhookID: webhooks[0].ID, Event: "failed", UserID: "BAR", Attempts: 4, Error: "responded with status 500", DeliveredAt: getMockTime()})
+	msg, _ = ctx.getWebhookSlackMessage(state, []string{"log"})
+	Test{"Webhook の送信履歴:\n• 09/01 11:12 `" + webhooks[0].ID + "` failed <@BAR> (4 回) :x: responded with status 500\n• 09/01 11:12 `" + webhooks[0].ID + "` attend <@BAR> (1 回) :white_check_mark:", msg.Text}.Compare(t)
+
+	msg, _ = ctx.getWebhookSlackMessage(state, []string{"remove", "foo"})
+	Test{"Webhook `foo` が見つかりません :warning:", msg.Text}.Compare(t)
+	msg, _ = ctx.getWebhookSlackMessage(state, []string{"remove", webhooks[0].ID})
+	Test{"Webhook `" + webhooks[0].ID + "` を削除しました :wastebasket:", msg.Text}.Compare(t)
+}
@@ -0,0 +1,203 @@
+package client
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const usage = `Usage: ts-dakoku <command> [options]
+
+Commands:
+  punch in|out|rest|back  punch the clock (--time HH:MM to punch at another time)
+  status                  show the time table of today
+  configure               save --url and --token to the config file
+  server                  start the server (default without command)
+
+Options of punch and status:
+  --json                  print the response of the API as JSON
+
+Config is read from %s, and overridden by TS_DAKOKU_URL and TS_DAKOKU_TOKEN.
+`
+
+// punchActions maps the arguments of punch to the actions of the API
+var punchActions = map[string]string{
+	"in":     "attend",
+	"out":    "leave",
+	"rest":   "rest",
+	"back":   "unrest",
+	"attend": "attend",
+	"leave":  "leave",
+	"unrest": "unrest",
+}
+
+// commands are the arguments which run the client rather than the server
+var commands = map[string]bool{
+	"punch":     true,
+	"status":    true,
+	"configure": true,
+	"help":      true,
+	"-h":        true,
+	"--help":    true,
+}
+
+// IsCommand reports whether the arguments run the client rather than the server
+func IsCommand(args []string) bool {
+	return len(args) > 0 && commands[args[0]]
+}
+
+// Run runs the command of the arguments, and returns the exit status
+func Run(args []string, stdout, stderr io.Writer) int {
+	path := GetConfigPath()
+	if len(args) == 0 {
+		fmt.Fprintf(stderr, usage, path)
+		return 2
+	}
+	switch args[0] {
+	case "punch":
+		return runPunch(args[1:], path, stdout, stderr)
+	case "status":
+		return runStatus(args[1:], path, stdout, stderr)
+	case "configure":
+		return runConfigure(args[1:], path, stdout, stderr)
+	case "help", "-h", "--help":
+		fmt.Fprintf(stdout, usage, path)
+		return 0
+	}
+	fmt.Fprintf(stderr, "unknown command %s\n\n"+usage, args[0], path)
+	return 2
+}
+
+func newClient(path string, stderr io.Writer) *Client {
+	config, err := LoadConfig(path)
+	if err == nil {
+		err = config.Validate()
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return nil
+	}
+	return New(config)
+}
+
+// printError prints the error with the URL to authenticate with TeamSpirit if required
+func printError(err error, stderr io.Writer) int {
+	fmt.Fprintln(stderr, err)
+	if e, ok := err.(*Error); ok && e.AuthenticateURL != "" {
+		fmt.Fprintln(stderr, e.AuthenticateURL)
+	}
+	return 1
+}
+
+func printJSON(data interface{}, stdout io.Writer) {
+	b, _ := json.MarshalIndent(data, "", "  ")
+	fmt.Fprintln(stdout, string(b))
+}
+
+func runPunch(args []string, path string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("punch", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	t := flags.String("time", "", "time to punch at, in HH:MM or RFC 3339")
+	asJSON := flags.Bool("json", false, "print the response as JSON")
+	if len(args) == 0 {
+		fmt.Fprintln(stderr, "punch requires one of in, out, rest and back")
+		return 2
+	}
+	action, ok := punchActions[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "unknown action %s: use one of in, out, rest and back\n", args[0])
+		return 2
+	}
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	client := newClient(path, stderr)
+	if client == nil {
+		return 1
+	}
+	result, err := client.Punch(action, *t)
+	if err != nil {
+		return printError(err, stderr)
+	}
+	if *asJSON {
+		printJSON(result, stdout)
+	} else {
+		fmt.Fprintln(stdout, result.Message)
+	}
+	return 0
+}
+
+func runStatus(args []string, path string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("status", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	asJSON := flags.Bool("json", false, "print the response as JSON")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	client := newClient(path, stderr)
+	if client == nil {
+		return 1
+	}
+	timeTable, err := client.GetTimeTable()
+	if err != nil {
+		return printError(err, stderr)
+	}
+	if *asJSON {
+		printJSON(timeTable, stdout)
+		return 0
+	}
+	fmt.Fprintf(stdout, "%s %s\n", timeTable.Date, timeTable.StateText)
+	for _, item := range timeTable.Items {
+		label := "休憩"
+		if item.Type == "attendance" {
+			label = "勤務"
+		}
+		fmt.Fprintf(stdout, "  %s %5s - %s\n", label, item.From, item.To)
+	}
+	if len(timeTable.AllowedActions) > 0 {
+		names := []string{}
+		for _, action := range timeTable.AllowedActions {
+			names = append(names, getPunchCommand(action))
+		}
+		fmt.Fprintf(stdout, "next: ts-dakoku punch %s\n", strings.Join(names, "|"))
+	}
+	return 0
+}
+
+func getPunchCommand(action string) string {
+	for _, name := range []string{"in", "out", "rest", "back"} {
+		if punchActions[name] == action {
+			return name
+		}
+	}
+	return action
+}
+
+func runConfigure(args []string, path string, stdout, stderr io.Writer) int {
+	// the overrides of the environment are not saved
+	config, err := readConfigFile(path)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	flags := flag.NewFlagSet("configure", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&config.URL, "url", config.URL, "URL of the deployment, e.g. https://ts-dakoku.herokuapp.com")
+	flags.StringVar(&config.Token, "token", config.Token, "personal token issued by `/ts token new` in Slack")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	config.URL = strings.TrimRight(config.URL, "/")
+	if err := config.Validate(); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	if err := config.Save(path); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	fmt.Fprintln(stdout, "saved to "+path)
+	return 0
+}
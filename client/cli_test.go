@@ -0,0 +1,155 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func createMockServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if r.Header.Get("Authorization") != "Bearer tsd_foo" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":{"code":"unauthorized","message":"API トークンが無効です"}}`))
+			return
+		}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/v1/timetable":
+			w.Write([]byte(`{"date":"2018-09-01","state":"working","state_text":"勤務中","is_holiday":false,"items":[{"type":"attendance","from":"09:00"},{"type":"rest","from":"12:00","to":"13:00"}],"allowed_actions":["rest","leave"]}`))
+		case "POST /api/v1/punch":
+			var req map[string]string
+			json.NewDecoder(r.Body).Decode(&req)
+			if req["action"] == "unrest" {
+				w.WriteHeader(http.StatusConflict)
+				w.Write([]byte(`{"error":{"code":"action_not_allowed","message":"現在は勤務中のため「休憩を終了する」はできません","state":"working"}}`))
+				return
+			}
+			if req["action"] == "attend" {
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte(`{"error":{"code":"teamspirit_auth_required","message":"TeamSpirit で認証を行ってください","authenticate_url":"https://example.com/oauth/salesforce/authenticate/foo"}}`))
+				return
+			}
+			w.Write([]byte(`{"action":"` + req["action"] + `","time":"2018-09-01T` + req["time"] + `:00+09:00","message":"退勤しました (` + req["time"] + ` JST)","queued":false}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func runCommand(path string, args ...string) (int, string, string) {
+	os.Setenv("TS_DAKOKU_CONFIG", path)
+	defer os.Setenv("TS_DAKOKU_CONFIG", "")
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	code := Run(args, stdout, stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestIsCommand(t *testing.T) {
+	Test{false, IsCommand([]string{})}.Compare(t)
+	Test{false, IsCommand([]string{"server"})}.Compare(t)
+	Test{true, IsCommand([]string{"status"})}.Compare(t)
+	Test{true, IsCommand([]string{"punch", "in"})}.Compare(t)
+	Test{true, IsCommand([]string{"--help"})}.Compare(t)
+	Test{false, IsCommand([]string{"-port=8080"})}.Compare(t)
+}
+
+func TestRunUsage(t *testing.T) {
+	code, _, stderr := runCommand("/tmp/.ts-dakoku", "foo")
+	Test{2, code}.Compare(t)
+	Test{0, strings.Index(stderr, "unknown command foo\n\nUsage: ts-dakoku <command> [options]")}.Compare(t)
+	code, stdout, _ := runCommand("/tmp/.ts-dakoku", "help")
+	Test{0, code}.Compare(t)
+	Test{true, strings.Contains(stdout, "Config is read from /tmp/.ts-dakoku")}.Compare(t)
+	code, _, stderr = runCommand("/tmp/.ts-dakoku", "punch", "home")
+	Test{2, code}.Compare(t)
+	Test{"unknown action home: use one of in, out, rest and back\n", stderr}.Compare(t)
+}
+
+func TestRunStatus(t *testing.T) {
+	server := createMockServer()
+	defer server.Close()
+	path := createConfigFile(t, "url = "+server.URL+"\ntoken = tsd_foo\n")
+	defer os.RemoveAll(filepath.Dir(path))
+
+	code, stdout, _ := runCommand(path, "status")
+	Test{0, code}.Compare(t)
+	Test{"2018-09-01 勤務中\n  勤務 09:00 - \n  休憩 12:00 - 13:00\nnext: ts-dakoku punch rest|out\n", stdout}.Compare(t)
+
+	code, stdout, _ = runCommand(path, "status", "--json")
+	var timeTable TimeTable
+	json.Unmarshal([]byte(stdout), &timeTable)
+	Test{0, code}.Compare(t)
+	Test{"working", timeTable.State}.Compare(t)
+	Test{[]string{"rest", "leave"}, timeTable.AllowedActions}.DeepEqual(t)
+
+	os.Setenv("TS_DAKOKU_TOKEN", "tsd_bar")
+	code, _, stderr := runCommand(path, "status")
+	os.Setenv("TS_DAKOKU_TOKEN", "")
+	Test{1, code}.Compare(t)
+	Test{"API トークンが無効です\n", stderr}.Compare(t)
+}
+
+func TestRunPunch(t *testing.T) {
+	server := createMockServer()
+	defer server.Close()
+	path := createConfigFile(t, "url = "+server.URL+"\ntoken = tsd_foo\n")
+	defer os.RemoveAll(filepath.Dir(path))
+
+	code, stdout, _ := runCommand(path, "punch", "out", "--time", "18:30")
+	Test{0, code}.Compare(t)
+	Test{"退勤しました (18:30 JST)\n", stdout}.Compare(t)
+
+	code, stdout, _ = runCommand(path, "punch", "out", "--time", "18:30", "--json")
+	var result PunchResult
+	json.Unmarshal([]byte(stdout), &result)
+	Test{0, code}.Compare(t)
+	Test{"leave", result.Action}.Compare(t)
+
+	code, _, stderr := runCommand(path, "punch", "back")
+	Test{1, code}.Compare(t)
+	Test{"現在は勤務中のため「休憩を終了する」はできません\n", stderr}.Compare(t)
+
+	code, _, stderr = runCommand(path, "punch", "in")
+	Test{1, code}.Compare(t)
+	Test{"TeamSpirit で認証を行ってください\nhttps://example.com/oauth/salesforce/authenticate/foo\n", stderr}.Compare(t)
+
+	_, err := New(&Config{URL: server.URL, Token: "tsd_foo"}).Punch("unrest", "")
+	Test{http.StatusConflict, err.(*Error).StatusCode}.Compare(t)
+	Test{"working", err.(*Error).State}.Compare(t)
+}
+
+func TestRunConfigure(t *testing.T) {
+	path := createConfigFile(t, "")
+	defer os.RemoveAll(filepath.Dir(path))
+	code, _, stderr := runCommand(path, "configure", "--url", "https://example.com/")
+	Test{2, code}.Compare(t)
+	Test{"token are not configured. Run `ts-dakoku configure`\n", stderr}.Compare(t)
+
+	code, stdout, _ := runCommand(path, "configure", "--url", "https://example.com/", "--token", "tsd_foo")
+	data, _ := ioutil.ReadFile(path)
+	Test{0, code}.Compare(t)
+	Test{"saved to " + path + "\n", stdout}.Compare(t)
+	Test{"url = https://example.com\ntoken = tsd_foo\n", string(data)}.Compare(t)
+
+	code, _, _ = runCommand(path, "configure", "--token", "tsd_bar")
+	data, _ = ioutil.ReadFile(path)
+	Test{0, code}.Compare(t)
+	Test{"url = https://example.com\ntoken = tsd_bar\n", string(data)}.Compare(t)
+
+	os.Setenv("TS_DAKOKU_URL", "https://example.org")
+	os.Setenv("TS_DAKOKU_TOKEN", "tsd_baz")
+	code, _, _ = runCommand(path, "configure", "--token", "tsd_qux")
+	os.Setenv("TS_DAKOKU_URL", "")
+	os.Setenv("TS_DAKOKU_TOKEN", "")
+	data, _ = ioutil.ReadFile(path)
+	Test{0, code}.Compare(t)
+	Test{"url = https://example.com\ntoken = tsd_qux\n", string(data)}.Compare(t)
+}
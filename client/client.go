@@ -0,0 +1,142 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+const requestTimeout = 30 * time.Second
+
+// Client calls the JSON API of a deployment with a personal token issued by `/ts token new`
+type Client struct {
+	URL        string
+	Token      string
+	HTTPClient *http.Client
+}
+
+// TimeTable time table of today
+type TimeTable struct {
+	Date           string          `json:"date"`
+	State          string          `json:"state"`
+	StateText      string          `json:"state_text"`
+	IsHoliday      bool            `json:"is_holiday"`
+	Items          []TimeTableItem `json:"items"`
+	AllowedActions []string        `json:"allowed_actions"`
+}
+
+// TimeTableItem attendance or rest in the time table
+type TimeTableItem struct {
+	Type string `json:"type"`
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+// PunchResult result of the punch
+type PunchResult struct {
+	Action   string    `json:"action"`
+	Time     time.Time `json:"time"`
+	Message  string    `json:"message"`
+	Queued   bool      `json:"queued"`
+	QueuedID string    `json:"queued_id,omitempty"`
+}
+
+// Error error returned by the API
+type Error struct {
+	StatusCode      int    `json:"-"`
+	Code            string `json:"code"`
+	Message         string `json:"message"`
+	State           string `json:"state,omitempty"`
+	AuthenticateURL string `json:"authenticate_url,omitempty"`
+}
+
+func (err *Error) Error() string {
+	return err.Message
+}
+
+// New returns the client for the config
+func New(config *Config) *Client {
+	return &Client{
+		URL:        config.URL,
+		Token:      config.Token,
+		HTTPClient: &http.Client{Timeout: requestTimeout},
+	}
+}
+
+func (client *Client) doRequest(method, path string, data interface{}) ([]byte, error) {
+	var body io.Reader
+	if data != nil {
+		b, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewBuffer(b)
+	}
+	req, err := http.NewRequest(method, client.URL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+client.Token)
+	req.Header.Set("Accept", "application/json")
+	if data != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	res, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode >= http.StatusBadRequest {
+		var e struct {
+			Error *Error `json:"error"`
+		}
+		if err := json.Unmarshal(b, &e); err != nil || e.Error == nil {
+			return nil, fmt.Errorf("%s responded with status %d", client.URL, res.StatusCode)
+		}
+		e.Error.StatusCode = res.StatusCode
+		return nil, e.Error
+	}
+	return b, nil
+}
+
+// GetTimeTableJSON returns the time table of today as the API responded
+func (client *Client) GetTimeTableJSON() ([]byte, error) {
+	return client.doRequest(http.MethodGet, "/api/v1/timetable", nil)
+}
+
+// GetTimeTable returns the time table of today
+func (client *Client) GetTimeTable() (*TimeTable, error) {
+	b, err := client.GetTimeTableJSON()
+	if err != nil {
+		return nil, err
+	}
+	var timeTable TimeTable
+	if err := json.Unmarshal(b, &timeTable); err != nil {
+		return nil, err
+	}
+	return &timeTable, nil
+}
+
+// Punch applies the action at the time, which is now if empty
+func (client *Client) Punch(action, t string) (*PunchResult, error) {
+	b, err := client.doRequest(http.MethodPost, "/api/v1/punch", map[string]string{
+		"action": action,
+		"time":   t,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var result PunchResult
+	if err := json.Unmarshal(b, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
@@ -0,0 +1,101 @@
+package client
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Config settings of the client
+type Config struct {
+	URL   string
+	Token string
+}
+
+// GetConfigPath returns the path of the dotfile, which can be overridden with TS_DAKOKU_CONFIG
+func GetConfigPath() string {
+	if path := os.Getenv("TS_DAKOKU_CONFIG"); path != "" {
+		return path
+	}
+	return filepath.Join(os.Getenv("HOME"), ".ts-dakoku")
+}
+
+// LoadConfig reads the dotfile of `key = value` lines, and applies TS_DAKOKU_URL and TS_DAKOKU_TOKEN
+func LoadConfig(path string) (*Config, error) {
+	config, err := readConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if url := os.Getenv("TS_DAKOKU_URL"); url != "" {
+		config.URL = url
+	}
+	if token := os.Getenv("TS_DAKOKU_TOKEN"); token != "" {
+		config.Token = token
+	}
+	config.URL = strings.TrimRight(config.URL, "/")
+	return config, nil
+}
+
+// readConfigFile reads the dotfile without the overrides of the environment
+func readConfigFile(path string) (*Config, error) {
+	config := &Config{}
+	file, err := os.Open(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		for n := 1; scanner.Scan(); n++ {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			parts := strings.SplitN(line, "=", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("%s:%d: expected key = value", path, n)
+			}
+			value := strings.TrimSpace(parts[1])
+			switch key := strings.TrimSpace(parts[0]); key {
+			case "url":
+				config.URL = value
+			case "token":
+				config.Token = value
+			default:
+				return nil, fmt.Errorf("%s:%d: unknown key %s", path, n, key)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return config, nil
+}
+
+// Save writes the dotfile readable only by the user, as it contains the token
+func (config *Config) Save(path string) error {
+	data := "url = " + config.URL + "\ntoken = " + config.Token + "\n"
+	if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+		return err
+	}
+	// WriteFile keeps the permission of the existing file
+	return os.Chmod(path, 0600)
+}
+
+// Validate returns an error if the settings required to call the API are missing
+func (config *Config) Validate() error {
+	var missing []string
+	if config.URL == "" {
+		missing = append(missing, "url")
+	}
+	if config.Token == "" {
+		missing = append(missing, "token")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%s are not configured. Run `ts-dakoku configure`", strings.Join(missing, ", "))
+	}
+	return nil
+}
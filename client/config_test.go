@@ -0,0 +1,89 @@
+package client
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type Test struct {
+	expected interface{}
+	actual   interface{}
+}
+
+func (test Test) Compare(t *testing.T) {
+	if test.expected != test.actual {
+		t.Errorf(`Expected "%v" but got "%v"`, test.expected, test.actual)
+	}
+}
+
+func (test Test) DeepEqual(t *testing.T) {
+	if !reflect.DeepEqual(test.expected, test.actual) {
+		t.Errorf(`Expected "%v" but got "%v"`, test.expected, test.actual)
+	}
+}
+
+func createConfigFile(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "ts-dakoku")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, ".ts-dakoku")
+	if content != "" {
+		ioutil.WriteFile(path, []byte(content), 0600)
+	}
+	return path
+}
+
+func TestGetConfigPath(t *testing.T) {
+	os.Setenv("HOME", "/home/foo")
+	os.Setenv("TS_DAKOKU_CONFIG", "")
+	Test{"/home/foo/.ts-dakoku", GetConfigPath()}.Compare(t)
+	os.Setenv("TS_DAKOKU_CONFIG", "/etc/ts-dakoku")
+	Test{"/etc/ts-dakoku", GetConfigPath()}.Compare(t)
+	os.Setenv("TS_DAKOKU_CONFIG", "")
+}
+
+func TestLoadConfig(t *testing.T) {
+	os.Setenv("TS_DAKOKU_URL", "")
+	os.Setenv("TS_DAKOKU_TOKEN", "")
+	path := createConfigFile(t, "# ts-dakoku\nurl = https://example.com/\n\ntoken=tsd_foo\n")
+	defer os.RemoveAll(filepath.Dir(path))
+	config, err := LoadConfig(path)
+	Test{nil, err}.Compare(t)
+	Test{Config{URL: "https://example.com", Token: "tsd_foo"}, *config}.Compare(t)
+
+	os.Setenv("TS_DAKOKU_TOKEN", "tsd_bar")
+	config, _ = LoadConfig(path)
+	Test{"tsd_bar", config.Token}.Compare(t)
+	os.Setenv("TS_DAKOKU_TOKEN", "")
+
+	config, err = LoadConfig(path + ".missing")
+	Test{nil, err}.Compare(t)
+	Test{"url, token are not configured. Run `ts-dakoku configure`", config.Validate().Error()}.Compare(t)
+
+	ioutil.WriteFile(path, []byte("url\n"), 0600)
+	_, err = LoadConfig(path)
+	Test{path + ":1: expected key = value", err.Error()}.Compare(t)
+	ioutil.WriteFile(path, []byte("url = https://example.com\nfoo = bar\n"), 0600)
+	_, err = LoadConfig(path)
+	Test{path + ":2: unknown key foo", err.Error()}.Compare(t)
+}
+
+func TestSaveConfig(t *testing.T) {
+	path := createConfigFile(t, "")
+	defer os.RemoveAll(filepath.Dir(path))
+	config := &Config{URL: "https://example.com", Token: "tsd_foo"}
+	Test{nil, config.Save(path)}.Compare(t)
+	info, _ := os.Stat(path)
+	data, _ := ioutil.ReadFile(path)
+	Test{os.FileMode(0600), info.Mode().Perm()}.Compare(t)
+	Test{"url = https://example.com\ntoken = tsd_foo\n", string(data)}.Compare(t)
+
+	os.Chmod(path, 0644)
+	Test{nil, config.Save(path)}.Compare(t)
+	info, _ = os.Stat(path)
+	Test{os.FileMode(0600), info.Mode().Perm()}.Compare(t)
+}
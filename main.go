@@ -1,8 +1,16 @@
 package main
 
-import "github.com/ngs/ts-dakoku/app"
+import (
+	"os"
+
+	"github.com/ngs/ts-dakoku/app"
+	"github.com/ngs/ts-dakoku/client"
+)
 
 func main() {
+	if client.IsCommand(os.Args[1:]) {
+		os.Exit(client.Run(os.Args[1:], os.Stdout, os.Stderr))
+	}
 	if _, err := app.Run(); err != nil {
 		panic(err)
 	}